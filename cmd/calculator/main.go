@@ -3,6 +3,7 @@ package main
 import (
 	"ai-chat/internal/pkg/config"
 	"context"
+	_ "embed"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,6 +24,11 @@ import (
 const applicationName = "calculator"
 const serverShutdownTimeout = 5 * time.Second
 
+// openAPIDocument describes the calculator API, it lets the chat attach the service as tools
+//
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
 func main() {
 	setupZerolog()
 
@@ -81,6 +87,11 @@ func startHttpServer(listener net.Listener) *http.Server {
 		r.Post("/divide", handleDivide)
 	})
 
+	router.Get("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openAPIDocument)
+	})
+
 	// Root endpoint for service info
 	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
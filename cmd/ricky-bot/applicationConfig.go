@@ -9,4 +9,8 @@ type applicationConfig struct {
 	SystemPrompt   string `config_default:"You are a helpful AI assistant." config_description:"System prompt for the model"`
 	MaxSteps       int    `config_default:"20" config_description:"Maximum number of steps for the agent"`
 	MessageWindow  int    `config_default:"10" config_description:"Maximum number of messages to keep in history"`
+	LoopThreshold  int    `config_default:"3" config_description:"Repetitions of a tool call or a cycle of calls in a row that count as a loop"`
+	MaxLoops       int    `config_default:"2" config_description:"Tool call loops in a turn before the agent stops calling tools, 0 for no limit"`
+	AuditLogFile   string `config_default:"./logs/tool-audit.jsonl" config_description:"Path to the tool call audit log, empty to disable"`
+	AdminToken     string `config_default:"" config_description:"Bearer token of the admin endpoints, empty to disable them"`
 }
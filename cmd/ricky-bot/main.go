@@ -2,12 +2,14 @@ package main
 
 import (
 	"ai-chat/internal/pkg/agent"
+	"ai-chat/internal/pkg/audit"
 	"ai-chat/internal/pkg/config"
 	"ai-chat/internal/pkg/httpHandlers"
 	internalConfig "ai-chat/internal/pkg/mcpConfig"
 	"ai-chat/internal/pkg/models"
 	"ai-chat/internal/pkg/sessions"
 	"ai-chat/internal/pkg/staticAssets"
+	"ai-chat/internal/pkg/tools"
 	"ai-chat/internal/pkg/web"
 	"ai-chat/internal/pkg/websocketServer"
 	webAssets "ai-chat/web"
@@ -65,9 +67,22 @@ func main() {
 	}
 
 	// Create model configuration
-	modelConfig := &models.ProviderConfig{
-		ModelString:  appConfig.ModelName,
-		SystemPrompt: appConfig.SystemPrompt,
+	modelConfig := createProviderConfig(appConfig, mcpConfig)
+
+	// Register the tools implemented in Go
+	registry := tools.NewRegistry()
+	if err := tools.RegisterBuiltins(registry); err != nil {
+		log.Panic().Err(err).Msg("failed to register built-in tools")
+	}
+
+	// Open the tool call audit log
+	var auditLog *audit.Log
+	if appConfig.AuditLogFile != "" {
+		auditLog, err = audit.Open(appConfig.AuditLogFile)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to open the tool audit log")
+		}
+		defer auditLog.Close()
 	}
 
 	// Create agent configuration
@@ -77,6 +92,10 @@ func main() {
 		SystemPrompt:  appConfig.SystemPrompt,
 		MaxSteps:      appConfig.MaxSteps,
 		MessageWindow: appConfig.MessageWindow,
+		Registry:      registry,
+		AuditLog:      auditLog,
+		LoopThreshold: appConfig.LoopThreshold,
+		MaxLoops:      appConfig.MaxLoops,
 	}
 
 	// Create the agent
@@ -87,12 +106,20 @@ func main() {
 	}
 	defer mcpAgent.Close()
 
+	err = internalConfig.WatchMCPConfig(appConfig.McpConfigFile, func(config *internalConfig.Config) {
+		mcpAgent.ReloadTools(ctx, config)
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("MCP configuration hot reload is disabled")
+	}
+
 	sessionManager := sessions.New()
 	notificationServer := websocketServer.New()
 	handlers := httpHandlers.New(templates, sessionManager, notificationServer, mcpAgent)
+	adminHandlers := httpHandlers.NewAdmin(auditLog, mcpAgent, appConfig.AdminToken)
 
 	listener := createNetListener(appConfig)
-	server := startHttpServer(listener, handlers, notificationServer, appConfig.SimulatedDelay)
+	server := startHttpServer(listener, handlers, adminHandlers, notificationServer, appConfig.SimulatedDelay)
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
@@ -115,7 +142,56 @@ func main() {
 	log.Info().Msg("Application stopped")
 }
 
-func startHttpServer(listener net.Listener, handlers *httpHandlers.ChatHandlers,
+func createProviderConfig(appConfig *applicationConfig, mcpConfig *internalConfig.Config) *models.ProviderConfig {
+	profiles := make(map[string]models.ProviderProfile, len(mcpConfig.Providers))
+	for name, provider := range mcpConfig.Providers {
+		profiles[name] = models.ProviderProfile{
+			BaseURL:    provider.BaseURL,
+			Auth:       provider.Auth,
+			APIKey:     provider.APIKey,
+			APIVersion: provider.APIVersion,
+			Headers:    provider.Headers,
+		}
+	}
+
+	capabilities := make([]models.CapabilityRule, 0, len(mcpConfig.ModelCapabilities))
+	for _, capability := range mcpConfig.ModelCapabilities {
+		capabilities = append(capabilities, models.CapabilityRule{
+			Match: capability.Match,
+			Capabilities: models.Capabilities{
+				Tools:         capability.Tools,
+				Vision:        capability.Vision,
+				Audio:         capability.Audio,
+				ContextLength: capability.ContextLength,
+			},
+		})
+	}
+
+	return &models.ProviderConfig{
+		ModelString:     appConfig.ModelName,
+		SystemPrompt:    appConfig.SystemPrompt,
+		OllamaBaseURL:   mcpConfig.OllamaURL,
+		OllamaNumCtx:    mcpConfig.OllamaNumCtx,
+		OllamaKeepAlive: mcpConfig.OllamaKeepAlive,
+		OllamaOptions:   mcpConfig.OllamaOptions,
+
+		GoogleAPIKey:             mcpConfig.GoogleAPIKey,
+		GoogleBackend:            mcpConfig.GoogleBackend,
+		GoogleBaseURL:            mcpConfig.GoogleURL,
+		GoogleProject:            mcpConfig.GoogleProject,
+		GoogleLocation:           mcpConfig.GoogleLocation,
+		GoogleCredentialsFile:    mcpConfig.GoogleCredentialsFile,
+		GoogleResponseSchema:     mcpConfig.GoogleResponseSchema,
+		GoogleResponseSchemaFile: mcpConfig.GoogleResponseSchemaFile,
+		GoogleCodeExecution:      mcpConfig.GoogleCodeExecution,
+		GoogleSafetySettings:     mcpConfig.GoogleSafetySettings,
+
+		Profiles:     profiles,
+		Capabilities: capabilities,
+	}
+}
+
+func startHttpServer(listener net.Listener, handlers *httpHandlers.ChatHandlers, adminHandlers *httpHandlers.AdminHandlers,
 	notificationServer websocketServer.WebsocketServer,
 	simulatedDelay int) *http.Server {
 
@@ -146,9 +222,51 @@ func startHttpServer(listener net.Listener, handlers *httpHandlers.ChatHandlers,
 	router.Handle("POST /api/ask", web.Handler{Request: handlers.Ask,
 		SimulatedDelay: simulatedDelay})
 
+	router.Handle("POST /api/regenerate", web.Handler{Request: handlers.Regenerate,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("POST /api/edit", web.Handler{Request: handlers.EditMessage,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("POST /api/branch", web.Handler{Request: handlers.SelectBranch,
+		SimulatedDelay: simulatedDelay})
+
 	router.Handle("GET /api/main", web.Handler{Request: handlers.Main,
 		SimulatedDelay: simulatedDelay})
 
+	router.Handle("POST /api/elicitation", web.Handler{Request: handlers.AnswerElicitation,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("GET /api/trace", web.Handler{Request: handlers.Trace,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("GET /api/artifacts/{id}", web.Handler{Request: handlers.Artifact,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("GET /api/models", web.Handler{Request: handlers.Models,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("POST /api/model", web.Handler{Request: handlers.SelectModel,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("GET /api/mcp/servers", web.Handler{Request: handlers.McpServers,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("GET /api/admin/tool-audit", web.Handler{Request: adminHandlers.ToolAudit,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("GET /api/admin/metrics", web.Handler{Request: adminHandlers.Metrics,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("GET /api/mcp/resources", web.Handler{Request: handlers.McpResources,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("GET /api/mcp/prompts", web.Handler{Request: handlers.McpPrompts,
+		SimulatedDelay: simulatedDelay})
+
+	router.Handle("POST /api/mcp/prompt", web.Handler{Request: handlers.McpPrompt,
+		SimulatedDelay: simulatedDelay})
+
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, uiUrlPrefix, http.StatusPermanentRedirect)
 	})
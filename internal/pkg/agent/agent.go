@@ -1,16 +1,21 @@
 package agent
 
 import (
+	"ai-chat/internal/pkg/audit"
 	"ai-chat/internal/pkg/mcpConfig"
 	"ai-chat/internal/pkg/models"
+	"ai-chat/internal/pkg/policy"
 	"ai-chat/internal/pkg/tools"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
-	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // AgentConfig is the mcpConfig for agent.
@@ -20,29 +25,25 @@ type AgentConfig struct {
 	SystemPrompt  string
 	MaxSteps      int
 	MessageWindow int
+	Registry      *tools.Registry // Go tools offered next to the MCP tools, may be nil
+	AuditLog      *audit.Log      // records every tool invocation, may be nil
+	LoopThreshold int             // repetitions of a call or cycle of calls in a row that count as a loop, defaults to 3
+	MaxLoops      int             // loops in a turn before the agent stops calling tools and answers, 0 for no limit
 }
 
-// ToolCallHandler is a function type for handling tool calls as they happen
-type ToolCallHandler func(toolName, toolArgs string)
-
-// ToolExecutionHandler is a function type for handling tool execution start/end
-type ToolExecutionHandler func(toolName string, isStarting bool)
-
-// ToolResultHandler is a function type for handling tool results
-type ToolResultHandler func(toolName, toolArgs, result string, isError bool)
-
-// ResponseHandler is a function type for handling LLM responses
-type ResponseHandler func(content string)
-
-// ToolCallContentHandler is a function type for handling content that accompanies tool calls
-type ToolCallContentHandler func(content string)
-
 // Agent is the agent with real-time tool call display.
 type Agent struct {
-	toolManager  *tools.MCPToolManager
-	model        model.ToolCallingChatModel
-	maxSteps     int
-	systemPrompt string
+	toolManager   *tools.MCPToolManager
+	registry      *tools.Registry
+	auditLog      *audit.Log
+	toolPolicy    *atomic.Pointer[policy.Policy] // shared with the agents of other models, replaced on reload
+	model         model.ToolCallingChatModel
+	modelConfig   *models.ProviderConfig
+	capabilities  models.Capabilities
+	maxSteps      int
+	loopThreshold int
+	maxLoops      int
+	systemPrompt  string
 }
 
 // NewAgent creates an agent with MCP tool integration and real-time tool call display
@@ -53,8 +54,14 @@ func NewAgent(ctx context.Context, config *AgentConfig) (*Agent, error) {
 		return nil, fmt.Errorf("failed to create model provider: %v", err)
 	}
 
+	capabilities := discoverCapabilities(ctx, config.ModelConfig)
+
+	toolPolicy := &atomic.Pointer[policy.Policy]{}
+	toolPolicy.Store(policy.New(config.MCPConfig.ToolPolicy))
+
 	// Create and load MCP tools
 	toolManager := tools.NewMCPToolManager()
+	toolManager.SetPolicy(toolPolicy)
 	if err := toolManager.LoadTools(ctx, config.MCPConfig); err != nil {
 		return nil, fmt.Errorf("failed to load MCP tools: %v", err)
 	}
@@ -65,17 +72,57 @@ func NewAgent(ctx context.Context, config *AgentConfig) (*Agent, error) {
 	}
 
 	return &Agent{
-		toolManager:  toolManager,
-		model:        model,
-		maxSteps:     maxSteps,
-		systemPrompt: config.SystemPrompt,
+		toolManager:   toolManager,
+		registry:      config.Registry,
+		auditLog:      config.AuditLog,
+		toolPolicy:    toolPolicy,
+		model:         model,
+		modelConfig:   config.ModelConfig,
+		capabilities:  capabilities,
+		maxSteps:      maxSteps,
+		loopThreshold: config.LoopThreshold,
+		maxLoops:      config.MaxLoops,
+		systemPrompt:  config.SystemPrompt,
 	}, nil
 }
 
-// GenerateWithLoop processes messages with a custom loop that displays tool calls in real-time
-func (instance *Agent) GenerateWithLoop(ctx context.Context, messages []*schema.Message,
-	onToolCall ToolCallHandler, onToolExecution ToolExecutionHandler, onToolResult ToolResultHandler, onResponse ResponseHandler, onToolCallContent ToolCallContentHandler) (*schema.Message, error) {
+// WithModel returns an agent using another model that shares the tools of this agent,
+// the returned agent must not be closed as the tools are owned by this agent
+func (instance *Agent) WithModel(ctx context.Context, modelString string) (*Agent, error) {
+	modelConfig := *instance.modelConfig
+	modelConfig.ModelString = modelString
 
+	model, err := models.CreateProvider(ctx, &modelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create model provider: %v", err)
+	}
+
+	return &Agent{
+		toolManager:   instance.toolManager,
+		registry:      instance.registry,
+		auditLog:      instance.auditLog,
+		toolPolicy:    instance.toolPolicy,
+		model:         model,
+		modelConfig:   &modelConfig,
+		capabilities:  discoverCapabilities(ctx, &modelConfig),
+		maxSteps:      instance.maxSteps,
+		loopThreshold: instance.loopThreshold,
+		maxLoops:      instance.maxLoops,
+		systemPrompt:  instance.systemPrompt,
+	}, nil
+}
+
+// discoverCapabilities looks up the model capabilities and warns when tools will not be offered
+func discoverCapabilities(ctx context.Context, modelConfig *models.ProviderConfig) models.Capabilities {
+	capabilities := models.DiscoverCapabilities(ctx, modelConfig)
+	if !capabilities.SupportsTools() {
+		log.Warn().Str("model", modelConfig.ModelString).Msg("model does not support tool calling, tools are disabled")
+	}
+	return capabilities
+}
+
+// GenerateWithLoop processes messages with a custom loop, the progress of the turn is reported to the sink as it happens
+func (instance *Agent) GenerateWithLoop(ctx context.Context, messages []*schema.Message, sink EventSink) (*schema.Message, error) {
 	// Create a copy of messages to avoid modifying the original
 	workingMessages := make([]*schema.Message, len(messages))
 	copy(workingMessages, messages)
@@ -93,10 +140,18 @@ func (instance *Agent) GenerateWithLoop(ctx context.Context, messages []*schema.
 		}
 	}
 
-	// Get available tools
-	availableTools := instance.toolManager.GetTools()
+	// Get the tools the principal of the context may use, models without tool calling support get none
+	var availableTools []tool.BaseTool
+	if instance.capabilities.SupportsTools() {
+		for _, t := range instance.GetTools() {
+			if instance.toolAllowed(ctx, t) {
+				availableTools = append(availableTools, t)
+			}
+		}
+	}
 	var toolInfos []*schema.ToolInfo
 	toolMap := make(map[string]tool.BaseTool)
+	toolNames := make(map[string]string) // server__tool names the selection patterns match
 
 	for _, t := range availableTools {
 		info, err := t.Info(ctx)
@@ -105,98 +160,307 @@ func (instance *Agent) GenerateWithLoop(ctx context.Context, messages []*schema.
 		}
 		toolInfos = append(toolInfos, info)
 		toolMap[info.Name] = t
+		server, toolName := tools.Source(ctx, t)
+		toolNames[info.Name] = server + "__" + toolName
 	}
 
+	// Large tool sets are cut down to the tools relevant to the user's message, the model can search for the others
+	selection := tools.SelectTools(toolInfos, toolNames, lastUserText(workingMessages), usedTools(workingMessages),
+		instance.toolManager.Selection())
+
+	// A model repeating its tool calls gets a hint and is stopped after maxLoops of them
+	loops := newLoopDetector(instance.loopThreshold)
+	loopsDetected := 0
+
 	// Main loop
 	for step := 0; step < instance.maxSteps; step++ {
 		// Call the LLM
-		response, err := instance.model.Generate(ctx, workingMessages, model.WithTools(toolInfos))
+		emit(sink, Event{Type: EventStepStarted, Step: step})
+		response, err := instance.model.Generate(ctx, workingMessages, model.WithTools(selection.Offered()))
 		if err != nil {
+			emit(sink, Event{Type: EventError, Step: step, Error: err.Error()})
 			return nil, fmt.Errorf("failed to generate response: %v", err)
 		}
+		if response.ResponseMeta != nil && response.ResponseMeta.Usage != nil {
+			emit(sink, Event{Type: EventUsage, Step: step, Usage: response.ResponseMeta.Usage})
+		}
 
 		// Add response to working messages
 		workingMessages = append(workingMessages, response)
 
 		// Check if this is a tool call or final response
 		if len(response.ToolCalls) > 0 {
-			// Display any content that accompanies the tool calls
-			if response.Content != "" && onToolCallContent != nil {
-				onToolCallContent(response.Content)
+			// Report any content that accompanies the tool calls
+			if response.Content != "" {
+				emit(sink, Event{Type: EventContent, Step: step, Content: response.Content})
 			}
 
 			// Handle tool calls
+			var media []tools.MediaPart
+			var loop string
 			for _, toolCall := range response.ToolCalls {
-				// Notify about tool call
-				if onToolCall != nil {
-					onToolCall(toolCall.Function.Name, toolCall.Function.Arguments)
+				emit(sink, Event{Type: EventToolCall, Step: step, ToolCallID: toolCall.ID,
+					ToolName: toolCall.Function.Name, Arguments: toolCall.Function.Arguments})
+				if description := loops.record(toolCall.Function.Name, toolCall.Function.Arguments); description != "" {
+					loop = description
 				}
 
-				// Execute the tool
-				if selectedTool, exists := toolMap[toolCall.Function.Name]; exists {
-					// Notify tool execution start
-					if onToolExecution != nil {
-						onToolExecution(toolCall.Function.Name, true)
-					}
-
-					output, err := selectedTool.(tool.InvokableTool).InvokableRun(ctx, toolCall.Function.Arguments)
-
-					// Notify tool execution end
-					if onToolExecution != nil {
-						onToolExecution(toolCall.Function.Name, false)
-					}
-
-					if err != nil {
-						errorMsg := fmt.Sprintf("Tool execution error: %v", err)
-						toolMessage := schema.ToolMessage(errorMsg, toolCall.ID)
-						workingMessages = append(workingMessages, toolMessage)
-
-						if onToolResult != nil {
-							onToolResult(toolCall.Function.Name, toolCall.Function.Arguments, errorMsg, true)
-						}
-					} else {
-						// Check if this is an MCP tool response with an error
-						isError := false
-						if output != "" {
-							var mcpResult mcp.CallToolResult
-							if err := json.Unmarshal([]byte(output), &mcpResult); err == nil && mcpResult.IsError {
-								isError = true
-							}
-						}
-
-						toolMessage := schema.ToolMessage(output, toolCall.ID)
-						workingMessages = append(workingMessages, toolMessage)
-
-						if onToolResult != nil {
-							onToolResult(toolCall.Function.Name, toolCall.Function.Arguments, output, isError)
-						}
-					}
-				} else {
-					errorMsg := fmt.Sprintf("Tool not found: %s", toolCall.Function.Name)
-					toolMessage := schema.ToolMessage(errorMsg, toolCall.ID)
-					workingMessages = append(workingMessages, toolMessage)
-
-					if onToolResult != nil {
-						onToolResult(toolCall.Function.Name, toolCall.Function.Arguments, errorMsg, true)
-					}
+				result := instance.executeToolCall(ctx, toolCall, toolMap, selection, step, sink)
+				toolMessage := schema.ToolMessage(result.Text, toolCall.ID, schema.WithToolName(toolCall.Function.Name))
+				workingMessages = append(workingMessages, toolMessage)
+				media = append(media, result.Media...)
+			}
+
+			// Tool messages carry text only, media follows all of them in a message of its own
+			if mediaMessage := instance.mediaMessage(media); mediaMessage != nil {
+				workingMessages = append(workingMessages, mediaMessage)
+			}
+
+			if loop != "" {
+				loopsDetected++
+				log.Warn().Str("loop", loop).Int("step", step).Msg("repetitive tool calls detected")
+				if instance.maxLoops > 0 && loopsDetected >= instance.maxLoops {
+					return instance.summarize(ctx, workingMessages, selection.Offered(),
+						"The tool calls were stopped as they kept repeating: "+loop+".", step+1, sink)
 				}
+				workingMessages = append(workingMessages, loopHint(loop))
 			}
 		} else {
 			// This is a final response
-			if onResponse != nil && response.Content != "" {
-				onResponse(response.Content)
-			}
+			emit(sink, Event{Type: EventFinal, Step: step, Content: response.Content})
 			return response, nil
 		}
 	}
 
 	// If we reach here, we've exceeded max steps
-	return schema.AssistantMessage("Maximum number of steps reached.", nil), nil
+	return instance.summarize(ctx, workingMessages, selection.Offered(), "The maximum number of steps was reached.",
+		instance.maxSteps, sink)
+}
+
+// executeToolCall runs a tool call of the model and reports it, calls that cannot run are returned as error results.
+// The policy is checked again as it may have changed since the tools were offered
+func (instance *Agent) executeToolCall(ctx context.Context, toolCall schema.ToolCall, toolMap map[string]tool.BaseTool,
+	selection *tools.ToolSelection, step int, sink EventSink) *tools.ToolResult {
+
+	finished := Event{Type: EventToolFinished, Step: step, ToolCallID: toolCall.ID,
+		ToolName: toolCall.Function.Name, Arguments: toolCall.Function.Arguments}
+
+	selectedTool, exists := toolMap[toolCall.Function.Name]
+	var result *tools.ToolResult
+	switch {
+	case selection.IsSearch(toolCall.Function.Name):
+		text, isError := selection.Search(toolCall.Function.Arguments)
+		result = &tools.ToolResult{Text: text, IsError: isError}
+	case exists && !instance.toolAllowed(ctx, selectedTool):
+		errorMsg := fmt.Sprintf("Tool not allowed: %s", toolCall.Function.Name)
+		server, toolName := tools.Source(ctx, selectedTool)
+		instance.recordToolCall(ctx, server, toolName, toolCall.Function.Arguments, nil, errors.New(errorMsg), 0)
+		result = &tools.ToolResult{Text: errorMsg, IsError: true}
+	case exists:
+		emit(sink, Event{Type: EventToolStarted, Step: step, ToolCallID: toolCall.ID,
+			ToolName: toolCall.Function.Name, Arguments: toolCall.Function.Arguments})
+
+		started := time.Now()
+		var err error
+		result, err = runTool(ctx, selectedTool, toolCall.Function.Arguments)
+		duration := time.Since(started)
+		server, toolName := tools.Source(ctx, selectedTool)
+		instance.recordToolCall(ctx, server, toolName, toolCall.Function.Arguments, result, err, duration)
+		finished.Duration = duration.Milliseconds()
+
+		if err != nil {
+			result = &tools.ToolResult{Text: fmt.Sprintf("Tool execution error: %v", err), IsError: true}
+		}
+	default:
+		// Calls of tools the model made up are recorded under the server named by their prefix, if any
+		errorMsg := fmt.Sprintf("Tool not found: %s", toolCall.Function.Name)
+		server, toolName, found := strings.Cut(toolCall.Function.Name, "__")
+		if !found {
+			server, toolName = "", toolCall.Function.Name
+		}
+		instance.recordToolCall(ctx, server, toolName, toolCall.Function.Arguments, nil, errors.New(errorMsg), 0)
+		result = &tools.ToolResult{Text: errorMsg, IsError: true}
+	}
+
+	finished.Result = result.Text
+	finished.IsError = result.IsError
+	finished.Artifacts = result.Artifacts
+	emit(sink, finished)
+	return result
 }
 
-// GetTools returns the list of available tools
+// lastUserText returns the text of the latest user message, the query the tools are selected for
+func lastUserText(messages []*schema.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != schema.User {
+			continue
+		}
+		text := messages[i].Content
+		for _, part := range messages[i].MultiContent {
+			if part.Type == schema.ChatMessagePartTypeText {
+				text += " " + part.Text
+			}
+		}
+		return text
+	}
+	return ""
+}
+
+// usedTools returns the names of the tools called in the conversation, they stay offered on follow-up turns
+func usedTools(messages []*schema.Message) []string {
+	var names []string
+	for _, message := range messages {
+		for _, toolCall := range message.ToolCalls {
+			names = append(names, toolCall.Function.Name)
+		}
+	}
+	return names
+}
+
+// runTool runs a tool, tools returning rich results keep their media and artifacts
+func runTool(ctx context.Context, selectedTool tool.BaseTool, arguments string) (*tools.ToolResult, error) {
+	if resultTool, ok := selectedTool.(tools.ResultTool); ok {
+		return resultTool.RunWithResult(ctx, arguments)
+	}
+
+	invokableTool, ok := selectedTool.(tool.InvokableTool)
+	if !ok {
+		return nil, fmt.Errorf("tool is not invokable")
+	}
+	output, err := invokableTool.InvokableRun(ctx, arguments)
+	if err != nil {
+		return nil, err
+	}
+	return &tools.ToolResult{Text: output}, nil
+}
+
+// toolAllowed checks a tool against the policy for the principal of the context
+func (instance *Agent) toolAllowed(ctx context.Context, t tool.BaseTool) bool {
+	server, toolName := tools.Source(ctx, t)
+	return instance.toolPolicy.Load().Allowed(policy.PrincipalFromContext(ctx), server+"__"+toolName)
+}
+
+// recordToolCall writes a tool invocation to the audit log, the session and turn are taken from the context
+func (instance *Agent) recordToolCall(ctx context.Context, server string, toolName string, arguments string,
+	result *tools.ToolResult, err error, duration time.Duration) {
+
+	if instance.auditLog == nil {
+		return
+	}
+
+	sessionID, turn := audit.TurnFromContext(ctx)
+	record := audit.Record{
+		Time:      time.Now(),
+		SessionID: sessionID,
+		Turn:      turn,
+		Server:    server,
+		Tool:      toolName,
+		Arguments: arguments,
+		Duration:  duration.Milliseconds(),
+	}
+	if err != nil {
+		record.Result = err.Error()
+		record.IsError = true
+	} else {
+		record.Result = result.Text
+		record.IsError = result.IsError
+	}
+
+	if err := instance.auditLog.Append(record); err != nil {
+		log.Error().Err(err).Str("tool", toolName).Msg("failed to write the tool audit record")
+	}
+}
+
+// mediaMessage passes the images and audio returned by tools to a model that accepts them,
+// it returns nil when there is nothing the model can take
+func (instance *Agent) mediaMessage(media []tools.MediaPart) *schema.Message {
+	parts := []schema.ChatMessagePart{{Type: schema.ChatMessagePartTypeText, Text: "Media returned by the tools above:"}}
+	for _, part := range media {
+		dataURL := "data:" + part.MimeType + ";base64," + part.Data
+		switch {
+		case part.Type == tools.MediaImage && instance.capabilities.SupportsVision():
+			parts = append(parts, schema.ChatMessagePart{
+				Type:     schema.ChatMessagePartTypeImageURL,
+				ImageURL: &schema.ChatMessageImageURL{URL: dataURL, MIMEType: part.MimeType},
+			})
+		case part.Type == tools.MediaAudio && instance.capabilities.SupportsAudio():
+			parts = append(parts, schema.ChatMessagePart{
+				Type:     schema.ChatMessagePartTypeAudioURL,
+				AudioURL: &schema.ChatMessageAudioURL{URL: dataURL, MIMEType: part.MimeType},
+			})
+		}
+	}
+
+	if len(parts) == 1 {
+		return nil
+	}
+	return &schema.Message{Role: schema.User, MultiContent: parts}
+}
+
+// Artifact returns a binary tool output stored for display
+func (instance *Agent) Artifact(id string) (tools.Artifact, []byte, bool) {
+	return instance.toolManager.Artifact(id)
+}
+
+// GetTools returns the list of available tools, the Go tools of the registry followed by the MCP tools
 func (instance *Agent) GetTools() []tool.BaseTool {
-	return instance.toolManager.GetTools()
+	return append(instance.registry.Tools(), instance.toolManager.GetTools()...)
+}
+
+// ReloadTools applies a changed MCP configuration, turns in progress keep the tools they started with
+func (instance *Agent) ReloadTools(ctx context.Context, config *mcpConfig.Config) {
+	instance.toolManager.Reload(ctx, config)
+	instance.toolPolicy.Store(policy.New(config.ToolPolicy))
+}
+
+// Policy returns the tool policy, nil when every tool is allowed
+func (instance *Agent) Policy() *policy.Policy {
+	return instance.toolPolicy.Load()
+}
+
+// ListResources lists the resources offered by the MCP servers
+func (instance *Agent) ListResources(ctx context.Context) []tools.ResourceInfo {
+	return instance.toolManager.ListResources(ctx)
+}
+
+// ReadResource reads a resource of an MCP server as text
+func (instance *Agent) ReadResource(ctx context.Context, serverName string, uri string) (string, error) {
+	return instance.toolManager.ReadResource(ctx, serverName, uri)
+}
+
+// ListPrompts lists the prompt templates offered by the MCP servers
+func (instance *Agent) ListPrompts(ctx context.Context) []tools.PromptInfo {
+	return instance.toolManager.ListPrompts(ctx)
+}
+
+// GetPrompt expands a prompt template of an MCP server into text
+func (instance *Agent) GetPrompt(ctx context.Context, serverName string, name string, arguments map[string]string) (string, error) {
+	return instance.toolManager.GetPrompt(ctx, serverName, name, arguments)
+}
+
+// ToolCacheStats returns the hit and miss counts of the tool result cache
+func (instance *Agent) ToolCacheStats() tools.CacheStats {
+	return instance.toolManager.CacheStats()
+}
+
+// ServerStatuses returns the connection status of the MCP servers
+func (instance *Agent) ServerStatuses() []tools.ServerStatus {
+	return instance.toolManager.ServerStatuses()
+}
+
+// Model returns the provider:model string of the agent
+func (instance *Agent) Model() string {
+	return instance.modelConfig.ModelString
+}
+
+// ModelConfig returns the provider configuration of the agent
+func (instance *Agent) ModelConfig() *models.ProviderConfig {
+	return instance.modelConfig
+}
+
+// Capabilities returns the capabilities of the agent's model
+func (instance *Agent) Capabilities() models.Capabilities {
+	return instance.capabilities
 }
 
 // Close closes the agent and cleans up resources
@@ -0,0 +1,108 @@
+// Package agentTest provides agents answering with a local fake of an OpenAI compatible API for the tests of the
+// chat sessions and handlers
+package agentTest
+
+import (
+	"ai-chat/internal/pkg/agent"
+	"ai-chat/internal/pkg/mcpConfig"
+	"ai-chat/internal/pkg/models"
+	"ai-chat/internal/pkg/tools"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// NotePrefix starts the user messages the fake model answers by adding the rest of the message to the notes
+const NotePrefix = "note "
+
+// message is the part of a chat completion message the fake model reads
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// NewServer starts a local fake of the chat completions API. It calls the notes tool to add the rest of a last
+// user message starting with NotePrefix, answers "noted" after a tool result and "answer to <message>" otherwise.
+// When release is not nil, each completion waits for a value or for the channel to be closed.
+func NewServer(t *testing.T, release <-chan struct{}) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			http.NotFound(w, r)
+			return
+		}
+
+		var body struct {
+			Messages []message `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Messages) == 0 {
+			http.Error(w, "no messages", http.StatusBadRequest)
+			return
+		}
+
+		if release != nil {
+			<-release
+		}
+
+		last := body.Messages[len(body.Messages)-1]
+		answer := map[string]any{"role": "assistant", "content": "answer to " + last.Content}
+		finishReason := "stop"
+		switch {
+		case last.Role == "tool":
+			answer["content"] = "noted"
+		case strings.HasPrefix(last.Content, NotePrefix):
+			arguments, _ := json.Marshal(map[string]string{"action": "add", "text": strings.TrimPrefix(last.Content, NotePrefix)})
+			answer["content"] = ""
+			answer["tool_calls"] = []map[string]any{{
+				"id":       "call-1",
+				"type":     "function",
+				"function": map[string]any{"name": "notes", "arguments": string(arguments)},
+			}}
+			finishReason = "tool_calls"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion",
+			"model":   "model",
+			"choices": []map[string]any{{"index": 0, "message": answer, "finish_reason": finishReason}},
+			"usage":   map[string]int{"prompt_tokens": 1, "completion_tokens": 1, "total_tokens": 2},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// NewAgent creates an agent with the built-in tools using the model of a new fake server
+func NewAgent(t *testing.T, release <-chan struct{}) *agent.Agent {
+	t.Helper()
+
+	server := NewServer(t, release)
+	registry := tools.NewRegistry()
+	if err := tools.RegisterBuiltins(registry); err != nil {
+		t.Fatal(err)
+	}
+
+	testAgent, err := agent.NewAgent(context.Background(), &agent.AgentConfig{
+		ModelConfig: &models.ProviderConfig{
+			ModelString: "fake:model",
+			Profiles: map[string]models.ProviderProfile{
+				"fake": {BaseURL: server.URL + "/v1", Auth: models.ProfileAuthNone},
+			},
+		},
+		MCPConfig: &mcpConfig.Config{},
+		Registry:  registry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = testAgent.Close() })
+
+	return testAgent
+}
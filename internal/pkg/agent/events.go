@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"ai-chat/internal/pkg/tools"
+	"github.com/cloudwego/eino/schema"
+	"time"
+)
+
+// EventType is the kind of progress a turn of the agent reports
+type EventType string
+
+// Events of a turn, in the order they occur within a step
+const (
+	EventStepStarted  EventType = "step_started"  // the model is called
+	EventUsage        EventType = "usage"         // tokens used by the model call
+	EventContent      EventType = "content"       // text the model wrote along with tool calls
+	EventToolCall     EventType = "tool_call"     // the model requested a tool call
+	EventToolStarted  EventType = "tool_started"  // the tool is running
+	EventToolFinished EventType = "tool_finished" // the tool returned or the call was rejected
+	EventFinal        EventType = "final"         // the answer of the turn
+	EventError        EventType = "error"         // the turn failed
+)
+
+// Event is one step of the reasoning trace of a turn, fields not related to the type are empty
+type Event struct {
+	Type       EventType          `json:"type"`
+	Time       time.Time          `json:"time"`
+	Step       int                `json:"step"`
+	Content    string             `json:"content,omitempty"`
+	ToolCallID string             `json:"toolCallId,omitempty"`
+	ToolName   string             `json:"toolName,omitempty"`
+	Arguments  string             `json:"arguments,omitempty"`
+	Result     string             `json:"result,omitempty"`
+	IsError    bool               `json:"isError,omitempty"`
+	Artifacts  []tools.Artifact   `json:"artifacts,omitempty"`
+	Duration   int64              `json:"durationMs,omitempty"`
+	Usage      *schema.TokenUsage `json:"usage,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// EventSink receives the events of a turn as they happen, events are delivered from the turn's goroutine
+type EventSink interface {
+	OnEvent(event Event)
+}
+
+// EventSinkFunc adapts a function to an EventSink
+type EventSinkFunc func(event Event)
+
+// OnEvent calls the function
+func (f EventSinkFunc) OnEvent(event Event) {
+	f(event)
+}
+
+// emit stamps an event and delivers it, a nil sink drops it
+func emit(sink EventSink, event Event) {
+	if sink == nil {
+		return
+	}
+	event.Time = time.Now()
+	sink.OnEvent(event)
+}
@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"ai-chat/internal/pkg/audit"
+	"ai-chat/internal/pkg/policy"
+	"ai-chat/internal/pkg/tools"
+	"context"
+	"errors"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// scriptedModel returns its responses in order, the last one is repeated
+type scriptedModel struct {
+	responses []*schema.Message
+	err       error
+	calls     int
+	inputs    [][]*schema.Message  // messages of each call
+	tools     [][]*schema.ToolInfo // tools offered to each call
+}
+
+func (m *scriptedModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	m.inputs = append(m.inputs, input)
+	m.tools = append(m.tools, model.GetCommonOptions(&model.Options{}, opts...).Tools)
+	if m.err != nil {
+		return nil, m.err
+	}
+	response := m.responses[min(m.calls, len(m.responses)-1)]
+	m.calls++
+	return response, nil
+}
+
+func (m *scriptedModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return nil, errors.New("not supported")
+}
+
+func (m *scriptedModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+// testAgent returns an agent with the built-in tools answering with the scripted model
+func testAgent(t *testing.T, scripted *scriptedModel) *Agent {
+	t.Helper()
+
+	registry := tools.NewRegistry()
+	assert.NoError(t, tools.RegisterBuiltins(registry))
+	toolManager := tools.NewMCPToolManager()
+	t.Cleanup(func() { _ = toolManager.Close() })
+
+	return &Agent{
+		toolManager: toolManager,
+		registry:    registry,
+		toolPolicy:  &atomic.Pointer[policy.Policy]{},
+		model:       scripted,
+		maxSteps:    5,
+	}
+}
+
+func calculateCall(id string) schema.ToolCall {
+	return schema.ToolCall{ID: id, Function: schema.FunctionCall{Name: "calculate", Arguments: `{"expression":"6*7"}`}}
+}
+
+func eventTypes(events []Event) []EventType {
+	types := make([]EventType, len(events))
+	for index, event := range events {
+		types[index] = event.Type
+	}
+	return types
+}
+
+func TestGenerateWithLoopPositiveEvents(t *testing.T) {
+	usage := &schema.TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	instance := testAgent(t, &scriptedModel{responses: []*schema.Message{
+		{Role: schema.Assistant, Content: "Let me calculate.", ToolCalls: []schema.ToolCall{calculateCall("call-1")},
+			ResponseMeta: &schema.ResponseMeta{Usage: usage}},
+		schema.AssistantMessage("It is 42.", nil),
+	}})
+
+	var events []Event
+	response, err := instance.GenerateWithLoop(context.Background(), []*schema.Message{schema.UserMessage("6 times 7?")},
+		EventSinkFunc(func(event Event) { events = append(events, event) }))
+	assert.NoError(t, err)
+	assert.Equal(t, "It is 42.", response.Content)
+
+	assert.Equal(t, []EventType{EventStepStarted, EventUsage, EventContent, EventToolCall, EventToolStarted,
+		EventToolFinished, EventStepStarted, EventFinal}, eventTypes(events))
+	assert.Equal(t, usage, events[1].Usage)
+	assert.Equal(t, "Let me calculate.", events[2].Content)
+	assert.Equal(t, "call-1", events[5].ToolCallID)
+	assert.False(t, events[5].IsError)
+	assert.Contains(t, events[5].Result, "42")
+	assert.Equal(t, 1, events[7].Step)
+	assert.Equal(t, "It is 42.", events[7].Content)
+}
+
+func TestGenerateWithLoopNegativeEvents(t *testing.T) {
+	instance := testAgent(t, &scriptedModel{err: errors.New("model unavailable")})
+
+	var events []Event
+	_, err := instance.GenerateWithLoop(context.Background(), []*schema.Message{schema.UserMessage("Hi")},
+		EventSinkFunc(func(event Event) { events = append(events, event) }))
+	assert.Error(t, err)
+	assert.Equal(t, []EventType{EventStepStarted, EventError}, eventTypes(events))
+	assert.Equal(t, "model unavailable", events[1].Error)
+
+	// Unknown tools are reported as failed calls
+	instance = testAgent(t, &scriptedModel{responses: []*schema.Message{
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{ID: "call-1", Function: schema.FunctionCall{Name: "missing"}}}},
+		schema.AssistantMessage("Sorry.", nil),
+	}})
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = auditLog.Close() })
+	instance.auditLog = auditLog
+	events = nil
+	_, err = instance.GenerateWithLoop(context.Background(), []*schema.Message{schema.UserMessage("Hi")},
+		EventSinkFunc(func(event Event) { events = append(events, event) }))
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventStepStarted, EventToolCall, EventToolFinished, EventStepStarted, EventFinal}, eventTypes(events))
+	assert.True(t, events[2].IsError)
+	assert.Equal(t, "Tool not found: missing", events[2].Result)
+
+	// The call is audited like the calls of known tools
+	records, err := auditLog.Query(audit.Filter{Tool: "missing"})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.True(t, records[0].IsError)
+		assert.Equal(t, "Tool not found: missing", records[0].Result)
+	}
+}
+
+func TestGenerateWithLoopPositiveLoopSummary(t *testing.T) {
+	scripted := &scriptedModel{responses: []*schema.Message{
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{calculateCall("call-1")}},
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{calculateCall("call-2")}},
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{calculateCall("call-3")}},
+		schema.AssistantMessage("The result is 42.", nil),
+	}}
+	instance := testAgent(t, scripted)
+	instance.loopThreshold = 2
+	instance.maxLoops = 2
+
+	var final Event
+	response, err := instance.GenerateWithLoop(context.Background(), []*schema.Message{schema.UserMessage("6 times 7?")},
+		EventSinkFunc(func(event Event) {
+			if event.Type == EventFinal {
+				final = event
+			}
+		}))
+	assert.NoError(t, err)
+	assert.Equal(t, "The result is 42.", response.Content)
+	assert.Equal(t, "The result is 42.", final.Content)
+	assert.Equal(t, 3, final.Step)
+	assert.Equal(t, 4, scripted.calls)
+
+	// The hint and the summary request are user messages, the summary still gets the tool definitions
+	summaryInput := scripted.inputs[3]
+	assert.Equal(t, schema.User, summaryInput[len(summaryInput)-1].Role)
+	assert.Contains(t, summaryInput[len(summaryInput)-1].Content, "kept repeating")
+	hints := 0
+	for _, message := range summaryInput {
+		assert.NotEqual(t, schema.System, message.Role)
+		if message.Role == schema.User && strings.Contains(message.Content, "You are repeating tool calls") {
+			hints++
+		}
+	}
+	assert.Equal(t, 1, hints)
+	assert.NotEmpty(t, scripted.tools[3])
+	assert.Equal(t, scripted.tools[0], scripted.tools[3])
+}
+
+func TestGenerateWithLoopPositiveStepsExhausted(t *testing.T) {
+	scripted := &scriptedModel{responses: []*schema.Message{
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{calculateCall("call-1")}},
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{calculateCall("call-2")}},
+		{Role: schema.Assistant, Content: "So far it is 42.", ToolCalls: []schema.ToolCall{calculateCall("call-3")}},
+	}}
+	instance := testAgent(t, scripted)
+	instance.maxSteps = 2
+
+	var events []Event
+	response, err := instance.GenerateWithLoop(context.Background(), []*schema.Message{schema.UserMessage("6 times 7?")},
+		EventSinkFunc(func(event Event) { events = append(events, event) }))
+	assert.NoError(t, err)
+	assert.Equal(t, "So far it is 42.", response.Content)
+	assert.Empty(t, response.ToolCalls, "calls asked for in the summary are not run")
+	assert.Equal(t, 3, scripted.calls)
+	assert.Equal(t, EventFinal, events[len(events)-1].Type)
+	assert.Equal(t, 2, events[len(events)-1].Step)
+
+	// The history with the tool calls and results is sent with the tools it refers to
+	summaryInput := scripted.inputs[2]
+	assert.Equal(t, schema.Tool, summaryInput[len(summaryInput)-2].Role)
+	assert.Contains(t, summaryInput[len(summaryInput)-1].Content, "The maximum number of steps was reached.")
+	assert.NotEmpty(t, scripted.tools[2])
+}
+
+func TestGenerateWithLoopNegativeStepsExhausted(t *testing.T) {
+	scripted := &scriptedModel{responses: []*schema.Message{
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{calculateCall("call-1")}},
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{calculateCall("call-2")}},
+	}}
+	instance := testAgent(t, scripted)
+	instance.maxSteps = 1
+
+	// A summary without text falls back to the canned answer
+	response, err := instance.GenerateWithLoop(context.Background(), []*schema.Message{schema.UserMessage("6 times 7?")}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, stepsExhaustedText, response.Content)
+	assert.Empty(t, response.ToolCalls)
+	assert.Equal(t, 2, scripted.calls)
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/rs/zerolog/log"
+	"slices"
+	"strings"
+)
+
+const (
+	defaultLoopThreshold = 3
+	maxCyclePeriod       = 3 // longest sequence of different calls detected as a cycle
+	stepsExhaustedText   = "Maximum number of steps reached."
+)
+
+// toolCallSignature identifies a call by the tool and its arguments
+type toolCallSignature struct {
+	name      string
+	arguments string
+}
+
+// loopDetector spots a model repeating itself within a turn: the same call, or a sequence of up to
+// maxCyclePeriod calls, made threshold times back to back
+type loopDetector struct {
+	threshold int
+	calls     []toolCallSignature
+}
+
+func newLoopDetector(threshold int) *loopDetector {
+	if threshold <= 0 {
+		threshold = defaultLoopThreshold
+	}
+	return &loopDetector{threshold: threshold}
+}
+
+// record adds a call, it returns a description of the loop when the call completes one
+func (d *loopDetector) record(name, arguments string) string {
+	d.calls = append(d.calls, toolCallSignature{name: name, arguments: canonicalArguments(arguments)})
+
+	// Shorter periods are checked first, a call repeated over and over is not reported as a cycle of itself
+	for period := 1; period <= maxCyclePeriod && d.threshold*period <= len(d.calls); period++ {
+		recent := d.calls[len(d.calls)-d.threshold*period:]
+		cycle := recent[:period]
+		if !repeats(recent, cycle) {
+			continue
+		}
+		if period == 1 {
+			return fmt.Sprintf("%s was called %d times in a row with the same arguments", name, d.threshold)
+		}
+		names := make([]string, period)
+		for i, call := range cycle {
+			names[i] = call.name
+		}
+		return fmt.Sprintf("the calls %s were repeated %d times in a cycle with the same arguments",
+			strings.Join(names, ", "), d.threshold)
+	}
+	return ""
+}
+
+// repeats reports whether the calls are the cycle over and over
+func repeats(calls []toolCallSignature, cycle []toolCallSignature) bool {
+	for start := 0; start < len(calls); start += len(cycle) {
+		if !slices.Equal(calls[start:start+len(cycle)], cycle) {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalArguments normalizes JSON arguments so key order and spacing do not hide a repeated call
+func canonicalArguments(arguments string) string {
+	var value any
+	if err := json.Unmarshal([]byte(arguments), &value); err != nil {
+		return arguments
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return arguments
+	}
+	return string(canonical)
+}
+
+// loopHint is the note telling the model to stop repeating itself. It is sent as a user message, as providers
+// reject or ignore system messages in the middle of the conversation
+func loopHint(description string) *schema.Message {
+	return schema.UserMessage(fmt.Sprintf("You are repeating tool calls without making progress: %s. "+
+		"Do not make these calls again, try a different approach or answer with the information you have.", description))
+}
+
+// summarize asks the model to answer from what the turn gathered so far, the canned text is returned when that fails.
+// The offered tools are still passed, as providers reject a history with tool calls when no tools are defined,
+// but the calls the model asks for are not run
+func (instance *Agent) summarize(ctx context.Context, messages []*schema.Message, offered []*schema.ToolInfo,
+	reason string, step int, sink EventSink) (*schema.Message, error) {
+
+	messages = append(messages, schema.UserMessage(reason+" No more tools can be called. "+
+		"Summarize what you have found so far and answer the user's request as well as you can."))
+
+	emit(sink, Event{Type: EventStepStarted, Step: step})
+	response, err := instance.model.Generate(ctx, messages, model.WithTools(offered))
+	if err != nil {
+		log.Error().Err(err).Msg("final summary of the turn failed")
+		response = schema.AssistantMessage(stepsExhaustedText, nil)
+	} else {
+		if response.ResponseMeta != nil && response.ResponseMeta.Usage != nil {
+			emit(sink, Event{Type: EventUsage, Step: step, Usage: response.ResponseMeta.Usage})
+		}
+		if response.Content == "" {
+			log.Warn().Int("step", step).Int("toolCalls", len(response.ToolCalls)).Msg("final summary of the turn is empty")
+			response = schema.AssistantMessage(stepsExhaustedText, nil)
+		}
+	}
+	// Models may still ask for tools, they cannot be run any more
+	response.ToolCalls = nil
+
+	emit(sink, Event{Type: EventFinal, Step: step, Content: response.Content})
+	return response, nil
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLoopDetectorPositiveRepeatedCall(t *testing.T) {
+	loops := newLoopDetector(3)
+
+	assert.Empty(t, loops.record("files__read", `{"path":"a.txt"}`))
+	assert.Empty(t, loops.record("files__read", `{"path":"b.txt"}`))
+	assert.Empty(t, loops.record("files__read", `{ "path": "b.txt" }`))
+	assert.Equal(t, "files__read was called 3 times in a row with the same arguments", loops.record("files__read", `{"path":"b.txt"}`))
+}
+
+func TestLoopDetectorPositiveCycle(t *testing.T) {
+	loops := newLoopDetector(3)
+
+	for range 2 {
+		assert.Empty(t, loops.record("search", `{"q":"x"}`))
+		assert.Empty(t, loops.record("fetch", `{"id":1}`))
+	}
+	assert.Empty(t, loops.record("search", `{"q":"x"}`))
+	assert.Equal(t, "the calls search, fetch were repeated 3 times in a cycle with the same arguments", loops.record("fetch", `{"id":1}`))
+}
+
+func TestLoopDetectorNegative(t *testing.T) {
+	loops := newLoopDetector(0)
+
+	for _, arguments := range []string{`{"q":"a"}`, `{"q":"b"}`, `{"q":"c"}`, `{"q":"a"}`, `{"q":"b"}`, `{"q":"d"}`} {
+		assert.Empty(t, loops.record("search", arguments))
+	}
+
+	// Calls made again with others in between are not a loop
+	loops = newLoopDetector(3)
+	for _, arguments := range []string{`{"q":"a"}`, `{"q":"a"}`, `{"q":"b"}`, `{"q":"a"}`, `{"q":"a"}`} {
+		assert.Empty(t, loops.record("search", arguments))
+	}
+}
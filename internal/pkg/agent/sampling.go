@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Sample answers an MCP sampling request with the agent's model, tools are not offered to the model
+func (instance *Agent) Sample(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	messages := make([]*schema.Message, 0, len(request.Messages)+1)
+	if request.SystemPrompt != "" {
+		messages = append(messages, schema.SystemMessage(request.SystemPrompt))
+	}
+	for _, samplingMessage := range request.Messages {
+		text, err := samplingText(samplingMessage.Content)
+		if err != nil {
+			return nil, err
+		}
+		if samplingMessage.Role == mcp.RoleAssistant {
+			messages = append(messages, schema.AssistantMessage(text, nil))
+		} else {
+			messages = append(messages, schema.UserMessage(text))
+		}
+	}
+
+	options := []model.Option{model.WithMaxTokens(request.MaxTokens)}
+	if request.Temperature > 0 {
+		options = append(options, model.WithTemperature(float32(request.Temperature)))
+	}
+	if len(request.StopSequences) > 0 {
+		options = append(options, model.WithStop(request.StopSequences))
+	}
+
+	response, err := instance.model.Generate(ctx, messages, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate sampling response: %v", err)
+	}
+
+	stopReason := "endTurn"
+	if response.ResponseMeta != nil && response.ResponseMeta.FinishReason == "length" {
+		stopReason = "maxTokens"
+	}
+
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{
+			Role:    mcp.RoleAssistant,
+			Content: mcp.NewTextContent(response.Content),
+		},
+		Model:      instance.Model(),
+		StopReason: stopReason,
+	}, nil
+}
+
+// samplingText returns the text of sampling message content, which arrives decoded as a generic map
+func samplingText(content any) (string, error) {
+	if contentMap, ok := content.(map[string]any); ok {
+		parsed, err := mcp.ParseContent(contentMap)
+		if err != nil {
+			return "", fmt.Errorf("invalid sampling message content: %v", err)
+		}
+		content = parsed
+	}
+
+	switch content := content.(type) {
+	case mcp.TextContent:
+		return content.Text, nil
+	case *mcp.TextContent:
+		return content.Text, nil
+	default:
+		return "", fmt.Errorf("unsupported sampling message content %T, only text is supported", content)
+	}
+}
@@ -0,0 +1,207 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxValueLength = 2000 // characters of arguments and results kept in a record
+	defaultLimit   = 100
+	maxLineLength  = 1 << 20
+)
+
+// secretKeys matches argument names whose values are not written to the log, the words must be whole parts of
+// the name so max_tokens or bypass are kept. camelCase names are split into parts by wordBoundary first
+var (
+	secretKeys   = regexp.MustCompile(`(?i)(^|[_-])(password|passwd|secret|token|api[-_]?key|authorization|credentials?)($|[_-])`)
+	wordBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+)
+
+// Record describes one tool invocation
+type Record struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"sessionId,omitempty"`
+	Turn      int       `json:"turn,omitempty"` // counts the turns run in the session, a regenerated turn gets a new number
+	Server    string    `json:"server"`         // MCP server, REST service or "builtin"
+	Tool      string    `json:"tool"`           // name of the tool on its server
+	Arguments string    `json:"arguments"`
+	Result    string    `json:"result"`
+	Duration  int64     `json:"durationMs"`
+	IsError   bool      `json:"isError"`
+}
+
+// Filter selects records, zero values match everything
+type Filter struct {
+	SessionID string
+	Tool      string // matches the tool name with or without the server prefix
+	From      time.Time
+	To        time.Time
+	Limit     int // newest records returned, defaults to 100
+}
+
+// Log is an append-only JSONL file of tool invocations
+type Log struct {
+	mutex sync.Mutex // serializes writes
+	path  string
+	file  *os.File
+}
+
+// Open opens or creates the log file and its directory
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{path: path, file: file}, nil
+}
+
+// Append redacts and truncates the record and writes it as one line
+func (l *Log) Append(record Record) error {
+	record.Arguments = truncate(Redact(record.Arguments))
+	record.Result = truncate(record.Result)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Query returns the newest records matching the filter, newest first
+func (l *Log) Query(filter Filter) ([]Record, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	// The file is read through its own handle, so appends go on while it is scanned. A line being written
+	// is incomplete and skipped
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if filter.matches(record) {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	if len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
+
+func (f Filter) matches(record Record) bool {
+	if f.SessionID != "" && record.SessionID != f.SessionID {
+		return false
+	}
+	if f.Tool != "" && record.Tool != f.Tool && record.Server+"__"+record.Tool != f.Tool {
+		return false
+	}
+	if !f.From.IsZero() && record.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && record.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.file.Close()
+}
+
+// Redact replaces the values of arguments named like secrets, arguments that are not a JSON object are kept
+func Redact(arguments string) string {
+	var value any
+	if err := json.Unmarshal([]byte(arguments), &value); err != nil {
+		return arguments
+	}
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return arguments
+	}
+	return string(redacted)
+}
+
+func redactValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, nested := range value {
+			if secretKeys.MatchString(wordBoundary.ReplaceAllString(key, "${1}_${2}")) {
+				value[key] = "[redacted]"
+			} else {
+				value[key] = redactValue(nested)
+			}
+		}
+	case []any:
+		for index, nested := range value {
+			value[index] = redactValue(nested)
+		}
+	}
+	return value
+}
+
+func truncate(text string) string {
+	if utf8.RuneCountInString(text) <= maxValueLength {
+		return text
+	}
+	return string([]rune(text)[:maxValueLength]) + "…"
+}
+
+type turnKey struct{}
+
+type turn struct {
+	sessionID string
+	number    int
+}
+
+// WithTurn returns a context whose tool calls are recorded for the given session and turn
+func WithTurn(ctx context.Context, sessionID string, number int) context.Context {
+	return context.WithValue(ctx, turnKey{}, turn{sessionID: sessionID, number: number})
+}
+
+// TurnFromContext returns the session and turn set by WithTurn
+func TurnFromContext(ctx context.Context) (string, int) {
+	current, _ := ctx.Value(turnKey{}).(turn)
+	return current.sessionID, current.number
+}
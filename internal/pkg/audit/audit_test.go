@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openLog opens a log in a temporary directory that does not exist yet
+func openLog(t *testing.T) *Log {
+	t.Helper()
+
+	auditLog, err := Open(filepath.Join(t.TempDir(), "logs", "audit.jsonl"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = auditLog.Close() })
+	return auditLog
+}
+
+func TestQueryPositive(t *testing.T) {
+	auditLog := openLog(t)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for index, record := range []Record{
+		{SessionID: "a", Server: "files", Tool: "read"},
+		{SessionID: "b", Server: "files", Tool: "write"},
+		{SessionID: "a", Server: "builtin", Tool: "calculate"},
+		{SessionID: "a", Server: "files", Tool: "read", IsError: true},
+	} {
+		record.Time = start.Add(time.Duration(index) * time.Minute)
+		assert.NoError(t, auditLog.Append(record))
+	}
+
+	records, err := auditLog.Query(Filter{SessionID: "a"})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 3) {
+		assert.True(t, records[0].IsError, "newest first")
+	}
+
+	records, err = auditLog.Query(Filter{Tool: "files__read", Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	records, err = auditLog.Query(Filter{From: start.Add(time.Minute), To: start.Add(2 * time.Minute)})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "calculate", records[0].Tool)
+		assert.Equal(t, "write", records[1].Tool)
+	}
+}
+
+func TestAppendPositiveRedactsAndTruncates(t *testing.T) {
+	auditLog := openLog(t)
+
+	assert.NoError(t, auditLog.Append(Record{
+		Tool:      "login",
+		Arguments: `{"user":"ricky","password":"hunter2","options":[{"apiKey":"abc"}]}`,
+		Result:    strings.Repeat("x", 3000),
+	}))
+
+	records, err := auditLog.Query(Filter{})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.JSONEq(t, `{"user":"ricky","password":"[redacted]","options":[{"apiKey":"[redacted]"}]}`, records[0].Arguments)
+		assert.Equal(t, maxValueLength+1, len([]rune(records[0].Result)))
+	}
+}
+
+func TestRedactPositiveNames(t *testing.T) {
+	redacted := Redact(`{"accessToken":"a","api_key":"b","X-Api-Key":"c","client_secret":"d","credentials":"e",` +
+		`"passwd":"f","max_tokens":1,"maxTokens":2,"compass":"g","bypass":"h","tokenizer":"i"}`)
+	assert.JSONEq(t, `{"accessToken":"[redacted]","api_key":"[redacted]","X-Api-Key":"[redacted]",`+
+		`"client_secret":"[redacted]","credentials":"[redacted]","passwd":"[redacted]",`+
+		`"max_tokens":1,"maxTokens":2,"compass":"g","bypass":"h","tokenizer":"i"}`, redacted)
+}
+
+func TestQueryPositiveWhileAppending(t *testing.T) {
+	auditLog := openLog(t)
+
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		for range 50 {
+			assert.NoError(t, auditLog.Append(Record{Tool: "read"}))
+		}
+	}()
+	for range 10 {
+		_, err := auditLog.Query(Filter{})
+		assert.NoError(t, err)
+	}
+	waitGroup.Wait()
+
+	records, err := auditLog.Query(Filter{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 50)
+}
+
+func TestRedactNegativeNotJSON(t *testing.T) {
+	assert.Equal(t, "token=abc", Redact("token=abc"))
+}
+
+func TestQueryNegativeNoMatch(t *testing.T) {
+	auditLog := openLog(t)
+	assert.NoError(t, auditLog.Append(Record{SessionID: "a", Tool: "read"}))
+
+	records, err := auditLog.Query(Filter{SessionID: "b"})
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestTurnFromContextPositive(t *testing.T) {
+	sessionID, turn := TurnFromContext(WithTurn(context.Background(), "session", 3))
+	assert.Equal(t, "session", sessionID)
+	assert.Equal(t, 3, turn)
+
+	sessionID, turn = TurnFromContext(context.Background())
+	assert.Empty(t, sessionID)
+	assert.Zero(t, turn)
+}
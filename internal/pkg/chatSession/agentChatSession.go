@@ -2,49 +2,62 @@ package chatSession
 
 import (
 	"ai-chat/internal/pkg/agent"
+	"ai-chat/internal/pkg/audit"
+	"ai-chat/internal/pkg/policy"
+	"ai-chat/internal/pkg/tools"
 	"context"
-	"github.com/cloudwego/eino/schema"
+	"errors"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/rs/zerolog/log"
 	"sync"
 )
 
 // AgentChatSession is an implementation of the ChatSession interface that uses agent.Agent
 type AgentChatSession struct {
-	agent            *agent.Agent
-	messages         []*schema.Message
-	chatBlocks       []ChatBlock
-	responseFunc     ChatBlockResponseFunc
-	messagesMutex    sync.RWMutex
-	processingMutex  sync.Mutex
-	currentChatBlock *ChatBlock
-	exitRequested    chan struct{}
+	id              string
+	agent           *agent.Agent
+	conversation    *turn // root of the conversation tree, it has no message of its own
+	responseFunc    ChatBlockResponseFunc
+	messagesMutex   sync.RWMutex
+	processingMutex sync.Mutex
+	currentTurn     *turn // the running turn, or the one run last, elicitations are shown with it
+	exitRequested   chan struct{}
+	elicitations    map[string]*pendingElicitation
+	scratchpad      *tools.Scratchpad // notes taken by the model on the turns leading to the running one
+	turns           int               // turns run so far, numbers them in the audit log
+	running         int               // turns sent that did not end yet, the branches are only changed while none is
+}
+
+// pendingElicitation is an elicitation waiting for the user's answer
+type pendingElicitation struct {
+	elicitation *Elicitation
+	answer      chan *mcp.ElicitationResult
 }
 
 // NewAgentChatSession creates a new AgentChatSession
-func NewAgentChatSession(agent *agent.Agent, responseFunc ChatBlockResponseFunc) (ChatSession, error) {
+func NewAgentChatSession(id string, agent *agent.Agent, responseFunc ChatBlockResponseFunc) (ChatSession, error) {
 	return &AgentChatSession{
+		id:            id,
 		agent:         agent,
-		messages:      []*schema.Message{},
-		chatBlocks:    []ChatBlock{},
+		conversation:  &turn{},
 		responseFunc:  responseFunc,
 		messagesMutex: sync.RWMutex{},
 		exitRequested: make(chan struct{}, 1),
+		elicitations:  make(map[string]*pendingElicitation),
+		scratchpad:    tools.NewScratchpad(),
 	}, nil
 }
 
-// EnqueueMessage adds a user message to the chat session and processes it
-func (instance *AgentChatSession) EnqueueMessage(message string) error {
-	// Create a new chat block for this message
-	chatBlock := ChatBlock{
-		UserMessage: message,
-		Completed:   false,
-		Failed:      false,
-	}
+// EnqueueMessage adds a user message to the chat session and processes it with the tools the principal may use
+func (instance *AgentChatSession) EnqueueMessage(principal policy.Principal, message string, attachments ...Attachment) error {
+	// Create a new turn for this message, it continues the selected branch of the conversation
+	currentTurn := newTurn(message, attachments)
 
-	// Add the chat block to the list
 	instance.messagesMutex.Lock()
-	instance.chatBlocks = append(instance.chatBlocks, chatBlock)
-	instance.currentChatBlock = &instance.chatBlocks[len(instance.chatBlocks)-1]
+	instance.conversation.leaf().addChild(currentTurn)
+	instance.running++
+	chatBlock := currentTurn.chatBlock()
 	instance.messagesMutex.Unlock()
 
 	// Send initial UI update with user message
@@ -53,109 +66,211 @@ func (instance *AgentChatSession) EnqueueMessage(message string) error {
 		New:       true,
 	})
 
-	// Add user message to the messages list
-	userMessage := schema.UserMessage(message)
-	instance.messagesMutex.Lock()
-	instance.messages = append(instance.messages, userMessage)
-	instance.messagesMutex.Unlock()
-
 	// Process the message with the agent in instance goroutine
-	go instance.processMessage()
+	go instance.processMessage(principal, currentTurn)
 
 	return nil
 }
 
-// processMessage processes the current message with the agent
-func (instance *AgentChatSession) processMessage() {
+// processMessage processes a turn with the agent, the model gets the messages of the turns leading to it
+func (instance *AgentChatSession) processMessage(principal policy.Principal, currentTurn *turn) {
 	// Ensure only one message is processed at a time
 	instance.processingMutex.Lock()
 	defer instance.processingMutex.Unlock()
 
 	// Create a copy of messages to avoid race conditions
-	instance.messagesMutex.RLock()
-	messagesCopy := make([]*schema.Message, len(instance.messages))
-	copy(messagesCopy, instance.messages)
-	currentChatBlock := instance.currentChatBlock
-	instance.messagesMutex.RUnlock()
+	instance.messagesMutex.Lock()
+	messagesCopy := currentTurn.history()
+	currentChatBlock := &currentTurn.block
+	sessionAgent := instance.agent
+	// Set when the turn starts, a message sent meanwhile waits and must not get the questions of this turn
+	instance.currentTurn = currentTurn
+	instance.turns++
+	turnNumber := instance.turns
+	// The turn starts with the notes of the turn it continues, not of the turns of other branches
+	instance.scratchpad.Replace(currentTurn.parent.notes)
+	instance.messagesMutex.Unlock()
 
-	// Call the agent
-	ctx := context.Background()
-	response, err := instance.agent.GenerateWithLoop(ctx, messagesCopy,
-		// Tool call handler
-		func(toolName, toolArgs string) {
-			log.Info().Str("tool", toolName).Str("args", toolArgs).Msg("Tool call")
-		},
-		// Tool execution handler
-		func(toolName string, isStarting bool) {
-			if isStarting {
-				log.Info().Str("tool", toolName).Msg("Tool execution started")
-			} else {
-				log.Info().Str("tool", toolName).Msg("Tool execution completed")
-			}
-		},
-		// Tool result handler
-		func(toolName, toolArgs, result string, isError bool) {
-			if isError {
-				log.Error().Str("tool", toolName).Str("result", result).Msg("Tool error")
-			} else {
-				log.Info().Str("tool", toolName).Str("result", result).Msg("Tool result")
-			}
-		},
-		// Response handler
-		func(content string) {
-			// Update the chat block with the assistant's response
-			instance.messagesMutex.Lock()
-			// If there's already content (from tool call), append the new content instead of overwriting
-			if currentChatBlock.AssistantMessage != "" {
-				//if currentChatBlock.AssistantMessage != "" && currentChatBlock.AssistantMessage != content {
-				currentChatBlock.AssistantMessage = currentChatBlock.AssistantMessage + content
-				//currentChatBlock.AssistantMessage = currentChatBlock.AssistantMessage + "\n\n---\n\n" + content
-			} else {
-				currentChatBlock.AssistantMessage = content
-			}
-			currentChatBlock.Completed = true
-			instance.messagesMutex.Unlock()
+	// The notes the turn leaves are the ones the turns continuing from it start with
+	defer func() {
+		instance.messagesMutex.Lock()
+		currentTurn.notes = instance.scratchpad.Notes()
+		instance.running--
+		instance.messagesMutex.Unlock()
+	}()
 
-			// Send UI update
-			instance.responseFunc(ChatBlockResponse{
-				ChatBlock: *currentChatBlock,
-				New:       false,
-			})
-		},
-		// Tool call content handler
-		func(content string) {
-			// Update the chat block with intermediate content
-			instance.messagesMutex.Lock()
-			currentChatBlock.AssistantMessage = content
-			instance.messagesMutex.Unlock()
-
-			// Send UI update
-			instance.responseFunc(ChatBlockResponse{
-				ChatBlock: *currentChatBlock,
-				New:       false,
-			})
-		},
-	)
+	// Call the agent, MCP servers reach the session through the context while their tools run
+	ctx := tools.WithHost(context.Background(), instance)
+	ctx = tools.WithScratchpad(ctx, instance.scratchpad)
+	ctx = tools.WithSession(ctx, instance.id)
+	ctx = audit.WithTurn(ctx, instance.id, turnNumber)
+	ctx = policy.WithPrincipal(ctx, principal)
+	response, err := sessionAgent.GenerateWithLoop(ctx, messagesCopy, instance.eventSink(currentTurn))
 
 	if err != nil {
 		log.Error().Err(err).Msg("Agent.GenerateWithLoop failed")
 		instance.messagesMutex.Lock()
 		currentChatBlock.Failed = true
 		currentChatBlock.AssistantMessage = "Error: " + err.Error()
+		chatBlock := currentTurn.chatBlock()
 		instance.messagesMutex.Unlock()
 
 		// Send UI update with error
 		instance.responseFunc(ChatBlockResponse{
-			ChatBlock: *currentChatBlock,
+			ChatBlock: chatBlock,
 			New:       false,
 		})
 		return
 	}
 
-	// Add assistant response to messages
+	// Add assistant response to the messages of the turn
+	instance.messagesMutex.Lock()
+	currentTurn.messages = append(currentTurn.messages, response)
+	instance.messagesMutex.Unlock()
+}
+
+// Regenerate runs the last turn again with the same user message, the new answer is added as an alternative
+func (instance *AgentChatSession) Regenerate(principal policy.Principal) error {
+	instance.messagesMutex.RLock()
+	index := len(instance.conversation.path()) - 1
+	message := ""
+	if index >= 0 {
+		message = instance.conversation.leaf().block.UserMessage
+	}
+	instance.messagesMutex.RUnlock()
+
+	if index < 0 {
+		return errors.New("there is no answer to regenerate")
+	}
+	return instance.branchTurn(principal, index, message)
+}
+
+// EditMessage runs a turn again with another user message, the conversation continues on a new branch from it
+func (instance *AgentChatSession) EditMessage(principal policy.Principal, index int, message string) error {
+	if message == "" {
+		return errors.New("the message is empty")
+	}
+	return instance.branchTurn(principal, index, message)
+}
+
+// branchTurn adds a sibling to the turn at index of the selected path with the message and the attachments
+// the turn was sent with, selects and runs it, and pushes the whole conversation to the UI
+func (instance *AgentChatSession) branchTurn(principal policy.Principal, index int, message string) error {
 	instance.messagesMutex.Lock()
-	instance.messages = append(instance.messages, response)
+	// Branches are only added while no turn runs or waits to, the UI would show the turn in the wrong place
+	if instance.running > 0 {
+		instance.messagesMutex.Unlock()
+		return ErrTurnRunning
+	}
+	path := instance.conversation.path()
+	if index < 0 || index >= len(path) {
+		instance.messagesMutex.Unlock()
+		return fmt.Errorf("there is no message %d", index)
+	}
+
+	currentTurn := newTurn(message, path[index].attachments)
+	path[index].parent.addChild(currentTurn)
+	// The turn counts as running before it is started, so no other branch is added or selected in the meantime
+	instance.running++
+	chatBlocks := instance.chatBlocks()
 	instance.messagesMutex.Unlock()
+
+	// Send UI update replacing the shown conversation
+	instance.responseFunc(ChatBlockResponse{
+		ChatBlock:  chatBlocks[index],
+		ChatBlocks: chatBlocks,
+	})
+
+	go instance.processMessage(principal, currentTurn)
+
+	return nil
+}
+
+// SelectBranch switches the turn at index of the selected path to another alternative,
+// the conversation shown and continued is the one following the branch
+func (instance *AgentChatSession) SelectBranch(index int, branch int) error {
+	instance.messagesMutex.Lock()
+	if instance.running > 0 {
+		instance.messagesMutex.Unlock()
+		return ErrTurnRunning
+	}
+	path := instance.conversation.path()
+	if index < 0 || index >= len(path) {
+		instance.messagesMutex.Unlock()
+		return fmt.Errorf("there is no message %d", index)
+	}
+	parent := path[index].parent
+	if branch < 0 || branch >= len(parent.children) {
+		instance.messagesMutex.Unlock()
+		return fmt.Errorf("message %d has no branch %d", index, branch)
+	}
+
+	parent.selected = branch
+	chatBlocks := instance.chatBlocks()
+	instance.messagesMutex.Unlock()
+
+	// Send UI update replacing the shown conversation
+	instance.responseFunc(ChatBlockResponse{
+		ChatBlock:  chatBlocks[len(chatBlocks)-1],
+		ChatBlocks: chatBlocks,
+	})
+
+	return nil
+}
+
+// chatBlocks returns copies of the chat blocks of the selected path, the caller holds the messages mutex
+func (instance *AgentChatSession) chatBlocks() []ChatBlock {
+	path := instance.conversation.path()
+	chatBlocks := make([]ChatBlock, len(path))
+	for index, pathTurn := range path {
+		chatBlocks[index] = pathTurn.chatBlock()
+	}
+	return chatBlocks
+}
+
+// eventSink persists the events of a turn into its chat block and updates the UI as the turn progresses,
+// the pushed chat blocks keep the branch controls of a regenerated or edited turn
+func (instance *AgentChatSession) eventSink(currentTurn *turn) agent.EventSink {
+	currentChatBlock := &currentTurn.block
+	return agent.EventSinkFunc(func(event agent.Event) {
+		switch event.Type {
+		case agent.EventToolCall:
+			log.Info().Str("tool", event.ToolName).Str("args", event.Arguments).Msg("Tool call")
+		case agent.EventToolStarted:
+			log.Info().Str("tool", event.ToolName).Msg("Tool execution started")
+		case agent.EventToolFinished:
+			if event.IsError {
+				log.Error().Str("tool", event.ToolName).Str("result", event.Result).Msg("Tool error")
+			} else {
+				log.Info().Str("tool", event.ToolName).Str("result", event.Result).Msg("Tool result")
+			}
+		}
+
+		instance.messagesMutex.Lock()
+		currentChatBlock.Events = append(currentChatBlock.Events, event)
+		switch event.Type {
+		case agent.EventContent:
+			// Intermediate content written along with tool calls
+			currentChatBlock.AssistantMessage = event.Content
+		case agent.EventToolFinished:
+			// Show binary outputs such as images with the chat block
+			currentChatBlock.Artifacts = append(currentChatBlock.Artifacts, event.Artifacts...)
+		case agent.EventFinal:
+			// If there's already content (from tool call), append the new content instead of overwriting
+			currentChatBlock.AssistantMessage = currentChatBlock.AssistantMessage + event.Content
+			currentChatBlock.Completed = true
+		}
+		chatBlock := currentTurn.chatBlock()
+		instance.messagesMutex.Unlock()
+
+		// Send UI update, steps and usage change nothing that is shown
+		if event.Type != agent.EventStepStarted && event.Type != agent.EventUsage {
+			instance.responseFunc(ChatBlockResponse{
+				ChatBlock: chatBlock,
+				New:       false,
+			})
+		}
+	})
 }
 
 // Shutdown stops the chat session
@@ -168,14 +283,120 @@ func (instance *AgentChatSession) Shutdown() {
 	}
 }
 
-// ChatBlocks returns the chat blocks
+// ChatBlocks returns the chat blocks of the selected branches of the conversation
 func (instance *AgentChatSession) ChatBlocks() []ChatBlock {
 	instance.messagesMutex.RLock()
 	defer instance.messagesMutex.RUnlock()
 
 	// Create a copy of the chat blocks to avoid race conditions
-	chatBlocks := make([]ChatBlock, len(instance.chatBlocks))
-	copy(chatBlocks, instance.chatBlocks)
+	return instance.chatBlocks()
+}
 
-	return chatBlocks
+// Model returns the provider:model string used by the session
+func (instance *AgentChatSession) Model() string {
+	instance.messagesMutex.RLock()
+	defer instance.messagesMutex.RUnlock()
+
+	return instance.agent.Model()
+}
+
+// SetModel switches the session to another model, the conversation history is kept
+func (instance *AgentChatSession) SetModel(modelString string) error {
+	instance.messagesMutex.RLock()
+	currentAgent := instance.agent
+	instance.messagesMutex.RUnlock()
+
+	if currentAgent.Model() == modelString {
+		return nil
+	}
+
+	sessionAgent, err := currentAgent.WithModel(context.Background(), modelString)
+	if err != nil {
+		return err
+	}
+
+	instance.messagesMutex.Lock()
+	instance.agent = sessionAgent
+	instance.messagesMutex.Unlock()
+
+	return nil
+}
+
+// CreateMessage answers a sampling request of an MCP server with the session's model
+func (instance *AgentChatSession) CreateMessage(ctx context.Context, serverName string, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	instance.messagesMutex.RLock()
+	sessionAgent := instance.agent
+	instance.messagesMutex.RUnlock()
+
+	return sessionAgent.Sample(ctx, request)
+}
+
+// Elicit shows the question of an MCP server with the current chat block and waits for the user's answer,
+// the request is cancelled when the server stops waiting
+func (instance *AgentChatSession) Elicit(ctx context.Context, serverName string, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	elicitation, err := newElicitation(serverName, request)
+	if err != nil {
+		return nil, err
+	}
+	pending := &pendingElicitation{
+		elicitation: elicitation,
+		answer:      make(chan *mcp.ElicitationResult, 1),
+	}
+
+	instance.setElicitation(pending, true)
+	defer instance.setElicitation(pending, false)
+
+	select {
+	case result := <-pending.answer:
+		return result, nil
+	case <-ctx.Done():
+		return &mcp.ElicitationResult{ElicitationResponse: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionCancel}}, nil
+	}
+}
+
+// setElicitation shows or removes a pending elicitation and updates the UI
+func (instance *AgentChatSession) setElicitation(pending *pendingElicitation, waiting bool) {
+	instance.messagesMutex.Lock()
+	currentTurn := instance.currentTurn
+	currentChatBlock := &currentTurn.block
+	if waiting {
+		instance.elicitations[pending.elicitation.ID] = pending
+		currentChatBlock.Elicitation = pending.elicitation
+	} else {
+		delete(instance.elicitations, pending.elicitation.ID)
+		if currentChatBlock.Elicitation == pending.elicitation {
+			currentChatBlock.Elicitation = nil
+		}
+	}
+	chatBlock := currentTurn.chatBlock()
+	instance.messagesMutex.Unlock()
+
+	// Send UI update
+	instance.responseFunc(ChatBlockResponse{
+		ChatBlock: chatBlock,
+		New:       false,
+	})
+}
+
+// AnswerElicitation passes the user's answer to the MCP server waiting for it
+func (instance *AgentChatSession) AnswerElicitation(id string, action string, values map[string]string) error {
+	instance.messagesMutex.RLock()
+	pending, found := instance.elicitations[id]
+	instance.messagesMutex.RUnlock()
+
+	if !found {
+		return fmt.Errorf("unknown elicitation %s", id)
+	}
+
+	result, err := pending.elicitation.result(action, values)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case pending.answer <- result:
+		return nil
+	default:
+		return fmt.Errorf("elicitation %s was already answered", id)
+	}
 }
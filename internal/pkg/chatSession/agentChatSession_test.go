@@ -0,0 +1,173 @@
+package chatSession
+
+import (
+	"ai-chat/internal/pkg/agent/agentTest"
+	"ai-chat/internal/pkg/policy"
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// testSession creates a session answering with a fake model, which waits for release when it is not nil,
+// the chat blocks the session pushes to the UI are sent to the channel
+func testSession(t *testing.T, release <-chan struct{}) (*AgentChatSession, chan ChatBlockResponse) {
+	t.Helper()
+
+	responses := make(chan ChatBlockResponse, 100)
+	session, err := NewAgentChatSession("session-1", agentTest.NewAgent(t, release), func(response ChatBlockResponse) {
+		responses <- response
+	})
+	assert.NoError(t, err)
+
+	return session.(*AgentChatSession), responses
+}
+
+// waitForTurn waits until the running turn completed or failed and the session let go of it,
+// the conversations pushed when a branch is added or selected are skipped
+func waitForTurn(t *testing.T, session *AgentChatSession, responses chan ChatBlockResponse) ChatBlock {
+	t.Helper()
+
+	for {
+		select {
+		case response := <-responses:
+			if response.ChatBlocks == nil && (response.ChatBlock.Completed || response.ChatBlock.Failed) {
+				session.processingMutex.Lock()
+				session.processingMutex.Unlock()
+				return response.ChatBlock
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the turn did not end")
+		}
+	}
+}
+
+func TestRegeneratePositive(t *testing.T) {
+	session, responses := testSession(t, nil)
+
+	assert.NoError(t, session.EnqueueMessage(policy.Principal{}, "question"))
+	waitForTurn(t, session, responses)
+
+	assert.NoError(t, session.Regenerate(policy.Principal{}))
+	chatBlock := waitForTurn(t, session, responses)
+	assert.Equal(t, "question", chatBlock.UserMessage)
+	assert.Equal(t, "answer to question", chatBlock.AssistantMessage)
+
+	chatBlocks := session.ChatBlocks()
+	assert.Len(t, chatBlocks, 1)
+	assert.Equal(t, 1, chatBlocks[0].Branch)
+	assert.Equal(t, 2, chatBlocks[0].Branches)
+	assert.Equal(t, 2, session.turns)
+}
+
+func TestRegenerateNegative(t *testing.T) {
+	session, _ := testSession(t, nil)
+
+	assert.Error(t, session.Regenerate(policy.Principal{}))
+	assert.Empty(t, session.ChatBlocks())
+	assert.Equal(t, 0, session.turns)
+}
+
+func TestEditMessagePositiveScratchpad(t *testing.T) {
+	session, responses := testSession(t, nil)
+
+	assert.NoError(t, session.EnqueueMessage(policy.Principal{}, "note a"))
+	waitForTurn(t, session, responses)
+	assert.NoError(t, session.EnqueueMessage(policy.Principal{}, "note b"))
+	waitForTurn(t, session, responses)
+	assert.Equal(t, []string{"a", "b"}, session.scratchpad.Notes())
+
+	// The edited turn starts with the notes of the turn before it, not with the ones of the replaced turn
+	assert.NoError(t, session.EditMessage(policy.Principal{}, 1, "note c"))
+	chatBlock := waitForTurn(t, session, responses)
+	assert.Equal(t, "noted", chatBlock.AssistantMessage)
+	assert.Equal(t, []string{"a", "c"}, session.scratchpad.Notes())
+
+	chatBlocks := session.ChatBlocks()
+	assert.Len(t, chatBlocks, 2)
+	assert.Equal(t, "note c", chatBlocks[1].UserMessage)
+	assert.Equal(t, 2, chatBlocks[1].Branches)
+
+	// Continuing the original branch continues with its notes
+	assert.NoError(t, session.SelectBranch(1, 0))
+	assert.NoError(t, session.EnqueueMessage(policy.Principal{}, "note d"))
+	waitForTurn(t, session, responses)
+	assert.Equal(t, []string{"a", "b", "d"}, session.scratchpad.Notes())
+	assert.Equal(t, 4, session.turns)
+}
+
+func TestEditMessageNegative(t *testing.T) {
+	session, responses := testSession(t, nil)
+
+	assert.NoError(t, session.EnqueueMessage(policy.Principal{}, "question"))
+	waitForTurn(t, session, responses)
+
+	assert.Error(t, session.EditMessage(policy.Principal{}, 1, "no such message"))
+	assert.Error(t, session.EditMessage(policy.Principal{}, -1, "no such message"))
+	assert.Error(t, session.EditMessage(policy.Principal{}, 0, ""))
+
+	chatBlocks := session.ChatBlocks()
+	assert.Len(t, chatBlocks, 1)
+	assert.Equal(t, 1, chatBlocks[0].Branches)
+	assert.Equal(t, 1, session.turns)
+}
+
+func TestBranchTurnNegativeRunning(t *testing.T) {
+	release := make(chan struct{})
+	session, responses := testSession(t, release)
+
+	assert.NoError(t, session.EnqueueMessage(policy.Principal{}, "question"))
+	release <- struct{}{}
+	waitForTurn(t, session, responses)
+
+	// The regenerated turn waits for the model, the branches stay as they are until it ended
+	assert.NoError(t, session.Regenerate(policy.Principal{}))
+	assert.ErrorIs(t, session.Regenerate(policy.Principal{}), ErrTurnRunning)
+	assert.ErrorIs(t, session.EditMessage(policy.Principal{}, 0, "another question"), ErrTurnRunning)
+	assert.ErrorIs(t, session.SelectBranch(0, 0), ErrTurnRunning)
+
+	close(release)
+	chatBlock := waitForTurn(t, session, responses)
+	assert.Equal(t, "answer to question", chatBlock.AssistantMessage)
+	assert.Equal(t, 1, chatBlock.Branch)
+	assert.Equal(t, 2, chatBlock.Branches)
+	assert.NoError(t, session.SelectBranch(0, 0))
+}
+
+func TestElicitPositiveQueuedMessage(t *testing.T) {
+	release := make(chan struct{})
+	session, responses := testSession(t, release)
+
+	assert.NoError(t, session.EnqueueMessage(policy.Principal{}, "question"))
+	assert.Eventually(t, func() bool {
+		session.messagesMutex.RLock()
+		defer session.messagesMutex.RUnlock()
+		return session.turns == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, session.EnqueueMessage(policy.Principal{}, "queued"))
+
+	// The question is shown with the running turn, not with the message waiting for it
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *mcp.ElicitationResult)
+	go func() {
+		result, err := session.Elicit(ctx, "server", mcp.ElicitationRequest{Params: mcp.ElicitationParams{Message: "Which one?"}})
+		assert.NoError(t, err)
+		done <- result
+	}()
+	for response := range responses {
+		if response.ChatBlock.Elicitation != nil {
+			assert.Equal(t, "question", response.ChatBlock.UserMessage)
+			break
+		}
+	}
+	chatBlocks := session.ChatBlocks()
+	assert.NotNil(t, chatBlocks[0].Elicitation)
+	assert.Nil(t, chatBlocks[1].Elicitation)
+
+	cancel()
+	assert.Equal(t, mcp.ElicitationResponseActionCancel, (<-done).Action)
+	close(release)
+	waitForTurn(t, session, responses)
+	waitForTurn(t, session, responses)
+}
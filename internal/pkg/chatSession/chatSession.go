@@ -1,22 +1,88 @@
 package chatSession
 
+import (
+	"ai-chat/internal/pkg/agent"
+	"ai-chat/internal/pkg/policy"
+	"ai-chat/internal/pkg/tools"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrTurnRunning is returned when earlier turns are changed while the agent still works on one
+var ErrTurnRunning = errors.New("a turn is still running")
+
 type ChatBlockResponse struct {
-	ChatBlock ChatBlock
-	New       bool
+	ChatBlock  ChatBlock
+	New        bool
+	ChatBlocks []ChatBlock // the whole conversation, set when earlier chat blocks were replaced
 }
 
 type ChatBlock struct {
 	SystemMessage    string
 	UserMessage      string
 	AssistantMessage string
+	Attachments      []string         // names of the attachments sent with the user message
+	Elicitation      *Elicitation     // question of an MCP server waiting for the user's answer
+	Artifacts        []tools.Artifact // binary tool outputs shown with the assistant message
+	Events           []agent.Event    // reasoning trace of the turn: model steps, tool calls and their results
 	Completed        bool
 	Failed           bool
+	Branch           int // zero based position of the turn among the alternatives sent in its place
+	Branches         int // number of alternatives, there are several once the turn was regenerated or edited
+}
+
+// clone copies the chat block, the events are appended to while the turn runs
+func (block *ChatBlock) clone() ChatBlock {
+	clone := *block
+	clone.Events = slices.Clone(block.Events)
+	return clone
+}
+
+// Attachment is content, such as an MCP resource, sent to the model along with a user message
+type Attachment struct {
+	Name    string
+	Content string
 }
 
 type ChatSession interface {
-	EnqueueMessage(message string) error
+	EnqueueMessage(principal policy.Principal, message string, attachments ...Attachment) error
 	Shutdown()
 	ChatBlocks() []ChatBlock
+	Model() string
+	SetModel(modelString string) error
+	AnswerElicitation(id string, action string, values map[string]string) error
+	Regenerate(principal policy.Principal) error
+	EditMessage(principal policy.Principal, index int, message string) error
+	SelectBranch(index int, branch int) error
 }
 
 type ChatBlockResponseFunc func(response ChatBlockResponse)
+
+// messageWithAttachments appends the attachments to the message in tags the model can tell apart from the question
+func messageWithAttachments(message string, attachments []Attachment) string {
+	if len(attachments) == 0 {
+		return message
+	}
+
+	var builder strings.Builder
+	builder.WriteString(message)
+	for _, attachment := range attachments {
+		builder.WriteString(fmt.Sprintf("\n\n<attachment name=%q>\n%s\n</attachment>", attachment.Name, attachment.Content))
+	}
+	return builder.String()
+}
+
+// attachmentNames returns the names shown in the UI for the attachments
+func attachmentNames(attachments []Attachment) []string {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(attachments))
+	for index, attachment := range attachments {
+		names[index] = attachment.Name
+	}
+	return names
+}
@@ -1,10 +1,13 @@
 package chatSession
 
 import (
+	"ai-chat/internal/pkg/policy"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/ollama/ollama/api"
 	"github.com/rs/zerolog/log"
+	"strings"
 )
 
 const questionQueueBufferSize = 16
@@ -28,15 +31,49 @@ func (instance *chatSessionImpl) ChatBlocks() []ChatBlock {
 	return sessions
 }
 
-func (instance *chatSessionImpl) EnqueueMessage(message string) error {
+// EnqueueMessage queues a question, the principal is not used as the session does not run MCP tools
+func (instance *chatSessionImpl) EnqueueMessage(_ policy.Principal, message string, attachments ...Attachment) error {
 	select {
-	case instance.questions <- message:
+	case instance.questions <- messageWithAttachments(message, attachments):
 		return nil
 	default:
 		return errors.New("question queue is full")
 	}
 }
 
+func (instance *chatSessionImpl) Model() string {
+	return "ollama:" + instance.model
+}
+
+func (instance *chatSessionImpl) SetModel(modelString string) error {
+	modelName, found := strings.CutPrefix(modelString, "ollama:")
+	if !found || modelName == "" {
+		return fmt.Errorf("unsupported model %s, only ollama models are available", modelString)
+	}
+	instance.model = modelName
+	return nil
+}
+
+// AnswerElicitation fails as the session does not run MCP tools
+func (instance *chatSessionImpl) AnswerElicitation(id string, action string, values map[string]string) error {
+	return fmt.Errorf("unknown elicitation %s", id)
+}
+
+// Regenerate fails as the session keeps no history it could rewind
+func (instance *chatSessionImpl) Regenerate(_ policy.Principal) error {
+	return errors.New("regenerating answers is not supported")
+}
+
+// EditMessage fails as the session keeps no history it could rewind
+func (instance *chatSessionImpl) EditMessage(_ policy.Principal, index int, message string) error {
+	return errors.New("editing messages is not supported")
+}
+
+// SelectBranch fails as the session keeps no alternative answers
+func (instance *chatSessionImpl) SelectBranch(index int, branch int) error {
+	return errors.New("conversation branches are not supported")
+}
+
 func toApiMessages(chatBlocks []*ChatBlock) []api.Message {
 	messages := make([]api.Message, 0)
 	for _, chatBlock := range chatBlocks {
@@ -0,0 +1,85 @@
+package chatSession
+
+import (
+	"github.com/cloudwego/eino/schema"
+)
+
+// turn is a node of the conversation tree: a user message, the agent's answer and the turns continuing from it.
+// Regenerating or editing a turn adds a sibling, so the alternatives are kept and can be switched between.
+type turn struct {
+	block       ChatBlock
+	messages    []*schema.Message // the user message and, once the turn succeeded, the answer
+	attachments []Attachment      // sent again when the turn is regenerated or the message edited
+	notes       []string          // scratchpad notes once the turn ended
+	parent      *turn
+	children    []*turn
+	selected    int // index of the child on the selected path
+}
+
+// newTurn creates an unanswered turn for a user message
+func newTurn(message string, attachments []Attachment) *turn {
+	return &turn{
+		block: ChatBlock{
+			UserMessage: message,
+			Attachments: attachmentNames(attachments),
+			Completed:   false,
+			Failed:      false,
+		},
+		messages:    []*schema.Message{schema.UserMessage(messageWithAttachments(message, attachments))},
+		attachments: attachments,
+	}
+}
+
+// addChild adds a turn continuing from this one and selects it
+func (t *turn) addChild(child *turn) {
+	child.parent = t
+	t.children = append(t.children, child)
+	t.selected = len(t.children) - 1
+}
+
+// path returns the turns following the selected branches from this one, which is not included, to the last one
+func (t *turn) path() []*turn {
+	var path []*turn
+	for node := t; len(node.children) > 0; {
+		node = node.children[node.selected]
+		path = append(path, node)
+	}
+	return path
+}
+
+// leaf returns the last turn of the selected path, new messages continue from it
+func (t *turn) leaf() *turn {
+	node := t
+	for len(node.children) > 0 {
+		node = node.children[node.selected]
+	}
+	return node
+}
+
+// history returns the messages of the turns leading to this one and of this turn, as they are sent to the model
+func (t *turn) history() []*schema.Message {
+	var turns []*turn
+	for node := t; node != nil; node = node.parent {
+		turns = append(turns, node)
+	}
+
+	var messages []*schema.Message
+	for index := len(turns) - 1; index >= 0; index-- {
+		messages = append(messages, turns[index].messages...)
+	}
+	return messages
+}
+
+// chatBlock returns a copy of the chat block with the position of the turn among its alternatives
+func (t *turn) chatBlock() ChatBlock {
+	chatBlock := t.block.clone()
+	if t.parent != nil {
+		for index, sibling := range t.parent.children {
+			if sibling == t {
+				chatBlock.Branch = index
+			}
+		}
+		chatBlock.Branches = len(t.parent.children)
+	}
+	return chatBlock
+}
@@ -0,0 +1,66 @@
+package chatSession
+
+import (
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// answered creates a turn with the model's answer
+func answered(message string, answer string) *turn {
+	t := newTurn(message, nil)
+	t.messages = append(t.messages, schema.AssistantMessage(answer, nil))
+	return t
+}
+
+func contents(messages []*schema.Message) []string {
+	texts := make([]string, len(messages))
+	for index, message := range messages {
+		texts[index] = message.Content
+	}
+	return texts
+}
+
+func TestConversationPositive(t *testing.T) {
+	root := &turn{}
+	first := answered("question", "answer")
+	root.addChild(first)
+	second := answered("typo", "confused")
+	first.addChild(second)
+
+	// Editing the second message adds a sibling and follows it
+	edited := newTurn("fixed", []Attachment{{Name: "notes.txt", Content: "notes"}})
+	second.parent.addChild(edited)
+
+	assert.Equal(t, []*turn{first, edited}, root.path())
+	assert.Equal(t, edited, root.leaf())
+	assert.Equal(t, []string{"question", "answer", "fixed\n\n<attachment name=\"notes.txt\">\nnotes\n</attachment>"},
+		contents(edited.history()))
+
+	chatBlock := edited.chatBlock()
+	assert.Equal(t, 1, chatBlock.Branch)
+	assert.Equal(t, 2, chatBlock.Branches)
+	assert.Equal(t, []string{"notes.txt"}, chatBlock.Attachments)
+
+	// Switching back keeps the original branch and its history
+	first.selected = 0
+	assert.Equal(t, []*turn{first, second}, root.path())
+	assert.Equal(t, []string{"question", "answer", "typo", "confused"}, contents(root.leaf().history()))
+	assert.Equal(t, 0, second.chatBlock().Branch)
+}
+
+func TestConversationNegative(t *testing.T) {
+	root := &turn{}
+
+	assert.Empty(t, root.path())
+	assert.Equal(t, root, root.leaf())
+	assert.Empty(t, root.history())
+
+	// A turn that failed has no answer, the next one continues after its user message
+	failed := newTurn("question", nil)
+	root.addChild(failed)
+	next := newTurn("again", nil)
+	failed.addChild(next)
+	assert.Equal(t, []string{"question", "again"}, contents(next.history()))
+	assert.Equal(t, 1, next.chatBlock().Branches)
+}
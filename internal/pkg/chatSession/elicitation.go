@@ -0,0 +1,146 @@
+package chatSession
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// Actions answering an elicitation
+const (
+	ElicitationAccept  = string(mcp.ElicitationResponseActionAccept)
+	ElicitationDecline = string(mcp.ElicitationResponseActionDecline)
+	ElicitationCancel  = string(mcp.ElicitationResponseActionCancel)
+)
+
+// Elicitation is a question an MCP server asks the user while one of its tools runs
+type Elicitation struct {
+	ID      string
+	Server  string
+	Message string
+	Fields  []ElicitationField
+}
+
+// ElicitationField is an input of the flat form an elicitation requests
+type ElicitationField struct {
+	Name        string
+	Title       string
+	Description string
+	Type        string // string, number, integer or boolean
+	Enum        []string
+	Required    bool
+}
+
+// elicitationSchema is the restricted JSON schema of an elicitation, an object of primitive properties
+type elicitationSchema struct {
+	Properties map[string]struct {
+		Type        string `json:"type"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Enum        []any  `json:"enum"`
+	} `json:"properties"`
+	Required []string `json:"required"`
+}
+
+// newElicitation converts an elicitation request into the form shown to the user
+func newElicitation(serverName string, request mcp.ElicitationRequest) (*Elicitation, error) {
+	elicitation := &Elicitation{
+		ID:      uuid.NewString(),
+		Server:  serverName,
+		Message: request.Params.Message,
+	}
+	if request.Params.RequestedSchema == nil {
+		return elicitation, nil
+	}
+
+	schemaJSON, err := json.Marshal(request.Params.RequestedSchema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid elicitation schema: %w", err)
+	}
+	var schema elicitationSchema
+	if err := json.Unmarshal(schemaJSON, &schema); err != nil {
+		return nil, fmt.Errorf("invalid elicitation schema: %w", err)
+	}
+
+	for name, property := range schema.Properties {
+		switch property.Type {
+		case "string", "number", "integer", "boolean":
+		default:
+			return nil, fmt.Errorf("unsupported elicitation property %s of type %s", name, property.Type)
+		}
+
+		field := ElicitationField{
+			Name:        name,
+			Title:       property.Title,
+			Description: property.Description,
+			Type:        property.Type,
+			Required:    slices.Contains(schema.Required, name),
+		}
+		for _, value := range property.Enum {
+			field.Enum = append(field.Enum, fmt.Sprint(value))
+		}
+		elicitation.Fields = append(elicitation.Fields, field)
+	}
+	sort.Slice(elicitation.Fields, func(i, j int) bool {
+		return elicitation.Fields[i].Name < elicitation.Fields[j].Name
+	})
+
+	return elicitation, nil
+}
+
+// result converts the user's answer into the response sent to the server, values are the form inputs by field name
+func (e *Elicitation) result(action string, values map[string]string) (*mcp.ElicitationResult, error) {
+	result := &mcp.ElicitationResult{}
+	switch action {
+	case ElicitationDecline, ElicitationCancel:
+		result.Action = mcp.ElicitationResponseAction(action)
+		return result, nil
+	case ElicitationAccept:
+	default:
+		return nil, fmt.Errorf("unknown elicitation action %s", action)
+	}
+
+	content := make(map[string]any, len(e.Fields))
+	for _, field := range e.Fields {
+		value, found := values[field.Name]
+		if field.Type == "boolean" {
+			// Unchecked checkboxes are not submitted
+			content[field.Name] = found && value != "" && value != "false"
+			continue
+		}
+		if !found || value == "" {
+			if field.Required {
+				return nil, fmt.Errorf("%s is required", field.Name)
+			}
+			continue
+		}
+
+		switch field.Type {
+		case "number":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a number", field.Name)
+			}
+			content[field.Name] = number
+		case "integer":
+			number, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer", field.Name)
+			}
+			content[field.Name] = number
+		default:
+			if len(field.Enum) > 0 && !slices.Contains(field.Enum, value) {
+				return nil, fmt.Errorf("%s must be one of %v", field.Name, field.Enum)
+			}
+			content[field.Name] = value
+		}
+	}
+
+	result.Action = mcp.ElicitationResponseActionAccept
+	result.Content = content
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package httpHandlers
+
+import (
+	"ai-chat/internal/pkg/agent"
+	"ai-chat/internal/pkg/audit"
+	"ai-chat/internal/pkg/tools"
+	"ai-chat/internal/pkg/web"
+	"crypto/subtle"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminHandlers serve the administration endpoints, they require the admin token as a bearer token
+type AdminHandlers struct {
+	auditLog   *audit.Log
+	mcpAgent   *agent.Agent
+	adminToken string
+}
+
+// metricsResponse is the JSON body of the metrics endpoint
+type metricsResponse struct {
+	ToolCache tools.CacheStats `json:"toolCache"`
+}
+
+func NewAdmin(auditLog *audit.Log, mcpAgent *agent.Agent, adminToken string) *AdminHandlers {
+	return &AdminHandlers{
+		auditLog:   auditLog,
+		mcpAgent:   mcpAgent,
+		adminToken: adminToken,
+	}
+}
+
+// authorized checks the bearer token, without a configured token the endpoints are disabled
+func (instance *AdminHandlers) authorized(request *http.Request) bool {
+	if instance.adminToken == "" {
+		return false
+	}
+	token, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(instance.adminToken)) == 1
+}
+
+// ToolAudit returns tool invocations, newest first, filtered by the query parameters session, tool,
+// from and to (RFC 3339) and limit
+func (instance *AdminHandlers) ToolAudit(request *http.Request, simulatedDelay int) *web.Response {
+	if !instance.authorized(request) {
+		return web.GetEmptyResponse(http.StatusUnauthorized, nil, nil)
+	}
+	if instance.auditLog == nil {
+		return web.GetEmptyResponse(http.StatusNotFound, nil, nil)
+	}
+
+	query := request.URL.Query()
+	filter := audit.Filter{
+		SessionID: query.Get("session"),
+		Tool:      query.Get("tool"),
+	}
+	var err error
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = time.Parse(time.RFC3339, value); err != nil {
+			return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = time.Parse(time.RFC3339, value); err != nil {
+			return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil {
+			return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+		}
+	}
+
+	records, err := instance.auditLog.Query(filter)
+	if err != nil {
+		log.Error().Err(err).Msg("auditLog.Query() failed")
+		return web.GetEmptyResponse(http.StatusInternalServerError, nil, nil)
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.JsonResponse(http.StatusOK, records, nil, nil)
+}
+
+// Metrics returns the counters of the application, the hits and misses of the tool result cache
+func (instance *AdminHandlers) Metrics(request *http.Request, simulatedDelay int) *web.Response {
+	if !instance.authorized(request) {
+		return web.GetEmptyResponse(http.StatusUnauthorized, nil, nil)
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.JsonResponse(http.StatusOK, metricsResponse{ToolCache: instance.mcpAgent.ToolCacheStats()}, nil, nil)
+}
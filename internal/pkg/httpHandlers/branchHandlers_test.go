@@ -0,0 +1,136 @@
+package httpHandlers
+
+import (
+	"ai-chat/internal/pkg/agent/agentTest"
+	"ai-chat/internal/pkg/chatSession"
+	"ai-chat/internal/pkg/cookies"
+	"ai-chat/internal/pkg/policy"
+	"ai-chat/internal/pkg/sessions"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// answeredSession creates handlers with a session that answered a question, the chat blocks the session pushes
+// to the UI are sent to the channel
+func answeredSession(t *testing.T) (*ChatHandlers, uuid.UUID, chan chatSession.ChatBlockResponse) {
+	t.Helper()
+
+	testAgent := agentTest.NewAgent(t, nil)
+	sessionManager := sessions.New()
+	responses := make(chan chatSession.ChatBlockResponse, 100)
+	id := uuid.New()
+	assert.NoError(t, sessionManager.AddAgentSession(id, testAgent, func(response chatSession.ChatBlockResponse) {
+		responses <- response
+	}))
+
+	assert.NoError(t, sessionManager.GetSession(id).EnqueueMessage(policy.Principal{}, "question"))
+	waitForAnswer(t, responses)
+
+	return New(nil, sessionManager, nil, testAgent), id, responses
+}
+
+// waitForAnswer waits for the chat block of a turn that completed or failed
+func waitForAnswer(t *testing.T, responses chan chatSession.ChatBlockResponse) chatSession.ChatBlock {
+	t.Helper()
+
+	for {
+		select {
+		case response := <-responses:
+			if response.ChatBlocks == nil && (response.ChatBlock.Completed || response.ChatBlock.Failed) {
+				return response.ChatBlock
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the turn did not end")
+		}
+	}
+}
+
+// formRequest creates a form post with the session cookie, no cookie is set for uuid.Nil
+func formRequest(target string, id uuid.UUID, form url.Values) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if id != uuid.Nil {
+		request.AddCookie(cookies.SetIdToCookie(id))
+	}
+	return request
+}
+
+// eventuallyStatus calls the handler until it stops refusing because of the turn the session is letting go of
+func eventuallyStatus(t *testing.T, handle func() int) int {
+	t.Helper()
+
+	status := handle()
+	for deadline := time.Now().Add(5 * time.Second); status == http.StatusConflict && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		status = handle()
+	}
+	return status
+}
+
+func TestRegenerateHandlerPositive(t *testing.T) {
+	handlers, id, responses := answeredSession(t)
+
+	status := eventuallyStatus(t, func() int {
+		return handlers.Regenerate(formRequest("/api/regenerate", id, url.Values{}), 0).Status
+	})
+	assert.Equal(t, http.StatusOK, status)
+
+	chatBlock := waitForAnswer(t, responses)
+	assert.Equal(t, "answer to question", chatBlock.AssistantMessage)
+	assert.Equal(t, 1, chatBlock.Branch)
+	assert.Equal(t, 2, chatBlock.Branches)
+}
+
+func TestRegenerateHandlerNegative(t *testing.T) {
+	handlers, _, _ := answeredSession(t)
+
+	response := handlers.Regenerate(formRequest("/api/regenerate", uuid.Nil, url.Values{}), 0)
+	assert.Equal(t, http.StatusBadRequest, response.Status)
+
+	response = handlers.Regenerate(formRequest("/api/regenerate", uuid.New(), url.Values{}), 0)
+	assert.Equal(t, http.StatusInternalServerError, response.Status)
+}
+
+func TestEditMessageHandlerPositive(t *testing.T) {
+	handlers, id, responses := answeredSession(t)
+
+	status := eventuallyStatus(t, func() int {
+		form := url.Values{"index": {"0"}, "user-input": {"another question"}}
+		return handlers.EditMessage(formRequest("/api/edit", id, form), 0).Status
+	})
+	assert.Equal(t, http.StatusOK, status)
+
+	chatBlock := waitForAnswer(t, responses)
+	assert.Equal(t, "another question", chatBlock.UserMessage)
+	assert.Equal(t, "answer to another question", chatBlock.AssistantMessage)
+	assert.Equal(t, 2, chatBlock.Branches)
+}
+
+func TestEditMessageHandlerNegative(t *testing.T) {
+	handlers, id, _ := answeredSession(t)
+
+	for _, form := range []url.Values{
+		{"index": {"0"}},
+		{"index": {"first"}, "user-input": {"another question"}},
+		{"user-input": {"another question"}},
+	} {
+		response := handlers.EditMessage(formRequest("/api/edit", id, form), 0)
+		assert.Equal(t, http.StatusBadRequest, response.Status, form.Encode())
+	}
+
+	status := eventuallyStatus(t, func() int {
+		form := url.Values{"index": {"1"}, "user-input": {"another question"}}
+		return handlers.EditMessage(formRequest("/api/edit", id, form), 0).Status
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	form := url.Values{"index": {"0"}, "user-input": {"another question"}}
+	response := handlers.EditMessage(formRequest("/api/edit", uuid.Nil, form), 0)
+	assert.Equal(t, http.StatusBadRequest, response.Status)
+}
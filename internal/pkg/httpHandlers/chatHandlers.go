@@ -4,19 +4,32 @@ import (
 	"ai-chat/internal/pkg/agent"
 	"ai-chat/internal/pkg/chatSession"
 	"ai-chat/internal/pkg/cookies"
+	"ai-chat/internal/pkg/models"
+	"ai-chat/internal/pkg/policy"
 	"ai-chat/internal/pkg/sessions"
+	"ai-chat/internal/pkg/tools"
 	"ai-chat/internal/pkg/web"
 	"ai-chat/internal/pkg/websocketServer"
 	"bytes"
+	"context"
+	"errors"
 	"github.com/cloudwego/eino/schema"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"html/template"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+const (
+	modelListingTimeout = 10 * time.Second
+	mcpRequestTimeout   = 30 * time.Second
+)
+
 type ChatHandlers struct {
 	templates          *template.Template
 	notificationServer websocketServer.WebsocketServer
@@ -69,7 +82,7 @@ func (instance *ChatHandlers) Main(request *http.Request, simulatedDelay int) *w
 		return web.GetEmptyResponse(http.StatusInternalServerError, nil, nil)
 	}
 
-	headers := map[string]string{"HX-Trigger-After-Swap": "{\"parseAllRawMessages\":\"\"}"}
+	headers := map[string]string{"HX-Trigger-After-Swap": "{\"parseAllRawMessages\":\"\",\"loadModels\":\"\",\"loadMcpItems\":\"\"}"}
 	return web.RenderResponse(http.StatusOK, instance.templates, "main.gohtml", ToUiSessions(session.ChatBlocks()), headers, cookie)
 }
 
@@ -96,8 +109,30 @@ func (instance *ChatHandlers) Ask(request *http.Request, simulatedDelay int) *we
 		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
 	}
 
+	// Selected resources are read now and sent along with the message, values have the form "server:uri"
+	attachments := make([]chatSession.Attachment, 0, len(request.Form["resource"]))
+	for _, resource := range request.Form["resource"] {
+		serverName, uri, found := strings.Cut(resource, ":")
+		if !found {
+			return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+		}
+
+		ctx, cancel := context.WithTimeout(instance.principalContext(request), mcpRequestTimeout)
+		content, err := instance.mcpAgent.ReadResource(ctx, serverName, uri)
+		cancel()
+		if errors.Is(err, tools.ErrNotAllowed) {
+			log.Warn().Err(err).Str("resource", resource).Msg("agent.ReadResource() refused")
+			return web.GetEmptyResponse(http.StatusForbidden, nil, nil)
+		}
+		if err != nil {
+			log.Error().Err(err).Str("resource", resource).Msg("agent.ReadResource() failed")
+			return web.GetEmptyResponse(http.StatusBadGateway, nil, nil)
+		}
+		attachments = append(attachments, chatSession.Attachment{Name: uri, Content: content})
+	}
+
 	// Enqueue the message to the session
-	err = session.EnqueueMessage(userInput)
+	err = session.EnqueueMessage(instance.mcpAgent.Policy().Principal(request), userInput, attachments...)
 	if err != nil {
 		log.Error().Err(err).Msg("enqueue question failed")
 		return web.GetEmptyResponse(http.StatusInternalServerError, nil, nil)
@@ -109,6 +144,341 @@ func (instance *ChatHandlers) Ask(request *http.Request, simulatedDelay int) *we
 	return web.GetEmptyResponse(http.StatusOK, headers, nil)
 }
 
+// Regenerate runs the last turn of the session again, the new answer replaces the shown one
+func (instance *ChatHandlers) Regenerate(request *http.Request, simulatedDelay int) *web.Response {
+	id := cookies.GetIdFromCookie(request)
+	if id == uuid.Nil {
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	session := instance.sessionManager.GetSession(id)
+	if session == nil {
+		log.Error().Msg("sessionManager.GetSession() failed")
+		return web.GetEmptyResponse(http.StatusInternalServerError, nil, nil)
+	}
+
+	err := session.Regenerate(instance.mcpAgent.Policy().Principal(request))
+	if err != nil {
+		log.Error().Err(err).Msg("session.Regenerate() failed")
+		return web.GetEmptyResponse(turnErrorStatus(err), nil, nil)
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.GetEmptyResponse(http.StatusOK, nil, nil)
+}
+
+// EditMessage replaces an earlier user message and runs the conversation again from it,
+// the form has the index of the turn and the new "user-input"
+func (instance *ChatHandlers) EditMessage(request *http.Request, simulatedDelay int) *web.Response {
+	id := cookies.GetIdFromCookie(request)
+	if id == uuid.Nil {
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	session := instance.sessionManager.GetSession(id)
+	if session == nil {
+		log.Error().Msg("sessionManager.GetSession() failed")
+		return web.GetEmptyResponse(http.StatusInternalServerError, nil, nil)
+	}
+
+	err := request.ParseForm()
+	if err != nil {
+		log.Error().Err(err).Msg("http.Request.ParseForm() failed")
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	index, err := strconv.Atoi(request.Form.Get("index"))
+	userInput := request.Form.Get("user-input")
+	if err != nil || userInput == "" {
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	err = session.EditMessage(instance.mcpAgent.Policy().Principal(request), index, userInput)
+	if err != nil {
+		log.Error().Err(err).Int("index", index).Msg("session.EditMessage() failed")
+		return web.GetEmptyResponse(turnErrorStatus(err), nil, nil)
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.GetEmptyResponse(http.StatusOK, nil, nil)
+}
+
+// SelectBranch shows another alternative of an earlier turn and continues the conversation from it,
+// the form has the index of the turn and the zero based index of the branch
+func (instance *ChatHandlers) SelectBranch(request *http.Request, simulatedDelay int) *web.Response {
+	id := cookies.GetIdFromCookie(request)
+	if id == uuid.Nil {
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	session := instance.sessionManager.GetSession(id)
+	if session == nil {
+		log.Error().Msg("sessionManager.GetSession() failed")
+		return web.GetEmptyResponse(http.StatusInternalServerError, nil, nil)
+	}
+
+	err := request.ParseForm()
+	if err != nil {
+		log.Error().Err(err).Msg("http.Request.ParseForm() failed")
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	index, indexErr := strconv.Atoi(request.Form.Get("index"))
+	branch, branchErr := strconv.Atoi(request.Form.Get("branch"))
+	if indexErr != nil || branchErr != nil {
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	err = session.SelectBranch(index, branch)
+	if err != nil {
+		log.Error().Err(err).Int("index", index).Int("branch", branch).Msg("session.SelectBranch() failed")
+		return web.GetEmptyResponse(turnErrorStatus(err), nil, nil)
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.GetEmptyResponse(http.StatusOK, nil, nil)
+}
+
+// turnErrorStatus tells a turn still running apart from a request that cannot be done
+func turnErrorStatus(err error) int {
+	if errors.Is(err, chatSession.ErrTurnRunning) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// modelsResponse is the JSON body of the model listing
+type modelsResponse struct {
+	Current   string                  `json:"current"`
+	Providers []models.ProviderModels `json:"providers"`
+}
+
+func (instance *ChatHandlers) Models(request *http.Request, simulatedDelay int) *web.Response {
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	current := instance.mcpAgent.Model()
+	if session := instance.sessionManager.GetSession(cookies.GetIdFromCookie(request)); session != nil {
+		current = session.Model()
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), modelListingTimeout)
+	defer cancel()
+
+	return web.JsonResponse(http.StatusOK, modelsResponse{
+		Current:   current,
+		Providers: models.ListModels(ctx, instance.mcpAgent.ModelConfig()),
+	}, nil, nil)
+}
+
+func (instance *ChatHandlers) SelectModel(request *http.Request, simulatedDelay int) *web.Response {
+	id := cookies.GetIdFromCookie(request)
+	if id == uuid.Nil {
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	session := instance.sessionManager.GetSession(id)
+	if session == nil {
+		log.Error().Msg("sessionManager.GetSession() failed")
+		return web.GetEmptyResponse(http.StatusInternalServerError, nil, nil)
+	}
+
+	err := request.ParseForm()
+	if err != nil {
+		log.Error().Err(err).Msg("http.Request.ParseForm() failed")
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	modelString := request.Form.Get("model")
+	if modelString == "" {
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	err = session.SetModel(modelString)
+	if err != nil {
+		log.Error().Err(err).Str("model", modelString).Msg("session.SetModel() failed")
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.GetEmptyResponse(http.StatusOK, nil, nil)
+}
+
+// principalContext returns the context of the request with the principal the tool policy is checked for
+func (instance *ChatHandlers) principalContext(request *http.Request) context.Context {
+	return policy.WithPrincipal(request.Context(), instance.mcpAgent.Policy().Principal(request))
+}
+
+func (instance *ChatHandlers) McpServers(request *http.Request, simulatedDelay int) *web.Response {
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.JsonResponse(http.StatusOK, instance.mcpAgent.ServerStatuses(), nil, nil)
+}
+
+func (instance *ChatHandlers) McpResources(request *http.Request, simulatedDelay int) *web.Response {
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(instance.principalContext(request), mcpRequestTimeout)
+	defer cancel()
+
+	return web.JsonResponse(http.StatusOK, instance.mcpAgent.ListResources(ctx), nil, nil)
+}
+
+func (instance *ChatHandlers) McpPrompts(request *http.Request, simulatedDelay int) *web.Response {
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(instance.principalContext(request), mcpRequestTimeout)
+	defer cancel()
+
+	return web.JsonResponse(http.StatusOK, instance.mcpAgent.ListPrompts(ctx), nil, nil)
+}
+
+// promptResponse is the JSON body of an expanded prompt template
+type promptResponse struct {
+	Text string `json:"text"`
+}
+
+// McpPrompt expands a prompt template, arguments are passed as form values named "arg-<argument>",
+// prompts with assistant messages are refused as they cannot be put in the input box
+func (instance *ChatHandlers) McpPrompt(request *http.Request, simulatedDelay int) *web.Response {
+	err := request.ParseForm()
+	if err != nil {
+		log.Error().Err(err).Msg("http.Request.ParseForm() failed")
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	serverName := request.Form.Get("server")
+	name := request.Form.Get("name")
+	if serverName == "" || name == "" {
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	arguments := make(map[string]string)
+	for key := range request.Form {
+		if argument, found := strings.CutPrefix(key, "arg-"); found {
+			arguments[argument] = request.Form.Get(key)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(instance.principalContext(request), mcpRequestTimeout)
+	defer cancel()
+
+	text, err := instance.mcpAgent.GetPrompt(ctx, serverName, name, arguments)
+	if errors.Is(err, tools.ErrNotAllowed) {
+		log.Warn().Err(err).Str("server", serverName).Str("prompt", name).Msg("agent.GetPrompt() refused")
+		return web.GetEmptyResponse(http.StatusForbidden, nil, nil)
+	}
+	if errors.Is(err, tools.ErrMultiRolePrompt) {
+		log.Warn().Err(err).Str("server", serverName).Str("prompt", name).Msg("agent.GetPrompt() refused")
+		return web.GetEmptyResponse(http.StatusUnprocessableEntity, nil, nil)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("server", serverName).Str("prompt", name).Msg("agent.GetPrompt() failed")
+		return web.GetEmptyResponse(http.StatusBadGateway, nil, nil)
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.JsonResponse(http.StatusOK, promptResponse{Text: text}, nil, nil)
+}
+
+// AnswerElicitation passes the user's answer to a question of an MCP server, the form has the elicitation id,
+// the action and the inputs named "field-<name>"
+func (instance *ChatHandlers) AnswerElicitation(request *http.Request, simulatedDelay int) *web.Response {
+	id := cookies.GetIdFromCookie(request)
+	if id == uuid.Nil {
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	session := instance.sessionManager.GetSession(id)
+	if session == nil {
+		log.Error().Msg("sessionManager.GetSession() failed")
+		return web.GetEmptyResponse(http.StatusInternalServerError, nil, nil)
+	}
+
+	err := request.ParseForm()
+	if err != nil {
+		log.Error().Err(err).Msg("http.Request.ParseForm() failed")
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	values := make(map[string]string)
+	for key := range request.Form {
+		if field, found := strings.CutPrefix(key, "field-"); found {
+			values[field] = request.Form.Get(key)
+		}
+	}
+
+	err = session.AnswerElicitation(request.Form.Get("id"), request.Form.Get("action"), values)
+	if err != nil {
+		log.Error().Err(err).Msg("session.AnswerElicitation() failed")
+		return web.GetEmptyResponse(http.StatusBadRequest, nil, nil)
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.GetEmptyResponse(http.StatusOK, nil, nil)
+}
+
+// Artifact serves a binary tool output such as an image shown in the chat
+func (instance *ChatHandlers) Artifact(request *http.Request, simulatedDelay int) *web.Response {
+	artifact, data, found := instance.mcpAgent.Artifact(request.PathValue("id"))
+	if !found {
+		return web.GetEmptyResponse(http.StatusNotFound, nil, nil)
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return artifactResponse(artifact, data)
+}
+
+// artifactResponse serves the bytes of an MCP server in the app origin: only raster images and audio inline,
+// anything else as a download, never sniffed and sandboxed so that a page or script it contains cannot run
+func artifactResponse(artifact tools.Artifact, data []byte) *web.Response {
+	headers := web.Headers{
+		"Cache-Control":           "private, max-age=86400",
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "sandbox",
+	}
+	if artifact.IsInline() {
+		return web.BinaryResponse(http.StatusOK, artifact.MimeType, data, headers, nil)
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	headers["Content-Disposition"] = disposition
+	return web.BinaryResponse(http.StatusOK, "application/octet-stream", data, headers, nil)
+}
+
+// traceTurn is the reasoning trace of one turn in the JSON body of the trace
+type traceTurn struct {
+	UserMessage string        `json:"userMessage"`
+	Events      []agent.Event `json:"events"`
+}
+
+// Trace returns the reasoning trace of every turn of the session: model steps, tool calls and their results
+func (instance *ChatHandlers) Trace(request *http.Request, simulatedDelay int) *web.Response {
+	session := instance.sessionManager.GetSession(cookies.GetIdFromCookie(request))
+	if session == nil {
+		return web.GetEmptyResponse(http.StatusNotFound, nil, nil)
+	}
+
+	chatBlocks := session.ChatBlocks()
+	turns := make([]traceTurn, len(chatBlocks))
+	for index, chatBlock := range chatBlocks {
+		turns[index] = traceTurn{UserMessage: chatBlock.UserMessage, Events: chatBlock.Events}
+	}
+
+	time.Sleep(time.Duration(simulatedDelay) * time.Millisecond)
+
+	return web.JsonResponse(http.StatusOK, turns, nil, nil)
+}
+
 func (instance *ChatHandlers) chatBlockResponseHandler(id uuid.UUID) func(response chatSession.ChatBlockResponse) {
 	return func(response chatSession.ChatBlockResponse) {
 		uiResponse := ToUiSessionResponse(response)
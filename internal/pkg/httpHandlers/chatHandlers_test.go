@@ -0,0 +1,29 @@
+package httpHandlers
+
+import (
+	"ai-chat/internal/pkg/tools"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestArtifactResponsePositiveInline(t *testing.T) {
+	response := artifactResponse(tools.Artifact{Name: "chart-1", MimeType: "image/png"}, []byte("png"))
+
+	assert.Equal(t, http.StatusOK, response.Status)
+	assert.Equal(t, "image/png", response.ContentType)
+	assert.Equal(t, "nosniff", response.Headers["X-Content-Type-Options"])
+	assert.Equal(t, "sandbox", response.Headers["Content-Security-Policy"])
+	assert.NotContains(t, response.Headers, "Content-Disposition")
+}
+
+func TestArtifactResponseNegativeActiveContent(t *testing.T) {
+	for _, mimeType := range []string{"text/html", "image/svg+xml", "application/xhtml+xml", "IMAGE/SVG+XML; charset=utf-8", ""} {
+		response := artifactResponse(tools.Artifact{Name: "page.html", MimeType: mimeType}, []byte("<script>alert(1)</script>"))
+
+		assert.Equal(t, "application/octet-stream", response.ContentType, mimeType)
+		assert.Equal(t, `attachment; filename=page.html`, response.Headers["Content-Disposition"], mimeType)
+		assert.Equal(t, "nosniff", response.Headers["X-Content-Type-Options"], mimeType)
+		assert.Equal(t, "sandbox", response.Headers["Content-Security-Policy"], mimeType)
+	}
+}
@@ -1,28 +1,135 @@
 package httpHandlers
 
 import (
+	"ai-chat/internal/pkg/agent"
 	"ai-chat/internal/pkg/chatSession"
+	"ai-chat/internal/pkg/tools"
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"time"
 )
 
 type UiSessionResponse struct {
 	UiSession
-	New bool
+	New        bool
+	ChatBlocks []UiSession // the whole conversation when earlier chat blocks were replaced
 }
 
 type UiSession struct {
 	SystemMessageContent    string
 	UserMessageContent      string
 	AssistantMessageContent string
+	Attachments             []string
+	Elicitation             *chatSession.Elicitation
+	Artifacts               []tools.Artifact
+	Events                  []agent.Event
+	ToolSteps               []UiToolStep
+	Branch                  int // one based, as shown in the branch controls
+	Branches                int
 	Completed               bool
 	Failed                  bool
 }
 
+// UiToolStep is a tool call shown as a collapsible section of the assistant message
+type UiToolStep struct {
+	Name      string
+	Arguments string
+	Result    string
+	IsError   bool
+	Status    string
+}
+
+// toolStep is a tool call of a turn put together from its events
+type toolStep struct {
+	call     agent.Event
+	finished *agent.Event
+	running  bool
+}
+
+// toUiToolSteps returns the tool calls of a turn in the order the model made them, a started or finished event
+// belongs to the oldest unfinished call of the same id and tool, as models that do not number their calls
+// make them one by one
+func toUiToolSteps(events []agent.Event) []UiToolStep {
+	var steps []*toolStep
+	unfinished := func(event agent.Event) *toolStep {
+		for _, step := range steps {
+			if step.finished == nil && step.call.ToolCallID == event.ToolCallID && step.call.ToolName == event.ToolName {
+				return step
+			}
+		}
+		return nil
+	}
+
+	for _, event := range events {
+		switch event.Type {
+		case agent.EventToolCall:
+			steps = append(steps, &toolStep{call: event})
+		case agent.EventToolStarted:
+			if step := unfinished(event); step != nil {
+				step.running = true
+			}
+		case agent.EventToolFinished:
+			if step := unfinished(event); step != nil {
+				step.finished = &event
+			}
+		}
+	}
+
+	uiToolSteps := make([]UiToolStep, len(steps))
+	for index, step := range steps {
+		uiToolSteps[index] = toUiToolStep(step)
+	}
+	return uiToolSteps
+}
+
+func toUiToolStep(step *toolStep) UiToolStep {
+	uiToolStep := UiToolStep{
+		Name:      step.call.ToolName,
+		Arguments: indentJSON(step.call.Arguments)}
+
+	switch {
+	case step.finished == nil && step.running:
+		uiToolStep.Status = "running"
+	case step.finished == nil:
+		uiToolStep.Status = "requested"
+	case step.finished.IsError:
+		uiToolStep.Status = "failed"
+	default:
+		uiToolStep.Status = "done"
+	}
+	if step.finished != nil {
+		uiToolStep.Result = indentJSON(step.finished.Result)
+		uiToolStep.IsError = step.finished.IsError
+		if step.finished.Duration > 0 {
+			uiToolStep.Status += " in " + (time.Duration(step.finished.Duration) * time.Millisecond).String()
+		}
+	}
+
+	return uiToolStep
+}
+
+// indentJSON makes JSON arguments and results readable, other text is kept as it is
+func indentJSON(text string) string {
+	var buffer bytes.Buffer
+	if err := json.Indent(&buffer, []byte(text), "", "  "); err != nil {
+		return text
+	}
+	return buffer.String()
+}
+
 func toUiSession(session chatSession.ChatBlock) UiSession {
 	uiSession := UiSession{
 		SystemMessageContent:    "",
 		UserMessageContent:      "",
 		AssistantMessageContent: "",
+		Attachments:             session.Attachments,
+		Elicitation:             session.Elicitation,
+		Artifacts:               session.Artifacts,
+		Events:                  session.Events,
+		ToolSteps:               toUiToolSteps(session.Events),
+		Branch:                  session.Branch + 1,
+		Branches:                session.Branches,
 		Completed:               session.Completed,
 		Failed:                  session.Failed}
 
@@ -49,6 +156,10 @@ func ToUiSessionResponse(response chatSession.ChatBlockResponse) UiSessionRespon
 		UiSession: toUiSession(response.ChatBlock),
 		New:       response.New}
 
+	if response.ChatBlocks != nil {
+		uiResponse.ChatBlocks = ToUiSessions(response.ChatBlocks)
+	}
+
 	return uiResponse
 }
 
@@ -0,0 +1,52 @@
+package httpHandlers
+
+import (
+	"ai-chat/internal/pkg/agent"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestToUiToolStepsPositive(t *testing.T) {
+	steps := toUiToolSteps([]agent.Event{
+		{Type: agent.EventStepStarted},
+		{Type: agent.EventToolCall, ToolCallID: "call-1", ToolName: "files__read", Arguments: `{"path":"a.txt"}`},
+		{Type: agent.EventToolCall, ToolCallID: "call-2", ToolName: "calculate", Arguments: `{"expression":"6*7"}`},
+		{Type: agent.EventToolStarted, ToolCallID: "call-1", ToolName: "files__read"},
+		{Type: agent.EventToolFinished, ToolCallID: "call-1", ToolName: "files__read", Result: `{"text":"hello"}`, Duration: 1500},
+		{Type: agent.EventToolStarted, ToolCallID: "call-2", ToolName: "calculate"},
+	})
+
+	assert.Equal(t, []UiToolStep{
+		{Name: "files__read", Arguments: "{\n  \"path\": \"a.txt\"\n}", Result: "{\n  \"text\": \"hello\"\n}", Status: "done in 1.5s"},
+		{Name: "calculate", Arguments: "{\n  \"expression\": \"6*7\"\n}", Status: "running"},
+	}, steps)
+}
+
+func TestToUiToolStepsPositiveWithoutIDs(t *testing.T) {
+	// Calls without ids are matched to their results in the order they were made
+	steps := toUiToolSteps([]agent.Event{
+		{Type: agent.EventToolCall, ToolName: "search", Arguments: "first"},
+		{Type: agent.EventToolCall, ToolName: "search", Arguments: "second"},
+		{Type: agent.EventToolStarted, ToolName: "search"},
+		{Type: agent.EventToolFinished, ToolName: "search", Result: "found"},
+		{Type: agent.EventToolStarted, ToolName: "search"},
+		{Type: agent.EventToolFinished, ToolName: "search", Result: "timed out", IsError: true},
+	})
+
+	if assert.Len(t, steps, 2) {
+		assert.Equal(t, UiToolStep{Name: "search", Arguments: "first", Result: "found", Status: "done"}, steps[0])
+		assert.Equal(t, UiToolStep{Name: "search", Arguments: "second", Result: "timed out", IsError: true, Status: "failed"}, steps[1])
+	}
+}
+
+func TestToUiToolStepsNegative(t *testing.T) {
+	assert.Empty(t, toUiToolSteps(nil))
+
+	// Events of unknown calls are ignored, a call that did not start yet is requested
+	steps := toUiToolSteps([]agent.Event{
+		{Type: agent.EventToolFinished, ToolCallID: "call-0", ToolName: "missing", Result: "orphan"},
+		{Type: agent.EventToolCall, ToolCallID: "call-1", ToolName: "calculate", Arguments: "not json"},
+		{Type: agent.EventToolStarted, ToolCallID: "call-1", ToolName: "other"},
+	})
+	assert.Equal(t, []UiToolStep{{Name: "calculate", Arguments: "not json", Status: "requested"}}, steps)
+}
@@ -2,35 +2,244 @@ package mcpConfig
 
 import (
 	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Supported MCP server transports
+const (
+	TransportStdio          = "stdio"
+	TransportSSE            = "sse"
+	TransportStreamableHTTP = "streamable-http"
 )
 
 // MCPServerConfig represents configuration for an MCP server
 type MCPServerConfig struct {
+	Transport     string   `json:"transport,omitempty"`
 	Command       string   `json:"command,omitempty"`
 	Args          []string `json:"args,omitempty"`
 	URL           string   `json:"url,omitempty"`
-	Headers       []string `json:"headers,omitempty"`
+	Headers       []string `json:"headers,omitempty"` // "Name: value" pairs, ${VAR} references are expanded from the environment
 	AllowedTools  []string `json:"allowedTools,omitempty"`
 	ExcludedTools []string `json:"excludedTools,omitempty"`
+
+	// Stdio process settings, Env entries are "NAME=value" where value may be a ${VAR} reference or file:/path
+	Env            []string `json:"env,omitempty"`
+	EnvFile        string   `json:"envFile,omitempty"`
+	Cwd            string   `json:"cwd,omitempty"`
+	InheritEnv     *bool    `json:"inheritEnv,omitempty"`     // defaults to true
+	InheritEnvVars []string `json:"inheritEnvVars,omitempty"` // variables passed through when inheritEnv is false
+
+	// Requests the server may send back while one of its tools runs
+	Sampling           SamplingConfig `json:"sampling,omitempty"`
+	DisableElicitation bool           `json:"disableElicitation,omitempty"`
+
+	// Tool arguments are checked against the input schema before the call, strings holding numbers or booleans are converted
+	DisableValidation bool `json:"disableValidation,omitempty"`
+	DisableCoercion   bool `json:"disableCoercion,omitempty"`
+
+	// Limits and result caching of the server's tool calls, Tools overrides them for single tools by their original name
+	ToolLimits `json:",squash"`
+	ToolCache  `json:",squash"`
+	Tools      map[string]ToolSettings `json:"tools,omitempty"`
+}
+
+// ToolSettings overrides the limits and result caching of the server for a single tool
+type ToolSettings struct {
+	ToolLimits `json:",squash"`
+	ToolCache  `json:",squash"`
+}
+
+// ToolLimits bounds the calls of MCP tools, zero values keep the defaults
+type ToolLimits struct {
+	Timeout          time.Duration `json:"timeout,omitempty"`          // per call, defaults to 2m, negative for none
+	MaxConcurrent    int           `json:"maxConcurrent,omitempty"`    // calls running at once, unlimited by default
+	FailureThreshold int           `json:"failureThreshold,omitempty"` // consecutive failures opening the circuit, defaults to 5
+	OpenDuration     time.Duration `json:"openDuration,omitempty"`     // calls are rejected this long once the circuit opened, defaults to 30s
+}
+
+// Merge returns the limits with the non-zero values of override applied
+func (l ToolLimits) Merge(override ToolLimits) ToolLimits {
+	if override.Timeout != 0 {
+		l.Timeout = override.Timeout
+	}
+	if override.MaxConcurrent != 0 {
+		l.MaxConcurrent = override.MaxConcurrent
+	}
+	if override.FailureThreshold != 0 {
+		l.FailureThreshold = override.FailureThreshold
+	}
+	if override.OpenDuration != 0 {
+		l.OpenDuration = override.OpenDuration
+	}
+	return l
+}
+
+func (l ToolLimits) validate() error {
+	if l.MaxConcurrent < 0 || l.FailureThreshold < 0 || l.OpenDuration < 0 {
+		return fmt.Errorf("maxConcurrent, failureThreshold and openDuration must not be negative")
+	}
+	return nil
+}
+
+// Cache scopes
+const (
+	CacheScopeSession = "session"
+	CacheScopeGlobal  = "global"
+)
+
+// ToolCache enables caching the results of tools that return the same result for the same arguments
+type ToolCache struct {
+	Idempotent *bool         `json:"idempotent,omitempty"` // results are cached when true
+	CacheTTL   time.Duration `json:"cacheTTL,omitempty"`   // how long a result is reused, defaults to 5m
+	CacheScope string        `json:"cacheScope,omitempty"` // session (default) or global
+}
+
+// Merge returns the cache settings with the set values of override applied
+func (c ToolCache) Merge(override ToolCache) ToolCache {
+	if override.Idempotent != nil {
+		c.Idempotent = override.Idempotent
+	}
+	if override.CacheTTL != 0 {
+		c.CacheTTL = override.CacheTTL
+	}
+	if override.CacheScope != "" {
+		c.CacheScope = override.CacheScope
+	}
+	return c
+}
+
+func (c ToolCache) validate() error {
+	if c.CacheTTL < 0 {
+		return fmt.Errorf("cacheTTL must not be negative")
+	}
+	switch c.CacheScope {
+	case "", CacheScopeSession, CacheScopeGlobal:
+	default:
+		return fmt.Errorf("cacheScope must be either session or global, got %s", c.CacheScope)
+	}
+	return nil
+}
+
+// SamplingConfig limits the LLM completions an MCP server may request through the chat session's model
+type SamplingConfig struct {
+	Disabled    bool `json:"disabled,omitempty"`
+	MaxTokens   int  `json:"maxTokens,omitempty"`   // upper bound of the tokens per completion, defaults to 1024
+	MaxRequests int  `json:"maxRequests,omitempty"` // completions per tool call, defaults to 3
+}
+
+// TransportType returns the configured transport, defaulting to stdio for commands and sse for URLs
+func (c MCPServerConfig) TransportType() string {
+	if c.Transport != "" {
+		return c.Transport
+	}
+	if c.Command != "" {
+		return TransportStdio
+	}
+	return TransportSSE
+}
+
+// OpenAPIServiceConfig attaches a REST service described by an OpenAPI 3 document, each operation becomes a tool
+type OpenAPIServiceConfig struct {
+	Spec               string   `json:"spec"`                        // path or http(s) URL of the document
+	BaseURL            string   `json:"baseUrl,omitempty"`           // defaults to the first server of the document
+	Headers            []string `json:"headers,omitempty"`           // "Name: value" pairs, ${VAR} references are expanded from the environment, documents on other hosts than the spec's are fetched without them
+	AllowedOperations  []string `json:"allowedOperations,omitempty"` // operation ids
+	ExcludedOperations []string `json:"excludedOperations,omitempty"`
+
+	// Limits and result caching of the operations like the ones of MCP tools, the timeout defaults to 30s.
+	// Operations overrides them for single operations by their operation id
+	ToolLimits `json:",squash"`
+	ToolCache  `json:",squash"`
+	Operations map[string]ToolSettings `json:"operations,omitempty"`
+}
+
+// ToolSelectionConfig limits the tools offered to the model per turn to the ones most relevant to the user's message,
+// the model can search the full catalog with a meta-tool
+type ToolSelectionConfig struct {
+	MaxTools      int      `json:"max-tools,omitempty"`      // tools offered per turn, every tool is offered when zero
+	AlwaysInclude []string `json:"always-include,omitempty"` // glob patterns on server__tool names, offered on top of max-tools
+}
+
+// ToolPolicyConfig maps users and roles to the tools they may use, tools are matched by glob patterns on their
+// server__tool names, the tools implemented in Go are named builtin__<tool>
+type ToolPolicyConfig struct {
+	UserHeader  string                    `json:"user-header,omitempty"`  // request header with the user authenticated by the proxy in front
+	RolesHeader string                    `json:"roles-header,omitempty"` // request header with comma separated roles
+	Users       map[string][]string       `json:"users,omitempty"`        // roles of users, in addition to the ones of the roles header
+	Roles       map[string]ToolRuleConfig `json:"roles,omitempty"`        // the role "default" applies to everyone
+}
+
+// ToolRuleConfig lists the tools of a role, deny wins over allow of any role
+type ToolRuleConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// ProviderProfileConfig represents configuration for a named OpenAI-compatible provider
+type ProviderProfileConfig struct {
+	BaseURL    string            `json:"base-url,omitempty"`
+	Auth       string            `json:"auth,omitempty"`
+	APIKey     string            `json:"api-key,omitempty"`
+	APIVersion string            `json:"api-version,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+// ModelCapabilityConfig overrides the capabilities of models matching a provider:model glob pattern
+type ModelCapabilityConfig struct {
+	Match         string `json:"match"`
+	Tools         *bool  `json:"tools,omitempty"`
+	Vision        *bool  `json:"vision,omitempty"`
+	Audio         *bool  `json:"audio,omitempty"`
+	ContextLength int    `json:"context-length,omitempty"`
 }
 
 // Config represents the application configuration
 type Config struct {
-	MCPServers      map[string]MCPServerConfig `json:"mcpServers" yaml:"mcpServers"`
-	Model           string                     `json:"model,omitempty" yaml:"model,omitempty"`
-	MaxSteps        int                        `json:"max-steps,omitempty" yaml:"max-steps,omitempty"`
-	MessageWindow   int                        `json:"message-window,omitempty" yaml:"message-window,omitempty"`
-	Debug           bool                       `json:"debug,omitempty" yaml:"debug,omitempty"`
-	SystemPrompt    string                     `json:"system-prompt,omitempty" yaml:"system-prompt,omitempty"`
-	OpenAIAPIKey    string                     `json:"openai-api-key,omitempty" yaml:"openai-api-key,omitempty"`
-	AnthropicAPIKey string                     `json:"anthropic-api-key,omitempty" yaml:"anthropic-api-key,omitempty"`
-	GoogleAPIKey    string                     `json:"google-api-key,omitempty" yaml:"google-api-key,omitempty"`
-	OpenAIURL       string                     `json:"openai-url,omitempty" yaml:"openai-url,omitempty"`
-	AnthropicURL    string                     `json:"anthropic-url,omitempty" yaml:"anthropic-url,omitempty"`
-	Prompt          string                     `json:"prompt,omitempty" yaml:"prompt,omitempty"`
+	MCPServers      map[string]MCPServerConfig      `json:"mcpServers" yaml:"mcpServers"`
+	OpenAPIServices map[string]OpenAPIServiceConfig `json:"openapiServices,omitempty" yaml:"openapiServices,omitempty"`
+	Model           string                          `json:"model,omitempty" yaml:"model,omitempty"`
+	MaxSteps        int                             `json:"max-steps,omitempty" yaml:"max-steps,omitempty"`
+	MessageWindow   int                             `json:"message-window,omitempty" yaml:"message-window,omitempty"`
+	ToolResultLimit int                             `json:"tool-result-limit,omitempty" yaml:"tool-result-limit,omitempty"`
+	ToolSelection   ToolSelectionConfig             `json:"tool-selection,omitempty" yaml:"tool-selection,omitempty"`
+	Debug           bool                            `json:"debug,omitempty" yaml:"debug,omitempty"`
+	SystemPrompt    string                          `json:"system-prompt,omitempty" yaml:"system-prompt,omitempty"`
+	OpenAIAPIKey    string                          `json:"openai-api-key,omitempty" yaml:"openai-api-key,omitempty"`
+	AnthropicAPIKey string                          `json:"anthropic-api-key,omitempty" yaml:"anthropic-api-key,omitempty"`
+	GoogleAPIKey    string                          `json:"google-api-key,omitempty" yaml:"google-api-key,omitempty"`
+	OpenAIURL       string                          `json:"openai-url,omitempty" yaml:"openai-url,omitempty"`
+	AnthropicURL    string                          `json:"anthropic-url,omitempty" yaml:"anthropic-url,omitempty"`
+	Prompt          string                          `json:"prompt,omitempty" yaml:"prompt,omitempty"`
+	OllamaURL       string                          `json:"ollama-url,omitempty" yaml:"ollama-url,omitempty"`
+	OllamaNumCtx    int                             `json:"ollama-num-ctx,omitempty" yaml:"ollama-num-ctx,omitempty"`
+	OllamaKeepAlive string                          `json:"ollama-keep-alive,omitempty" yaml:"ollama-keep-alive,omitempty"`
+	OllamaOptions   map[string]any                  `json:"ollama-options,omitempty" yaml:"ollama-options,omitempty"`
+
+	GoogleBackend            string            `json:"google-backend,omitempty" yaml:"google-backend,omitempty"`
+	GoogleURL                string            `json:"google-url,omitempty" yaml:"google-url,omitempty"`
+	GoogleProject            string            `json:"google-project,omitempty" yaml:"google-project,omitempty"`
+	GoogleLocation           string            `json:"google-location,omitempty" yaml:"google-location,omitempty"`
+	GoogleCredentialsFile    string            `json:"google-credentials-file,omitempty" yaml:"google-credentials-file,omitempty"`
+	GoogleResponseSchema     string            `json:"google-response-schema,omitempty" yaml:"google-response-schema,omitempty"` // JSON text, map keys would be lowercased
+	GoogleResponseSchemaFile string            `json:"google-response-schema-file,omitempty" yaml:"google-response-schema-file,omitempty"`
+	GoogleCodeExecution      bool              `json:"google-code-execution,omitempty" yaml:"google-code-execution,omitempty"`
+	GoogleSafetySettings     map[string]string `json:"google-safety-settings,omitempty" yaml:"google-safety-settings,omitempty"`
+
+	Providers map[string]ProviderProfileConfig `json:"providers,omitempty" yaml:"providers,omitempty"`
+
+	ModelCapabilities []ModelCapabilityConfig `json:"model-capabilities,omitempty" yaml:"model-capabilities,omitempty"`
+
+	ToolPolicy *ToolPolicyConfig `json:"tool-policy,omitempty" yaml:"tool-policy,omitempty"` // every tool is allowed when not set
 }
 
 // Validate validates the configuration
@@ -39,6 +248,129 @@ func (c *Config) Validate() error {
 		if len(serverConfig.AllowedTools) > 0 && len(serverConfig.ExcludedTools) > 0 {
 			return fmt.Errorf("server %s: allowedTools and excludedTools are mutually exclusive", serverName)
 		}
+		switch serverConfig.TransportType() {
+		case TransportStdio:
+			if serverConfig.Command == "" {
+				return fmt.Errorf("server %s: command is required for the stdio transport", serverName)
+			}
+		case TransportSSE, TransportStreamableHTTP:
+			if serverConfig.URL == "" {
+				return fmt.Errorf("server %s: url is required for the %s transport", serverName, serverConfig.TransportType())
+			}
+		default:
+			return fmt.Errorf("server %s: transport must be one of stdio, sse or streamable-http, got %s", serverName, serverConfig.Transport)
+		}
+		if serverConfig.Sampling.MaxTokens < 0 || serverConfig.Sampling.MaxRequests < 0 {
+			return fmt.Errorf("server %s: sampling maxTokens and maxRequests must not be negative", serverName)
+		}
+		if err := serverConfig.ToolLimits.validate(); err != nil {
+			return fmt.Errorf("server %s: %v", serverName, err)
+		}
+		if err := serverConfig.ToolCache.validate(); err != nil {
+			return fmt.Errorf("server %s: %v", serverName, err)
+		}
+		for toolName, toolSettings := range serverConfig.Tools {
+			if err := toolSettings.ToolLimits.validate(); err != nil {
+				return fmt.Errorf("server %s: tool %s: %v", serverName, toolName, err)
+			}
+			if err := toolSettings.ToolCache.validate(); err != nil {
+				return fmt.Errorf("server %s: tool %s: %v", serverName, toolName, err)
+			}
+		}
+		for _, variable := range serverConfig.Env {
+			if name, _, found := strings.Cut(variable, "="); !found || name == "" {
+				return fmt.Errorf("server %s: env entry %q must be in the form NAME=value", serverName, variable)
+			}
+		}
+		for _, header := range serverConfig.Headers {
+			if name, _, found := strings.Cut(header, ":"); !found || strings.TrimSpace(name) == "" {
+				return fmt.Errorf("server %s: header %q must be in the form \"Name: value\"", serverName, header)
+			}
+		}
+	}
+	if c.GoogleResponseSchema != "" && c.GoogleResponseSchemaFile != "" {
+		return fmt.Errorf("google-response-schema and google-response-schema-file are mutually exclusive")
+	}
+	for serviceName, serviceConfig := range c.OpenAPIServices {
+		if _, found := c.MCPServers[serviceName]; found {
+			return fmt.Errorf("openapi service %s: the name is already used by an MCP server", serviceName)
+		}
+		if serviceConfig.Spec == "" {
+			return fmt.Errorf("openapi service %s: spec is required", serviceName)
+		}
+		if len(serviceConfig.AllowedOperations) > 0 && len(serviceConfig.ExcludedOperations) > 0 {
+			return fmt.Errorf("openapi service %s: allowedOperations and excludedOperations are mutually exclusive", serviceName)
+		}
+		for _, header := range serviceConfig.Headers {
+			if name, _, found := strings.Cut(header, ":"); !found || strings.TrimSpace(name) == "" {
+				return fmt.Errorf("openapi service %s: header %q must be in the form \"Name: value\"", serviceName, header)
+			}
+		}
+		if err := serviceConfig.ToolLimits.validate(); err != nil {
+			return fmt.Errorf("openapi service %s: %v", serviceName, err)
+		}
+		if err := serviceConfig.ToolCache.validate(); err != nil {
+			return fmt.Errorf("openapi service %s: %v", serviceName, err)
+		}
+		for operationID, operationSettings := range serviceConfig.Operations {
+			if err := operationSettings.ToolLimits.validate(); err != nil {
+				return fmt.Errorf("openapi service %s: operation %s: %v", serviceName, operationID, err)
+			}
+			if err := operationSettings.ToolCache.validate(); err != nil {
+				return fmt.Errorf("openapi service %s: operation %s: %v", serviceName, operationID, err)
+			}
+		}
+	}
+	if c.GoogleBackend != "" && c.GoogleBackend != "gemini" && c.GoogleBackend != "vertex" {
+		return fmt.Errorf("google-backend must be either gemini or vertex, got %s", c.GoogleBackend)
+	}
+	for providerName, providerConfig := range c.Providers {
+		if providerConfig.BaseURL == "" {
+			return fmt.Errorf("provider %s: base-url is required", providerName)
+		}
+		switch providerConfig.Auth {
+		case "", "bearer", "azure", "none":
+		default:
+			return fmt.Errorf("provider %s: auth must be one of bearer, azure or none, got %s", providerName, providerConfig.Auth)
+		}
+	}
+	for index, capability := range c.ModelCapabilities {
+		if capability.Match == "" {
+			return fmt.Errorf("model-capabilities[%d]: match is required", index)
+		}
+	}
+	if c.ToolSelection.MaxTools < 0 {
+		return fmt.Errorf("tool-selection: max-tools must not be negative")
+	}
+	for _, pattern := range c.ToolSelection.AlwaysInclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("tool-selection: invalid always-include pattern %q", pattern)
+		}
+	}
+	if c.ToolPolicy != nil {
+		if err := c.ToolPolicy.validate(); err != nil {
+			return fmt.Errorf("tool-policy: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *ToolPolicyConfig) validate() error {
+	for roleName, rule := range c.Roles {
+		for _, pattern := range slices.Concat(rule.Allow, rule.Deny) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("role %s: invalid pattern %q", roleName, pattern)
+			}
+		}
+	}
+	for userName, roles := range c.Users {
+		for _, role := range roles {
+			if !slices.ContainsFunc(slices.Collect(maps.Keys(c.Roles)), func(name string) bool {
+				return strings.EqualFold(name, role)
+			}) {
+				return fmt.Errorf("user %s: role %s is not defined", userName, role)
+			}
+		}
 	}
 	return nil
 }
@@ -50,6 +382,46 @@ type SystemPromptConfig struct {
 
 // LoadMCPConfig loads MCP configuration from file
 func LoadMCPConfig(configFile string) (*Config, error) {
+	v, err := readMCPConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return &Config{
+			MCPServers: make(map[string]MCPServerConfig),
+		}, nil
+	}
+
+	return decodeMCPConfig(v)
+}
+
+// WatchMCPConfig calls onChange with the new configuration whenever the configuration file changes,
+// a change that does not parse or validate is logged and skipped
+func WatchMCPConfig(configFile string, onChange func(config *Config)) error {
+	v, err := readMCPConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return fmt.Errorf("no configuration file to watch")
+	}
+
+	v.OnConfigChange(func(event fsnotify.Event) {
+		config, err := decodeMCPConfig(v)
+		if err != nil {
+			log.Error().Err(err).Str("file", event.Name).Msg("MCP configuration reload failed")
+			return
+		}
+		log.Info().Str("file", event.Name).Msg("MCP configuration changed")
+		onChange(config)
+	})
+	v.WatchConfig()
+
+	return nil
+}
+
+// readMCPConfig reads the configuration file into viper, it returns nil when no file exists or can be created
+func readMCPConfig(configFile string) (*viper.Viper, error) {
 	v := viper.New()
 
 	if configFile == "" {
@@ -83,9 +455,7 @@ func LoadMCPConfig(configFile string) (*Config, error) {
 			// Create default config file
 			if err := createDefaultConfig(homeDir); err != nil {
 				// If we can't create the file, just return default config
-				return &Config{
-					MCPServers: make(map[string]MCPServerConfig),
-				}, nil
+				return nil, nil
 			}
 
 			// Try to load the newly created config
@@ -94,9 +464,7 @@ func LoadMCPConfig(configFile string) (*Config, error) {
 			v.AddConfigPath(homeDir)
 			if err := v.ReadInConfig(); err != nil {
 				// If we still can't read it, return default config
-				return &Config{
-					MCPServers: make(map[string]MCPServerConfig),
-				}, nil
+				return nil, nil
 			}
 		}
 	} else {
@@ -107,8 +475,16 @@ func LoadMCPConfig(configFile string) (*Config, error) {
 		}
 	}
 
+	return v, nil
+}
+
+// decodeMCPConfig decodes and validates the configuration read by viper
+func decodeMCPConfig(v *viper.Viper) (*Config, error) {
 	var config Config
-	if err := v.Unmarshal(&config); err != nil {
+	// Decode using the json tags, so hyphenated keys like max-steps are mapped to their fields
+	if err := v.Unmarshal(&config, func(decoderConfig *mapstructure.DecoderConfig) {
+		decoderConfig.TagName = "json"
+	}); err != nil {
 		return nil, fmt.Errorf("error parsing config file: %v", err)
 	}
 
@@ -173,13 +549,66 @@ func createDefaultConfig(homeDir string) error {
 #   sqlite:
 #     command: uvx
 #     args: ["mcp-server-sqlite", "--db-path", "/tmp/example.db"]
+#   github:
+#     command: github-mcp-server
+#     args: ["stdio"]
+#     cwd: "/path/to/workdir"
+#     envFile: "~/.config/github-mcp.env"  # NAME=value lines
+#     env:
+#       - "GITHUB_TOKEN=${GITHUB_TOKEN}"    # Taken from the environment
+#       - "GITHUB_HOST=file:/run/secrets/gh-host" # Read from a file
+#     inheritEnv: false                     # Only PATH, HOME and the like plus inheritEnvVars are passed
+#     inheritEnvVars: ["HTTPS_PROXY"]
+#   remote:
+#     transport: streamable-http        # stdio (default with command), sse (default with url) or streamable-http
+#     url: "https://mcp.example.com/mcp"
+#     headers:
+#       - "Authorization: Bearer ${MCP_TOKEN}"  # Environment variables are expanded
+#     sampling:                         # LLM completions the server requests while its tools run (stdio and streamable-http)
+#       maxTokens: 1024                 # Upper bound per completion
+#       maxRequests: 3                  # Completions per tool call
+#       disabled: false
+#     disableElicitation: false         # Stops the server from asking the user questions
+#     disableValidation: false          # Sends tool arguments without checking them against the input schema
+#     disableCoercion: false            # Rejects "5" for a number instead of converting it
+#     timeout: 2m                       # Per tool call, -1s for none
+#     maxConcurrent: 4                  # Tool calls running at once, unlimited by default
+#     failureThreshold: 5               # Consecutive failed calls before the tool is blocked
+#     openDuration: 30s                 # How long a failing tool is blocked
+#     idempotent: false                 # Reuse results of calls with the same arguments
+#     cacheTTL: 5m                      # How long results are reused
+#     cacheScope: session               # session (default) or global to share results between chats
+#     tools:                            # Overrides for single tools
+#       slow_search:
+#         timeout: 10m
+#         maxConcurrent: 1
+#       lookup:
+#         idempotent: true
 
 mcpServers:
 
+# REST services described by an OpenAPI 3 document, each operation becomes a tool named <service>__<operationId>
+# openapiServices:
+#   calculator:
+#     spec: "http://localhost:8081/openapi.yaml"  # Path or URL of the document
+#     baseUrl: "http://localhost:8081"            # Defaults to the first server of the document
+#     headers:                                    # Sent with the calls and when fetching documents from the spec's host
+#       - "Authorization: Bearer ${CALCULATOR_TOKEN}"
+#     allowedOperations: ["add", "divide"]        # Or excludedOperations
+#     timeout: 30s                                # Per call, limits and caching as for MCP servers
+#     maxConcurrent: 4
+#     operations:                                 # Overrides by operation id
+#       add:
+#         idempotent: true
+
 # Application settings (all optional)
 # model: "anthropic:claude-sonnet-4-20250514"  # Default model to use
 # max-steps: 20                                # Maximum agent steps (0 for unlimited)
 # message-window: 40                           # Number of messages to keep in context
+# tool-result-limit: 20000                     # Characters of a tool result passed to the model (-1 for unlimited)
+# tool-selection:                              # Offer only the tools relevant to the message, the model can search for others
+#   max-tools: 15                              # Tools offered per turn (0 offers all)
+#   always-include: ["builtin__*"]             # <server>__<tool> patterns offered on every turn
 # debug: false                                 # Enable debug logging
 # system-prompt: "/path/to/system-prompt.json" # System prompt file
 
@@ -189,6 +618,67 @@ mcpServers:
 # google-api-key: "your-google-key"
 # openai-url: "https://api.openai.com/v1"
 # anthropic-url: "https://api.anthropic.com"
+
+# Ollama Configuration (OLLAMA_HOST environment variable is used when ollama-url is not set)
+# ollama-url: "http://localhost:11434"
+# ollama-num-ctx: 8192                 # Context window size
+# ollama-keep-alive: "10m"             # How long the model stays loaded after a request
+# ollama-options:                      # Any other Ollama runtime options
+#   temperature: 0.7
+#   num_gpu: 1
+
+# Google Configuration
+# google-backend: "vertex"              # gemini (default, API key) or vertex (GCP project)
+# google-project: "my-gcp-project"      # Vertex AI project, GOOGLE_CLOUD_PROJECT is used when not set
+# google-location: "us-central1"        # Vertex AI location, GOOGLE_CLOUD_LOCATION is used when not set
+# google-credentials-file: "/path/to/service-account.json" # Application default credentials when not set
+# google-code-execution: false          # Let the model run code it writes
+# google-safety-settings:               # Harm category to block threshold
+#   HARM_CATEGORY_HARASSMENT: BLOCK_ONLY_HIGH
+# google-response-schema: |             # Force JSON output matching this OpenAPI schema, given as JSON text
+#   {"type": "object", "properties": {"answer": {"type": "string"}}}
+# google-response-schema-file: "/path/to/schema.json" # Or read the schema from a file
+
+# OpenAI-compatible providers, used as <name>:<model>, e.g. vllm:llama3 or azure:gpt-4o
+# providers:
+#   vllm:
+#     base-url: "http://vllm.internal:8000/v1"
+#     auth: none                          # bearer (default), azure or none
+#   azure:
+#     base-url: "https://my-resource.openai.azure.com"
+#     auth: azure
+#     api-key: "${AZURE_OPENAI_API_KEY}"  # Environment variables are expanded
+#     api-version: "2024-06-01"
+#   openrouter:
+#     base-url: "https://openrouter.ai/api/v1"
+#     api-key: "${OPENROUTER_API_KEY}"
+#     headers:
+#       X-Title: "ricky-bot"
+
+# Tools per user or role, the user and roles are taken from headers set by an authenticating proxy,
+# which must strip these headers from client requests. Patterns match <server>__<tool> names,
+# the tools implemented in Go are builtin__<tool>. The resources and prompt templates of a server are
+# <server>__resources and <server>__prompts. Deny wins over allow of any role.
+# tool-policy:
+#   user-header: "X-Forwarded-User"
+#   roles-header: "X-Forwarded-Groups"     # Comma separated
+#   users:
+#     alice: ["admin"]
+#   roles:
+#     default:                            # Applies to everyone, including requests without a user
+#       allow: ["builtin__*", "calculator__*"]
+#     admin:
+#       allow: ["*"]
+#     contractor:
+#       deny: ["calculator__divide"]
+
+# Model capability overrides, the first matching rule wins over discovered and built-in values
+# model-capabilities:
+#   - match: "ollama:my-finetune*"
+#     tools: true
+#     vision: false
+#     audio: false
+#     context-length: 32768
 `
 
 	_, err = file.WriteString(content)
@@ -0,0 +1,138 @@
+package mcpConfig
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchMCPConfigPositive(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "mcp.config.json")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`{"mcpServers":{"first":{"command":"first-server"}}}`), 0600))
+
+	changes := make(chan *Config, 8)
+	err := WatchMCPConfig(configFile, func(config *Config) {
+		changes <- config
+	})
+	assert.NoError(t, err)
+
+	// An invalid change is skipped, the valid one after it is reported
+	assert.NoError(t, os.WriteFile(configFile, []byte(`{"mcpServers":{"first":{"transport":"carrier-pigeon"}}}`), 0600))
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(configFile, []byte(`{"mcpServers":{"second":{"url":"http://localhost:8080/sse"}}}`), 0600))
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case config := <-changes:
+			if _, found := config.MCPServers["second"]; found {
+				assert.NotContains(t, config.MCPServers, "first")
+				return
+			}
+		case <-timeout:
+			t.Fatal("configuration change was not reported")
+		}
+	}
+}
+
+func TestWatchMCPConfigNegativeMissingFile(t *testing.T) {
+	err := WatchMCPConfig(filepath.Join(t.TempDir(), "missing.json"), func(config *Config) {})
+	assert.ErrorContains(t, err, "error reading config file")
+}
+
+func TestLoadMCPConfigPositiveToolLimits(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "mcp.config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`
+mcpServers:
+  search:
+    command: search-server
+    timeout: 30s
+    maxConcurrent: 2
+    tools:
+      slowSearch:
+        timeout: 10m
+        failureThreshold: 1
+`), 0600))
+
+	config, err := LoadMCPConfig(configFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	serverConfig := config.MCPServers["search"]
+	assert.Equal(t, ToolLimits{Timeout: 30 * time.Second, MaxConcurrent: 2}, serverConfig.ToolLimits)
+	assert.Equal(t, ToolLimits{Timeout: 10 * time.Minute, MaxConcurrent: 2, FailureThreshold: 1},
+		serverConfig.ToolLimits.Merge(serverConfig.Tools["slowsearch"].ToolLimits))
+}
+
+func TestLoadMCPConfigNegativeToolLimits(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "mcp.config.json")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`{"mcpServers":{"search":{"command":"search-server","tools":{"find":{"maxConcurrent":-1}}}}}`), 0600))
+
+	_, err := LoadMCPConfig(configFile)
+	assert.ErrorContains(t, err, "server search: tool find: maxConcurrent")
+}
+
+func TestLoadMCPConfigPositiveToolPolicy(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "mcp.config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`
+mcpServers: {}
+tool-policy:
+  user-header: X-Forwarded-User
+  users:
+    Alice: [Admin]
+  roles:
+    default:
+      allow: ["builtin__*"]
+    Admin:
+      allow: ["*"]
+      deny: ["files__delete*"]
+`), 0600))
+
+	config, err := LoadMCPConfig(configFile)
+	if !assert.NoError(t, err) || !assert.NotNil(t, config.ToolPolicy) {
+		return
+	}
+
+	assert.Equal(t, "X-Forwarded-User", config.ToolPolicy.UserHeader)
+	assert.Equal(t, []string{"Admin"}, config.ToolPolicy.Users["alice"])
+	assert.Equal(t, ToolRuleConfig{Allow: []string{"*"}, Deny: []string{"files__delete*"}}, config.ToolPolicy.Roles["admin"])
+}
+
+func TestLoadMCPConfigNegativeToolPolicy(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "mcp.config.json")
+
+	assert.NoError(t, os.WriteFile(configFile, []byte(`{"mcpServers":{},"tool-policy":{"roles":{"default":{"allow":["files__[a-"]}}}}`), 0600))
+	_, err := LoadMCPConfig(configFile)
+	assert.ErrorContains(t, err, `tool-policy: role default: invalid pattern "files__[a-"`)
+
+	assert.NoError(t, os.WriteFile(configFile, []byte(`{"mcpServers":{},"tool-policy":{"users":{"bob":["ops"]}}}`), 0600))
+	_, err = LoadMCPConfig(configFile)
+	assert.ErrorContains(t, err, "tool-policy: user bob: role ops is not defined")
+}
+
+func TestLoadMCPConfigPositiveGoogleResponseSchema(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "mcp.config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`
+mcpServers: {}
+google-response-schema: |
+  {"type": "object", "properties": {"answerText": {"type": "string"}}}
+`), 0600))
+
+	config, err := LoadMCPConfig(configFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.JSONEq(t, `{"type": "object", "properties": {"answerText": {"type": "string"}}}`, config.GoogleResponseSchema)
+}
+
+func TestLoadMCPConfigNegativeGoogleResponseSchema(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "mcp.config.json")
+	assert.NoError(t, os.WriteFile(configFile,
+		[]byte(`{"mcpServers":{},"google-response-schema":"{}","google-response-schema-file":"schema.json"}`), 0600))
+
+	_, err := LoadMCPConfig(configFile)
+	assert.ErrorContains(t, err, "mutually exclusive")
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"github.com/ollama/ollama/api"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Capabilities describes what a model supports, nil values mean unknown
+type Capabilities struct {
+	Tools         *bool `json:"tools,omitempty"`
+	Vision        *bool `json:"vision,omitempty"`
+	Audio         *bool `json:"audio,omitempty"`
+	ContextLength int   `json:"contextLength,omitempty"`
+}
+
+// CapabilityRule assigns capabilities to models matching a provider:model glob pattern, e.g. "ollama:llama3.1*"
+type CapabilityRule struct {
+	Match        string
+	Capabilities Capabilities
+}
+
+// SupportsTools reports whether the model is not known to lack tool calling support
+func (c Capabilities) SupportsTools() bool {
+	return c.Tools == nil || *c.Tools
+}
+
+// SupportsVision reports whether the model is known to accept images
+func (c Capabilities) SupportsVision() bool {
+	return c.Vision != nil && *c.Vision
+}
+
+// SupportsAudio reports whether the model is known to accept audio
+func (c Capabilities) SupportsAudio() bool {
+	return c.Audio != nil && *c.Audio
+}
+
+// merge fills the unknown values of c from other
+func (c Capabilities) merge(other Capabilities) Capabilities {
+	if c.Tools == nil {
+		c.Tools = other.Tools
+	}
+	if c.Vision == nil {
+		c.Vision = other.Vision
+	}
+	if c.Audio == nil {
+		c.Audio = other.Audio
+	}
+	if c.ContextLength == 0 {
+		c.ContextLength = other.ContextLength
+	}
+	return c
+}
+
+func boolPtr(value bool) *bool {
+	return &value
+}
+
+// builtinCapabilities is checked in order, so more specific patterns must come first
+var builtinCapabilities = []CapabilityRule{
+	{Match: "ollama:llama3.1*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(false), ContextLength: 131072}},
+	{Match: "ollama:llama3.2-vision*", Capabilities: Capabilities{Tools: boolPtr(false), Vision: boolPtr(true), ContextLength: 131072}},
+	{Match: "ollama:llama3.2*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(false), ContextLength: 131072}},
+	{Match: "ollama:llama3.3*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(false), ContextLength: 131072}},
+	{Match: "ollama:llama3*", Capabilities: Capabilities{Tools: boolPtr(false), Vision: boolPtr(false), ContextLength: 8192}},
+	{Match: "ollama:qwen3*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(false), ContextLength: 40960}},
+	{Match: "ollama:qwen2.5vl*", Capabilities: Capabilities{Tools: boolPtr(false), Vision: boolPtr(true), ContextLength: 128000}},
+	{Match: "ollama:qwen2.5*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(false), ContextLength: 32768}},
+	{Match: "ollama:granite3*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(false), ContextLength: 131072}},
+	{Match: "ollama:mistral*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(false), ContextLength: 32768}},
+	{Match: "ollama:gemma3*", Capabilities: Capabilities{Tools: boolPtr(false), Vision: boolPtr(true), ContextLength: 131072}},
+	{Match: "ollama:gemma*", Capabilities: Capabilities{Tools: boolPtr(false), Vision: boolPtr(false), ContextLength: 8192}},
+	{Match: "ollama:llava*", Capabilities: Capabilities{Tools: boolPtr(false), Vision: boolPtr(true), ContextLength: 4096}},
+	{Match: "ollama:deepseek-r1*", Capabilities: Capabilities{Tools: boolPtr(false), Vision: boolPtr(false)}},
+	{Match: "ollama:phi*", Capabilities: Capabilities{Tools: boolPtr(false), Vision: boolPtr(false)}},
+	{Match: "openai:gpt-4o*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(true), ContextLength: 128000}},
+	{Match: "openai:gpt-4.1*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(true), ContextLength: 1047576}},
+	{Match: "openai:gpt-3.5*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(false), ContextLength: 16385}},
+	{Match: "openai:o1-mini*", Capabilities: Capabilities{Tools: boolPtr(false), Vision: boolPtr(false), ContextLength: 128000}},
+	{Match: "openai:o3*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(true), ContextLength: 200000}},
+	{Match: "openai:o4*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(true), ContextLength: 200000}},
+	{Match: "anthropic:claude-*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(true), ContextLength: 200000}},
+	{Match: "google:gemini-*", Capabilities: Capabilities{Tools: boolPtr(true), Vision: boolPtr(true), ContextLength: 1048576}},
+}
+
+// LookupCapabilities returns the capabilities of a provider:model string from the configured rules,
+// with unknown values filled from the built-in table
+func LookupCapabilities(config *ProviderConfig, modelString string) Capabilities {
+	return resolveCapabilities(config, modelString, Capabilities{})
+}
+
+// DiscoverCapabilities returns the capabilities of the configured model, asking the provider where it can tell
+func DiscoverCapabilities(ctx context.Context, config *ProviderConfig) Capabilities {
+	var discovered Capabilities
+	provider, modelName, found := strings.Cut(config.ModelString, ":")
+	if found && provider == "ollama" {
+		if client, err := newOllamaClient(config); err == nil {
+			discovered, _ = discoverOllamaCapabilities(ctx, client, modelName)
+		}
+	}
+
+	return resolveCapabilities(config, config.ModelString, discovered)
+}
+
+// resolveCapabilities gives configured rules precedence over discovered values, which take precedence over the built-in table
+func resolveCapabilities(config *ProviderConfig, modelString string, discovered Capabilities) Capabilities {
+	return findCapabilities(config.Capabilities, modelString).
+		merge(discovered).
+		merge(findCapabilities(builtinCapabilities, modelString))
+}
+
+// findCapabilities returns the capabilities of the first rule matching the model string
+func findCapabilities(rules []CapabilityRule, modelString string) Capabilities {
+	for _, rule := range rules {
+		if matchPattern(rule.Match, modelString) {
+			return rule.Capabilities
+		}
+	}
+	return Capabilities{}
+}
+
+// discoverOllamaCapabilities derives capabilities from the model details reported by Ollama
+func discoverOllamaCapabilities(ctx context.Context, client *api.Client, modelName string) (Capabilities, error) {
+	response, err := client.Show(ctx, &api.ShowRequest{Model: modelName})
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	// Ollama only offers tools to models whose chat template renders them
+	capabilities := Capabilities{
+		Tools:  boolPtr(strings.Contains(response.Template, ".Tools")),
+		Vision: boolPtr(len(response.ProjectorInfo) > 0),
+	}
+	for key, value := range response.ModelInfo {
+		if contextLength, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			capabilities.ContextLength = int(contextLength)
+		}
+	}
+
+	return capabilities, nil
+}
+
+// newOllamaClient creates an Ollama API client for the configured host
+func newOllamaClient(config *ProviderConfig) (*api.Client, error) {
+	baseURL, err := url.Parse(ollamaBaseURL(config))
+	if err != nil {
+		return nil, err
+	}
+	return api.NewClient(baseURL, http.DefaultClient), nil
+}
+
+// matchPattern matches value against a case-insensitive glob pattern where * matches any run of characters
+func matchPattern(pattern string, value string) bool {
+	expression := regexp.QuoteMeta(pattern)
+	expression = strings.ReplaceAll(expression, `\*`, ".*")
+	expression = strings.ReplaceAll(expression, `\?`, ".")
+	matched, err := regexp.MatchString("(?i)^"+expression+"$", value)
+	return err == nil && matched
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ollama/ollama/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupCapabilitiesPositiveBuiltin(t *testing.T) {
+	capabilities := LookupCapabilities(&ProviderConfig{}, "ollama:llama3.2-vision:11b")
+	assert.False(t, capabilities.SupportsTools())
+	assert.True(t, *capabilities.Vision)
+	assert.Equal(t, 131072, capabilities.ContextLength)
+
+	capabilities = LookupCapabilities(&ProviderConfig{}, "ollama:llama3.2:3b")
+	assert.True(t, capabilities.SupportsTools())
+	assert.False(t, *capabilities.Vision)
+}
+
+func TestLookupCapabilitiesPositiveConfiguredOverride(t *testing.T) {
+	config := &ProviderConfig{
+		Capabilities: []CapabilityRule{
+			{Match: "OLLAMA:phi4*", Capabilities: Capabilities{Tools: boolPtr(true)}},
+		},
+	}
+
+	capabilities := LookupCapabilities(config, "ollama:phi4:14b")
+	assert.True(t, capabilities.SupportsTools())
+	assert.False(t, *capabilities.Vision, "unknown values come from the built-in table")
+}
+
+func TestLookupCapabilitiesNegativeUnknownModel(t *testing.T) {
+	capabilities := LookupCapabilities(&ProviderConfig{}, "vllm:my-model")
+	assert.Nil(t, capabilities.Tools)
+	assert.Nil(t, capabilities.Vision)
+	assert.True(t, capabilities.SupportsTools(), "models are assumed to support tools unless known otherwise")
+}
+
+// newOllamaModelsTestServer starts an httptest stand-in for the Ollama list and show APIs
+func newOllamaModelsTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/tags":
+			_ = json.NewEncoder(w).Encode(api.ListResponse{Models: []api.ListModelResponse{
+				{Name: "qwen3:8b"}, {Name: "llava:7b"},
+			}})
+		case "/api/show":
+			var request api.ShowRequest
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			if request.Model == "llava:7b" {
+				_ = json.NewEncoder(w).Encode(api.ShowResponse{
+					Template:      "{{ .Prompt }}",
+					ProjectorInfo: map[string]any{"clip.has_vision_encoder": true},
+					ModelInfo:     map[string]any{"llama.context_length": 4096},
+				})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(api.ShowResponse{
+				Template:  "{{ if .Tools }}{{ .Tools }}{{ end }}",
+				ModelInfo: map[string]any{"qwen3.context_length": 40960},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestDiscoverCapabilitiesPositiveOllama(t *testing.T) {
+	server := newOllamaModelsTestServer(t)
+
+	capabilities := DiscoverCapabilities(context.Background(), &ProviderConfig{
+		ModelString:   "ollama:llava:7b",
+		OllamaBaseURL: server.URL,
+	})
+	assert.False(t, capabilities.SupportsTools())
+	assert.True(t, *capabilities.Vision)
+	assert.Equal(t, 4096, capabilities.ContextLength)
+}
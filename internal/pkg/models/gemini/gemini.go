@@ -10,8 +10,10 @@ import (
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
 	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/google/uuid"
 	"google.golang.org/genai"
 	"runtime/debug"
+	"strings"
 )
 
 var _ model.ToolCallingChatModel = (*ChatModel)(nil)
@@ -144,7 +146,8 @@ func (cm *ChatModel) Generate(ctx context.Context, input []*schema.Message, opts
 		return nil, fmt.Errorf("generate content failed: %w", err)
 	}
 
-	message, err = cm.convertResponse(result)
+	callIndex := 0
+	message, err = cm.convertResponse(result, &callIndex)
 	if err != nil {
 		return nil, fmt.Errorf("convert response failed: %w", err)
 	}
@@ -191,13 +194,16 @@ func (cm *ChatModel) Stream(ctx context.Context, input []*schema.Message, opts .
 			sw.Close()
 		}()
 
+		// Calls of one response may arrive in separate chunks, they are numbered across the stream
+		// so that concatenating the chunks keeps them apart
+		callIndex := 0
 		for resp, err := range cm.cli.Models.GenerateContentStream(ctx, cm.model, contents, config) {
 			if err != nil {
 				sw.Send(nil, err)
 				return
 			}
 
-			message, err := cm.convertResponse(resp)
+			message, err := cm.convertResponse(resp, &callIndex)
 			if err != nil {
 				sw.Send(nil, err)
 				return
@@ -332,6 +338,10 @@ func (cm *ChatModel) buildGenerateConfig(opts ...model.Option) (*genai.GenerateC
 			return nil, nil, err
 		}
 	}
+	if cm.enableCodeExecution {
+		// Full slice expression, so the bound tools are never appended to in place
+		tools = append(tools[:len(tools):len(tools)], &genai.Tool{CodeExecution: &genai.ToolCodeExecution{}})
+	}
 	if len(tools) > 0 {
 		config.Tools = tools
 	}
@@ -476,20 +486,40 @@ func (cm *ChatModel) convertOpenAPISchema(schema *openapi3.Schema) (*genai.Schem
 }
 
 func (cm *ChatModel) convertSchemaMessages(messages []*schema.Message) ([]*genai.Content, error) {
+	// Tool replies reference their call by ID only, so keep track of which function each call belongs to
+	toolCallNames := make(map[string]string)
+
 	var contents []*genai.Content
+	var previousRole schema.RoleType
 	for _, message := range messages {
-		content, err := cm.convertSchemaMessage(message)
+		if message == nil {
+			continue
+		}
+		for _, call := range message.ToolCalls {
+			toolCallNames[call.ID] = call.Function.Name
+		}
+
+		content, err := cm.convertSchemaMessage(message, toolCallNames)
 		if err != nil {
 			return nil, fmt.Errorf("convert schema message failed: %w", err)
 		}
-		if content != nil {
+		if content == nil {
+			continue
+		}
+
+		// Gemini expects the responses to parallel function calls in a single content
+		if message.Role == schema.Tool && previousRole == schema.Tool && len(contents) > 0 {
+			lastContent := contents[len(contents)-1]
+			lastContent.Parts = append(lastContent.Parts, content.Parts...)
+		} else {
 			contents = append(contents, content)
 		}
+		previousRole = message.Role
 	}
 	return contents, nil
 }
 
-func (cm *ChatModel) convertSchemaMessage(message *schema.Message) (*genai.Content, error) {
+func (cm *ChatModel) convertSchemaMessage(message *schema.Message, toolCallNames map[string]string) (*genai.Content, error) {
 	if message == nil {
 		return nil, nil
 	}
@@ -500,11 +530,14 @@ func (cm *ChatModel) convertSchemaMessage(message *schema.Message) (*genai.Conte
 	if message.ToolCalls != nil {
 		for _, call := range message.ToolCalls {
 			var args map[string]any
-			if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
-				return nil, fmt.Errorf("unmarshal tool call arguments failed: %w", err)
+			if call.Function.Arguments != "" {
+				if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+					return nil, fmt.Errorf("unmarshal tool call arguments failed: %w", err)
+				}
 			}
 			parts = append(parts, &genai.Part{
 				FunctionCall: &genai.FunctionCall{
+					ID:   toGeminiToolCallID(call.ID),
 					Name: call.Function.Name,
 					Args: args,
 				},
@@ -523,7 +556,8 @@ func (cm *ChatModel) convertSchemaMessage(message *schema.Message) (*genai.Conte
 		}
 		parts = append(parts, &genai.Part{
 			FunctionResponse: &genai.FunctionResponse{
-				Name:     message.ToolCallID,
+				ID:       toGeminiToolCallID(message.ToolCallID),
+				Name:     toolResponseName(message, toolCallNames),
 				Response: response,
 			},
 		})
@@ -588,6 +622,31 @@ func (cm *ChatModel) convertSchemaMessage(message *schema.Message) (*genai.Conte
 	}, nil
 }
 
+// newToolCallID generates a unique ID for a function call returned without one
+func newToolCallID() string {
+	return generatedToolCallIDPrefix + uuid.NewString()
+}
+
+// toGeminiToolCallID returns the call ID to send back to Gemini, IDs generated locally are unknown to the API
+func toGeminiToolCallID(toolCallID string) string {
+	if strings.HasPrefix(toolCallID, generatedToolCallIDPrefix) {
+		return ""
+	}
+	return toolCallID
+}
+
+// toolResponseName resolves the function name a tool message responds to
+func toolResponseName(message *schema.Message, toolCallNames map[string]string) string {
+	if name, ok := toolCallNames[message.ToolCallID]; ok && name != "" {
+		return name
+	}
+	if message.ToolName != "" {
+		return message.ToolName
+	}
+	// Older histories used the function name as the call ID
+	return message.ToolCallID
+}
+
 func (cm *ChatModel) convertRole(role schema.RoleType) genai.Role {
 	switch role {
 	case schema.Assistant:
@@ -601,7 +660,8 @@ func (cm *ChatModel) convertRole(role schema.RoleType) genai.Role {
 	}
 }
 
-func (cm *ChatModel) convertResponse(resp *genai.GenerateContentResponse) (*schema.Message, error) {
+// convertResponse converts a response or a streamed chunk, callIndex is the index of the next function call
+func (cm *ChatModel) convertResponse(resp *genai.GenerateContentResponse, callIndex *int) (*schema.Message, error) {
 	if len(resp.Candidates) == 0 {
 		return nil, fmt.Errorf("gemini result is empty")
 	}
@@ -634,13 +694,22 @@ func (cm *ChatModel) convertResponse(resp *genai.GenerateContentResponse) (*sche
 			if err != nil {
 				return nil, fmt.Errorf("marshal function call arguments failed: %w", err)
 			}
+			// Gemini does not always populate call IDs, and the function name alone
+			// is ambiguous when the same function is called more than once
+			toolCallID := part.FunctionCall.ID
+			if toolCallID == "" {
+				toolCallID = newToolCallID()
+			}
 			message.ToolCalls = append(message.ToolCalls, schema.ToolCall{
-				ID: part.FunctionCall.Name,
+				Index: genai.Ptr(*callIndex),
+				ID:    toolCallID,
+				Type:  toolCallType,
 				Function: schema.FunctionCall{
 					Name:      part.FunctionCall.Name,
 					Arguments: string(args),
 				},
 			})
+			*callIndex++
 		case part.ExecutableCode != nil:
 			textParts = append(textParts, part.ExecutableCode.Code)
 		case part.CodeExecutionResult != nil:
@@ -684,6 +753,11 @@ func (cm *ChatModel) IsCallbacksEnabled() bool {
 
 const typ = "Gemini"
 
+const (
+	toolCallType              = "function"
+	generatedToolCallIDPrefix = "gemini-call-"
+)
+
 func (cm *ChatModel) GetType() string {
 	return typ
 }
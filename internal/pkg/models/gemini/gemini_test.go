@@ -0,0 +1,290 @@
+package gemini
+
+import (
+	"ai-chat/internal/pkg/models/genaiTest"
+	"cloud.google.com/go/auth"
+	"context"
+	"errors"
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genai"
+	"io"
+	"strings"
+	"testing"
+)
+
+type staticTokenProvider struct{}
+
+func (staticTokenProvider) Token(context.Context) (*auth.Token, error) {
+	return &auth.Token{Value: "test-token", Type: "Bearer"}, nil
+}
+
+func newFunctionCallResponse(calls ...*genai.FunctionCall) *genai.GenerateContentResponse {
+	parts := make([]*genai.Part, len(calls))
+	for i, call := range calls {
+		parts[i] = &genai.Part{FunctionCall: call}
+	}
+
+	return &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{
+			{Content: &genai.Content{Role: string(genai.RoleModel), Parts: parts}},
+		},
+	}
+}
+
+func TestConvertResponsePositiveRepeatedFunctionCalls(t *testing.T) {
+	cm := &ChatModel{}
+
+	message, err := cm.convertResponse(newFunctionCallResponse(
+		&genai.FunctionCall{Name: "calculator__add", Args: map[string]any{"a": 1.0, "b": 2.0}},
+		&genai.FunctionCall{Name: "calculator__add", Args: map[string]any{"a": 3.0, "b": 4.0}},
+	), new(int))
+	assert.NoError(t, err)
+	assert.Len(t, message.ToolCalls, 2)
+
+	first, second := message.ToolCalls[0], message.ToolCalls[1]
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.True(t, strings.HasPrefix(first.ID, generatedToolCallIDPrefix))
+	assert.True(t, strings.HasPrefix(second.ID, generatedToolCallIDPrefix))
+	assert.Equal(t, "calculator__add", first.Function.Name)
+	assert.Equal(t, "calculator__add", second.Function.Name)
+	assert.JSONEq(t, `{"a":1,"b":2}`, first.Function.Arguments)
+	assert.JSONEq(t, `{"a":3,"b":4}`, second.Function.Arguments)
+	assert.Equal(t, 0, *first.Index)
+	assert.Equal(t, 1, *second.Index)
+}
+
+func TestStreamPositiveFunctionCallsInSeparateChunks(t *testing.T) {
+	server := genaiTest.NewStreamServer(t,
+		[]map[string]any{{"functionCall": map[string]any{"name": "calculator__add", "args": map[string]any{"a": 1, "b": 2}}}},
+		[]map[string]any{{"functionCall": map[string]any{"name": "calculator__multiply", "args": map[string]any{"a": 3, "b": 4}}}},
+	)
+
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		Backend:     genai.BackendGeminiAPI,
+		APIKey:      "test-key",
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	assert.NoError(t, err)
+
+	cm, err := NewChatModel(context.Background(), &Config{Client: client, Model: "gemini-2.0-flash"})
+	assert.NoError(t, err)
+
+	stream, err := cm.Stream(context.Background(), []*schema.Message{schema.UserMessage("add 1 and 2, multiply 3 by 4")})
+	assert.NoError(t, err)
+
+	var chunks []*schema.Message
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+	assert.Len(t, chunks, 2)
+
+	message, err := schema.ConcatMessages(chunks)
+	assert.NoError(t, err)
+	assert.Len(t, message.ToolCalls, 2)
+	assert.Equal(t, "calculator__add", message.ToolCalls[0].Function.Name)
+	assert.Equal(t, "calculator__multiply", message.ToolCalls[1].Function.Name)
+	assert.NotEqual(t, message.ToolCalls[0].ID, message.ToolCalls[1].ID)
+	assert.Equal(t, 0, *message.ToolCalls[0].Index)
+	assert.Equal(t, 1, *message.ToolCalls[1].Index)
+}
+
+func TestConvertResponsePositiveServerCallID(t *testing.T) {
+	cm := &ChatModel{}
+
+	message, err := cm.convertResponse(newFunctionCallResponse(
+		&genai.FunctionCall{ID: "server-id-1", Name: "calculator__add", Args: map[string]any{}},
+	), new(int))
+	assert.NoError(t, err)
+	assert.Len(t, message.ToolCalls, 1)
+	assert.Equal(t, "server-id-1", message.ToolCalls[0].ID)
+}
+
+func TestConvertSchemaMessagesPositiveParallelCalls(t *testing.T) {
+	cm := &ChatModel{}
+
+	response, err := cm.convertResponse(newFunctionCallResponse(
+		&genai.FunctionCall{Name: "calculator__add", Args: map[string]any{"a": 1.0, "b": 2.0}},
+		&genai.FunctionCall{Name: "calculator__multiply", Args: map[string]any{"a": 3.0, "b": 4.0}},
+	), new(int))
+	assert.NoError(t, err)
+
+	// Replies arrive out of order and without tool names, they must map back by call ID
+	messages := []*schema.Message{
+		schema.UserMessage("add 1 and 2, multiply 3 by 4"),
+		response,
+		schema.ToolMessage(`{"result":12}`, response.ToolCalls[1].ID),
+		schema.ToolMessage(`{"result":3}`, response.ToolCalls[0].ID),
+	}
+
+	contents, err := cm.convertSchemaMessages(messages)
+	assert.NoError(t, err)
+	assert.Len(t, contents, 3)
+
+	assert.Equal(t, string(genai.RoleModel), contents[1].Role)
+	assert.Len(t, contents[1].Parts, 2)
+	assert.Equal(t, "calculator__add", contents[1].Parts[0].FunctionCall.Name)
+	assert.Empty(t, contents[1].Parts[0].FunctionCall.ID)
+	assert.Equal(t, "calculator__multiply", contents[1].Parts[1].FunctionCall.Name)
+
+	assert.Equal(t, string(genai.RoleUser), contents[2].Role)
+	assert.Len(t, contents[2].Parts, 2)
+	assert.Equal(t, "calculator__multiply", contents[2].Parts[0].FunctionResponse.Name)
+	assert.Equal(t, map[string]any{"result": 12.0}, contents[2].Parts[0].FunctionResponse.Response)
+	assert.Equal(t, "calculator__add", contents[2].Parts[1].FunctionResponse.Name)
+	assert.Equal(t, map[string]any{"result": 3.0}, contents[2].Parts[1].FunctionResponse.Response)
+}
+
+func TestConvertSchemaMessagesPositiveRepeatedCallsAcrossSteps(t *testing.T) {
+	cm := &ChatModel{}
+
+	firstResponse, err := cm.convertResponse(newFunctionCallResponse(
+		&genai.FunctionCall{Name: "calculator__add", Args: map[string]any{"a": 1.0, "b": 2.0}},
+	), new(int))
+	assert.NoError(t, err)
+
+	secondResponse, err := cm.convertResponse(newFunctionCallResponse(
+		&genai.FunctionCall{Name: "calculator__add", Args: map[string]any{"a": 3.0, "b": 3.0}},
+	), new(int))
+	assert.NoError(t, err)
+	assert.NotEqual(t, firstResponse.ToolCalls[0].ID, secondResponse.ToolCalls[0].ID)
+
+	messages := []*schema.Message{
+		schema.UserMessage("add 1 and 2, then add 3 to the result"),
+		firstResponse,
+		schema.ToolMessage("3.00", firstResponse.ToolCalls[0].ID),
+		secondResponse,
+		schema.ToolMessage("6.00", secondResponse.ToolCalls[0].ID),
+	}
+
+	contents, err := cm.convertSchemaMessages(messages)
+	assert.NoError(t, err)
+	assert.Len(t, contents, 5)
+
+	for _, index := range []int{2, 4} {
+		assert.Len(t, contents[index].Parts, 1)
+		assert.Equal(t, "calculator__add", contents[index].Parts[0].FunctionResponse.Name)
+	}
+	assert.Equal(t, map[string]any{"error": "3.00"}, contents[2].Parts[0].FunctionResponse.Response)
+	assert.Equal(t, map[string]any{"error": "6.00"}, contents[4].Parts[0].FunctionResponse.Response)
+}
+
+func TestConvertSchemaMessagesPositiveServerCallIDRoundTrip(t *testing.T) {
+	cm := &ChatModel{}
+
+	messages := []*schema.Message{
+		schema.UserMessage("add 1 and 2"),
+		schema.AssistantMessage("", []schema.ToolCall{
+			{ID: "server-id-1", Function: schema.FunctionCall{Name: "calculator__add", Arguments: `{"a":1,"b":2}`}},
+		}),
+		schema.ToolMessage(`{"result":3}`, "server-id-1"),
+	}
+
+	contents, err := cm.convertSchemaMessages(messages)
+	assert.NoError(t, err)
+	assert.Len(t, contents, 3)
+	assert.Equal(t, "server-id-1", contents[1].Parts[0].FunctionCall.ID)
+	assert.Equal(t, "server-id-1", contents[2].Parts[0].FunctionResponse.ID)
+	assert.Equal(t, "calculator__add", contents[2].Parts[0].FunctionResponse.Name)
+}
+
+func TestConvertSchemaMessagesPositiveToolNameFallback(t *testing.T) {
+	cm := &ChatModel{}
+
+	messages := []*schema.Message{
+		schema.ToolMessage(`{"result":3}`, "unknown-call", schema.WithToolName("calculator__add")),
+		schema.ToolMessage(`{"result":4}`, "calculator__subtract"),
+	}
+
+	contents, err := cm.convertSchemaMessages(messages)
+	assert.NoError(t, err)
+	assert.Len(t, contents, 1)
+	assert.Equal(t, "calculator__add", contents[0].Parts[0].FunctionResponse.Name)
+	assert.Equal(t, "calculator__subtract", contents[0].Parts[1].FunctionResponse.Name)
+}
+
+func TestGeneratePositiveGeminiBackendStructuredOutput(t *testing.T) {
+	var lastRequest genaiTest.Request
+	server := genaiTest.NewServer(t, &lastRequest, map[string]any{"text": `{"answer":"42"}`})
+
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test-key",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	assert.NoError(t, err)
+
+	cm, err := NewChatModel(context.Background(), &Config{
+		Client: client,
+		Model:  "gemini-2.0-flash",
+		ResponseSchema: &openapi3.Schema{
+			Type:       openapi3.TypeObject,
+			Properties: openapi3.Schemas{"answer": openapi3.NewStringSchema().NewRef()},
+			Required:   []string{"answer"},
+		},
+		EnableCodeExecution: true,
+		SafetySettings: []*genai.SafetySetting{
+			{Category: genai.HarmCategoryHarassment, Threshold: genai.HarmBlockThresholdBlockOnlyHigh},
+		},
+	})
+	assert.NoError(t, err)
+
+	message, err := cm.Generate(context.Background(), []*schema.Message{
+		schema.SystemMessage("Answer in JSON"),
+		schema.UserMessage("What is the answer?"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"answer":"42"}`, message.Content)
+	assert.Equal(t, 15, message.ResponseMeta.Usage.TotalTokens)
+
+	assert.Equal(t, "/v1beta/models/gemini-2.0-flash:generateContent", lastRequest.Path)
+	assert.Equal(t, "test-key", lastRequest.APIKey)
+
+	generationConfig := lastRequest.Body["generationConfig"].(map[string]any)
+	assert.Equal(t, "application/json", generationConfig["responseMimeType"])
+	assert.Equal(t, map[string]any{
+		"type":       "OBJECT",
+		"properties": map[string]any{"answer": map[string]any{"type": "STRING"}},
+		"required":   []any{"answer"},
+	}, generationConfig["responseSchema"])
+	assert.Equal(t, []any{map[string]any{"codeExecution": map[string]any{}}}, lastRequest.Body["tools"])
+	assert.Equal(t, []any{map[string]any{
+		"category":  "HARM_CATEGORY_HARASSMENT",
+		"threshold": "BLOCK_ONLY_HIGH",
+	}}, lastRequest.Body["safetySettings"])
+}
+
+func TestGeneratePositiveVertexBackendFunctionCall(t *testing.T) {
+	var lastRequest genaiTest.Request
+	server := genaiTest.NewServer(t, &lastRequest, map[string]any{
+		"functionCall": map[string]any{"name": "calculator__add", "args": map[string]any{"a": 1, "b": 2}},
+	})
+
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		Backend:     genai.BackendVertexAI,
+		Project:     "test-project",
+		Location:    "europe-west4",
+		Credentials: auth.NewCredentials(&auth.CredentialsOptions{TokenProvider: staticTokenProvider{}}),
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	assert.NoError(t, err)
+
+	cm, err := NewChatModel(context.Background(), &Config{Client: client, Model: "gemini-2.0-flash"})
+	assert.NoError(t, err)
+
+	message, err := cm.Generate(context.Background(), []*schema.Message{schema.UserMessage("add 1 and 2")})
+	assert.NoError(t, err)
+	assert.Len(t, message.ToolCalls, 1)
+	assert.Equal(t, "calculator__add", message.ToolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"a":1,"b":2}`, message.ToolCalls[0].Function.Arguments)
+
+	assert.Equal(t, "/v1beta1/projects/test-project/locations/europe-west4/publishers/google/models/gemini-2.0-flash:generateContent", lastRequest.Path)
+	assert.Equal(t, "Bearer test-token", lastRequest.Authorization)
+	assert.NotContains(t, lastRequest.Body, "tools")
+}
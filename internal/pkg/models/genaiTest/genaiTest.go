@@ -0,0 +1,80 @@
+// Package genaiTest provides local fakes of the genai API for the tests of the Google model providers
+package genaiTest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Request is what the fake genai API recorded about the last request
+type Request struct {
+	Path          string
+	APIKey        string
+	Authorization string
+	Body          map[string]any
+}
+
+// NewServer starts a local fake of the generateContent API, answering with the given parts
+func NewServer(t *testing.T, lastRequest *Request, parts ...map[string]any) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":generateContent") {
+			http.NotFound(w, r)
+			return
+		}
+
+		lastRequest.Path = r.URL.Path
+		lastRequest.APIKey = r.Header.Get("x-goog-api-key")
+		lastRequest.Authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&lastRequest.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"candidates": []any{
+				map[string]any{
+					"content":      map[string]any{"role": "model", "parts": parts},
+					"finishReason": "STOP",
+				},
+			},
+			"usageMetadata": map[string]any{
+				"promptTokenCount":     10,
+				"candidatesTokenCount": 5,
+				"totalTokenCount":      15,
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// NewStreamServer starts a local fake of the streamGenerateContent API, sending one chunk per parts
+func NewStreamServer(t *testing.T, chunks ...[]map[string]any) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, parts := range chunks {
+			data, _ := json.Marshal(map[string]any{
+				"candidates": []any{map[string]any{"content": map[string]any{"role": "model", "parts": parts}}},
+			})
+			_, _ = fmt.Fprintf(w, "data: %s\r\n\r\n", data)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/genai"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultOpenAIBaseURL    = "https://api.openai.com/v1"
+	defaultAnthropicBaseURL = "https://api.anthropic.com"
+	anthropicAPIVersion     = "2023-06-01"
+)
+
+// ModelInfo describes a model offered by a provider
+type ModelInfo struct {
+	Model        string       `json:"model"` // provider:model string accepted by CreateProvider
+	Name         string       `json:"name"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// ProviderModels holds the models of one provider, Error is set when the provider could not be listed
+type ProviderModels struct {
+	Provider string      `json:"provider"`
+	Models   []ModelInfo `json:"models"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// modelLister returns the models of a provider with whatever capabilities the provider reports
+type modelLister func(ctx context.Context, config *ProviderConfig) ([]ModelInfo, error)
+
+// ListModels lists the models of every configured provider, a failing provider is reported in its Error field
+func ListModels(ctx context.Context, config *ProviderConfig) []ProviderModels {
+	var result []ProviderModels
+
+	profileNames := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		profileNames = append(profileNames, name)
+	}
+	sort.Strings(profileNames)
+	for _, name := range profileNames {
+		profile := config.Profiles[name]
+		result = append(result, listProviderModels(ctx, config, name, func(ctx context.Context, _ *ProviderConfig) ([]ModelInfo, error) {
+			return listProfileModels(ctx, profile)
+		}))
+	}
+
+	if !hasProfile(config, "ollama") {
+		result = append(result, listProviderModels(ctx, config, "ollama", listOllamaModels))
+	}
+	if !hasProfile(config, "openai") && openAIAPIKey(config) != "" {
+		result = append(result, listProviderModels(ctx, config, "openai", listOpenAIModels))
+	}
+	if !hasProfile(config, "anthropic") && anthropicAPIKey(config) != "" {
+		result = append(result, listProviderModels(ctx, config, "anthropic", listAnthropicModels))
+	}
+	if !hasProfile(config, "google") && (googleAPIKey(config) != "" || config.GoogleBackend == googleBackendVertex) {
+		result = append(result, listProviderModels(ctx, config, "google", listGoogleModels))
+	}
+
+	return result
+}
+
+// hasProfile reports whether a profile overrides the built-in provider of the same name
+func hasProfile(config *ProviderConfig, name string) bool {
+	_, found := findProfile(config.Profiles, name)
+	return found
+}
+
+// listProviderModels runs a lister and completes the capabilities of its models
+func listProviderModels(ctx context.Context, config *ProviderConfig, provider string, lister modelLister) ProviderModels {
+	providerModels := ProviderModels{Provider: provider, Models: []ModelInfo{}}
+
+	models, err := lister(ctx, config)
+	if err != nil {
+		providerModels.Error = err.Error()
+		return providerModels
+	}
+
+	for _, info := range models {
+		info.Model = provider + ":" + info.Name
+		info.Capabilities = resolveCapabilities(config, info.Model, info.Capabilities)
+		providerModels.Models = append(providerModels.Models, info)
+	}
+	sort.Slice(providerModels.Models, func(i, j int) bool {
+		return providerModels.Models[i].Name < providerModels.Models[j].Name
+	})
+
+	return providerModels
+}
+
+func listOllamaModels(ctx context.Context, config *ProviderConfig) ([]ModelInfo, error) {
+	client, err := newOllamaClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, 0, len(response.Models))
+	for _, model := range response.Models {
+		// A model whose details cannot be read is still listed, its capabilities come from the tables
+		capabilities, _ := discoverOllamaCapabilities(ctx, client, model.Name)
+		models = append(models, ModelInfo{Name: model.Name, Capabilities: capabilities})
+	}
+	return models, nil
+}
+
+func listOpenAIModels(ctx context.Context, config *ProviderConfig) ([]ModelInfo, error) {
+	baseURL := config.OpenAIBaseURL
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+openAIAPIKey(config))
+	return fetchModelIDs(ctx, strings.TrimSuffix(baseURL, "/")+"/models", headers)
+}
+
+func listAnthropicModels(ctx context.Context, config *ProviderConfig) ([]ModelInfo, error) {
+	baseURL := config.AnthropicBaseURL
+	if baseURL == "" {
+		baseURL = defaultAnthropicBaseURL
+	}
+
+	headers := http.Header{}
+	headers.Set("x-api-key", anthropicAPIKey(config))
+	headers.Set("anthropic-version", anthropicAPIVersion)
+	return fetchModelIDs(ctx, strings.TrimSuffix(baseURL, "/")+"/v1/models", headers)
+}
+
+func listProfileModels(ctx context.Context, profile ProviderProfile) ([]ModelInfo, error) {
+	if profile.Auth == ProfileAuthAzure {
+		return nil, fmt.Errorf("model listing is not supported for Azure deployments")
+	}
+
+	headers := profileHeaders(profile)
+	if apiKey := os.ExpandEnv(profile.APIKey); apiKey != "" && profile.Auth != ProfileAuthNone {
+		headers.Set("Authorization", "Bearer "+apiKey)
+	}
+	return fetchModelIDs(ctx, strings.TrimSuffix(profile.BaseURL, "/")+"/models", headers)
+}
+
+func listGoogleModels(ctx context.Context, config *ProviderConfig) ([]ModelInfo, error) {
+	clientConfig, err := createGoogleClientConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := genai.NewClient(ctx, clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google client: %w", err)
+	}
+
+	var models []ModelInfo
+	for model, err := range client.Models.All(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		if len(model.SupportedActions) > 0 && !slices.Contains(model.SupportedActions, "generateContent") {
+			continue
+		}
+		models = append(models, ModelInfo{
+			Name:         strings.TrimPrefix(model.Name, "models/"),
+			Capabilities: Capabilities{ContextLength: int(model.InputTokenLimit)},
+		})
+	}
+	return models, nil
+}
+
+// fetchModelIDs reads an OpenAI or Anthropic style model listing of the form {"data":[{"id":"..."}]}
+func fetchModelIDs(ctx context.Context, url string, headers http.Header) ([]ModelInfo, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		request.Header[name] = values
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("model listing failed: %s", response.Status)
+	}
+
+	var listing struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("invalid model listing: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(listing.Data))
+	for _, model := range listing.Data {
+		models = append(models, ModelInfo{Name: model.ID})
+	}
+	return models, nil
+}
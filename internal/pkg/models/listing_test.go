@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListModelsPositiveOllamaAndProfile(t *testing.T) {
+	ollamaServer := newOllamaModelsTestServer(t)
+
+	var authorization, title string
+	profileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		title = r.Header.Get("X-Title")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"llama3.1-70b"},{"id":"codestral"}]}`))
+	}))
+	t.Cleanup(profileServer.Close)
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("GOOGLE_API_KEY", "")
+	t.Setenv("GEMINI_API_KEY", "")
+	t.Setenv("TEST_ROUTER_KEY", "router-key")
+
+	providers := ListModels(context.Background(), &ProviderConfig{
+		OllamaBaseURL: ollamaServer.URL,
+		Profiles: map[string]ProviderProfile{
+			"router": {
+				BaseURL: profileServer.URL + "/v1/",
+				APIKey:  "${TEST_ROUTER_KEY}",
+				Headers: map[string]string{"X-Title": "ricky-bot"},
+			},
+		},
+		Capabilities: []CapabilityRule{
+			{Match: "router:codestral", Capabilities: Capabilities{Tools: boolPtr(false)}},
+		},
+	})
+
+	if assert.Len(t, providers, 2) {
+		assert.Equal(t, "router", providers[0].Provider)
+		assert.Empty(t, providers[0].Error)
+		assert.Equal(t, []ModelInfo{
+			{Model: "router:codestral", Name: "codestral", Capabilities: Capabilities{Tools: boolPtr(false)}},
+			{Model: "router:llama3.1-70b", Name: "llama3.1-70b"},
+		}, providers[0].Models)
+		assert.Equal(t, "Bearer router-key", authorization)
+		assert.Equal(t, "ricky-bot", title)
+
+		assert.Equal(t, "ollama", providers[1].Provider)
+		assert.Empty(t, providers[1].Error)
+		if assert.Len(t, providers[1].Models, 2) {
+			llava := providers[1].Models[0]
+			assert.Equal(t, "ollama:llava:7b", llava.Model)
+			assert.False(t, llava.Capabilities.SupportsTools())
+			assert.True(t, *llava.Capabilities.Vision)
+
+			qwen := providers[1].Models[1]
+			assert.Equal(t, "ollama:qwen3:8b", qwen.Model)
+			assert.True(t, qwen.Capabilities.SupportsTools())
+			assert.Equal(t, 40960, qwen.Capabilities.ContextLength)
+		}
+	}
+}
+
+func TestListModelsNegativeUnreachableProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("GOOGLE_API_KEY", "")
+	t.Setenv("GEMINI_API_KEY", "")
+
+	providers := ListModels(context.Background(), &ProviderConfig{
+		OllamaBaseURL: server.URL,
+		OpenAIAPIKey:  "bad-key",
+		OpenAIBaseURL: server.URL,
+	})
+
+	if assert.Len(t, providers, 2) {
+		assert.Equal(t, "ollama", providers[0].Provider)
+		assert.NotEmpty(t, providers[0].Error)
+		assert.Equal(t, "openai", providers[1].Provider)
+		assert.Equal(t, "model listing failed: 401 Unauthorized", providers[1].Error)
+		assert.Empty(t, providers[1].Models)
+	}
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Supported authentication styles of provider profiles
+const (
+	ProfileAuthBearer = "bearer"
+	ProfileAuthAzure  = "azure"
+	ProfileAuthNone   = "none"
+)
+
+// ProviderProfile describes a named OpenAI-compatible provider (Azure OpenAI, OpenRouter, vLLM, LM Studio, ...)
+// selected by the provider part of the model string, e.g. "vllm:llama3"
+type ProviderProfile struct {
+	BaseURL    string
+	Auth       string // bearer (default), azure or none
+	APIKey     string // optional, ${VAR} references are expanded from the environment
+	APIVersion string // Azure API version
+	Headers    map[string]string
+}
+
+// headerTransport adds fixed headers to every request
+type headerTransport struct {
+	headers http.Header
+	base    http.RoundTripper
+}
+
+// RoundTrip sets the configured headers on a copy of the request
+func (t *headerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	for name, values := range t.headers {
+		request.Header[name] = values
+	}
+	return t.base.RoundTrip(request)
+}
+
+// findProfile looks up a profile by name, case-insensitively as the config loader may lower-case map keys
+func findProfile(profiles map[string]ProviderProfile, name string) (ProviderProfile, bool) {
+	if profile, ok := profiles[name]; ok {
+		return profile, true
+	}
+	for profileName, profile := range profiles {
+		if strings.EqualFold(profileName, name) {
+			return profile, true
+		}
+	}
+	return ProviderProfile{}, false
+}
+
+func createProfileProvider(ctx context.Context, profileName string, profile ProviderProfile, modelName string) (model.ToolCallingChatModel, error) {
+	if profile.BaseURL == "" {
+		return nil, fmt.Errorf("provider %s: base URL not provided", profileName)
+	}
+
+	openaiConfig := &openai.ChatModelConfig{
+		BaseURL: profile.BaseURL,
+		Model:   modelName,
+	}
+
+	apiKey := os.ExpandEnv(profile.APIKey)
+	switch profile.Auth {
+	case "", ProfileAuthBearer:
+		openaiConfig.APIKey = apiKey
+	case ProfileAuthAzure:
+		if apiKey == "" {
+			return nil, fmt.Errorf("provider %s: API key is required for azure auth", profileName)
+		}
+		openaiConfig.ByAzure = true
+		openaiConfig.APIKey = apiKey
+		openaiConfig.APIVersion = profile.APIVersion
+	case ProfileAuthNone:
+	default:
+		return nil, fmt.Errorf("provider %s: unsupported auth %s", profileName, profile.Auth)
+	}
+
+	if len(profile.Headers) > 0 {
+		openaiConfig.HTTPClient = &http.Client{
+			Transport: &headerTransport{headers: profileHeaders(profile), base: http.DefaultTransport},
+		}
+	}
+
+	return openai.NewChatModel(ctx, openaiConfig)
+}
+
+// profileHeaders returns the extra headers of a profile with environment variables expanded
+func profileHeaders(profile ProviderProfile) http.Header {
+	headers := make(http.Header, len(profile.Headers))
+	for name, value := range profile.Headers {
+		headers.Set(name, os.ExpandEnv(value))
+	}
+	return headers
+}
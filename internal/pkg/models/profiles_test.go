@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newOpenAICompatibleTestServer starts a stand-in for an OpenAI-compatible chat completions API and records the last request
+func newOpenAICompatibleTestServer(t *testing.T, lastRequest **http.Request) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*lastRequest = r.Clone(context.Background())
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"test",` +
+			`"choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}],` +
+			`"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestCreateProfileProviderPositiveNoAuth(t *testing.T) {
+	var lastRequest *http.Request
+	server := newOpenAICompatibleTestServer(t, &lastRequest)
+
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString: "vllm:meta-llama/Llama-3.1-8B-Instruct",
+		Profiles: map[string]ProviderProfile{
+			"vllm": {BaseURL: server.URL + "/v1", Auth: ProfileAuthNone},
+		},
+	})
+	assert.NoError(t, err)
+
+	response, err := chatModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("ping")})
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", response.Content)
+	assert.Equal(t, "/v1/chat/completions", lastRequest.URL.Path)
+	assert.Empty(t, lastRequest.Header.Get("Authorization"))
+}
+
+func TestCreateProfileProviderPositiveBearerWithHeaders(t *testing.T) {
+	var lastRequest *http.Request
+	server := newOpenAICompatibleTestServer(t, &lastRequest)
+	t.Setenv("TEST_OPENROUTER_API_KEY", "secret-key")
+
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString: "OpenRouter:anthropic/claude-3.5-sonnet",
+		Profiles: map[string]ProviderProfile{
+			"openrouter": {
+				BaseURL: server.URL + "/api/v1",
+				APIKey:  "${TEST_OPENROUTER_API_KEY}",
+				Headers: map[string]string{"x-title": "ricky-bot", "X-Key-Copy": "$TEST_OPENROUTER_API_KEY"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = chatModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("ping")})
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v1/chat/completions", lastRequest.URL.Path)
+	assert.Equal(t, "Bearer secret-key", lastRequest.Header.Get("Authorization"))
+	assert.Equal(t, "ricky-bot", lastRequest.Header.Get("X-Title"))
+	assert.Equal(t, "secret-key", lastRequest.Header.Get("X-Key-Copy"))
+}
+
+func TestCreateProfileProviderPositiveAzure(t *testing.T) {
+	var lastRequest *http.Request
+	server := newOpenAICompatibleTestServer(t, &lastRequest)
+
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString: "azure:gpt-4o",
+		Profiles: map[string]ProviderProfile{
+			"azure": {
+				BaseURL:    server.URL,
+				Auth:       ProfileAuthAzure,
+				APIKey:     "azure-key",
+				APIVersion: "2024-06-01",
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = chatModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("ping")})
+	assert.NoError(t, err)
+	assert.Equal(t, "/openai/deployments/gpt-4o/chat/completions", lastRequest.URL.Path)
+	assert.Equal(t, "2024-06-01", lastRequest.URL.Query().Get("api-version"))
+	assert.Equal(t, "azure-key", lastRequest.Header.Get("api-key"))
+	assert.Empty(t, lastRequest.Header.Get("Authorization"))
+}
+
+func TestCreateProfileProviderNegativeAzureWithoutKey(t *testing.T) {
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString: "azure:gpt-4o",
+		Profiles: map[string]ProviderProfile{
+			"azure": {BaseURL: "https://example.openai.azure.com", Auth: ProfileAuthAzure},
+		},
+	})
+	assert.Nil(t, chatModel)
+	assert.EqualError(t, err, "provider azure: API key is required for azure auth")
+}
+
+func TestCreateProfileProviderNegativeAuth(t *testing.T) {
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString: "vllm:llama3",
+		Profiles: map[string]ProviderProfile{
+			"vllm": {BaseURL: "http://localhost:8000/v1", Auth: "basic"},
+		},
+	})
+	assert.Nil(t, chatModel)
+	assert.EqualError(t, err, "provider vllm: unsupported auth basic")
+}
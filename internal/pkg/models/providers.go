@@ -2,15 +2,30 @@ package models
 
 import (
 	"ai-chat/internal/pkg/models/gemini"
+	"bytes"
+	"cloud.google.com/go/auth/credentials"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/cloudwego/eino-ext/components/model/claude"
 	"github.com/cloudwego/eino-ext/components/model/ollama"
 	"github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/components/model"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/ollama/ollama/api"
 	"google.golang.org/genai"
 	"os"
+	"sort"
 	"strings"
+	"time"
+)
+
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+const (
+	googleBackendGemini      = "gemini"
+	googleBackendVertex      = "vertex"
+	googleCloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
 )
 
 // ProviderConfig holds configuration for creating LLM providers
@@ -22,6 +37,27 @@ type ProviderConfig struct {
 	OpenAIAPIKey     string
 	OpenAIBaseURL    string
 	GoogleAPIKey     string
+	OllamaBaseURL    string
+	OllamaNumCtx     int
+	OllamaKeepAlive  string
+	OllamaOptions    map[string]any
+
+	// Google settings, GoogleBackend is either "gemini" (default) or "vertex"
+	GoogleBackend            string
+	GoogleBaseURL            string
+	GoogleProject            string
+	GoogleLocation           string
+	GoogleCredentialsFile    string
+	GoogleResponseSchema     string // JSON text of the schema
+	GoogleResponseSchemaFile string
+	GoogleCodeExecution      bool
+	GoogleSafetySettings     map[string]string // harm category to block threshold
+
+	// Profiles are named OpenAI-compatible providers, they take precedence over the built-in providers
+	Profiles map[string]ProviderProfile
+
+	// Capabilities override the built-in model capability table, the first matching rule wins
+	Capabilities []CapabilityRule
 }
 
 // CreateProvider creates an eino ToolCallingChatModel based on the provider configuration
@@ -34,6 +70,10 @@ func CreateProvider(ctx context.Context, config *ProviderConfig) (model.ToolCall
 	provider := parts[0]
 	modelName := parts[1]
 
+	if profile, ok := findProfile(config.Profiles, provider); ok {
+		return createProfileProvider(ctx, provider, profile, modelName)
+	}
+
 	switch provider {
 	case "anthropic":
 		return createAnthropicProvider(ctx, config, modelName)
@@ -48,11 +88,35 @@ func CreateProvider(ctx context.Context, config *ProviderConfig) (model.ToolCall
 	}
 }
 
-func createAnthropicProvider(ctx context.Context, config *ProviderConfig, modelName string) (model.ToolCallingChatModel, error) {
-	apiKey := config.AnthropicAPIKey
-	if apiKey == "" {
-		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+// anthropicAPIKey returns the configured Anthropic API key, falling back to the environment
+func anthropicAPIKey(config *ProviderConfig) string {
+	if config.AnthropicAPIKey != "" {
+		return config.AnthropicAPIKey
 	}
+	return os.Getenv("ANTHROPIC_API_KEY")
+}
+
+// openAIAPIKey returns the configured OpenAI API key, falling back to the environment
+func openAIAPIKey(config *ProviderConfig) string {
+	if config.OpenAIAPIKey != "" {
+		return config.OpenAIAPIKey
+	}
+	return os.Getenv("OPENAI_API_KEY")
+}
+
+// googleAPIKey returns the configured Google API key, falling back to the environment
+func googleAPIKey(config *ProviderConfig) string {
+	if config.GoogleAPIKey != "" {
+		return config.GoogleAPIKey
+	}
+	if apiKey := os.Getenv("GOOGLE_API_KEY"); apiKey != "" {
+		return apiKey
+	}
+	return os.Getenv("GEMINI_API_KEY")
+}
+
+func createAnthropicProvider(ctx context.Context, config *ProviderConfig, modelName string) (model.ToolCallingChatModel, error) {
+	apiKey := anthropicAPIKey(config)
 	if apiKey == "" {
 		return nil, fmt.Errorf("Anthropic API key not provided. Use --anthropic-api-key flag or ANTHROPIC_API_KEY environment variable")
 	}
@@ -71,10 +135,7 @@ func createAnthropicProvider(ctx context.Context, config *ProviderConfig, modelN
 }
 
 func createOpenAIProvider(ctx context.Context, config *ProviderConfig, modelName string) (model.ToolCallingChatModel, error) {
-	apiKey := config.OpenAIAPIKey
-	if apiKey == "" {
-		apiKey = os.Getenv("OPENAI_API_KEY")
-	}
+	apiKey := openAIAPIKey(config)
 	if apiKey == "" {
 		return nil, fmt.Errorf("OpenAI API key not provided. Use --openai-api-key flag or OPENAI_API_KEY environment variable")
 	}
@@ -92,43 +153,179 @@ func createOpenAIProvider(ctx context.Context, config *ProviderConfig, modelName
 }
 
 func createGoogleProvider(ctx context.Context, config *ProviderConfig, modelName string) (model.ToolCallingChatModel, error) {
-	apiKey := config.GoogleAPIKey
-	if apiKey == "" {
-		apiKey = os.Getenv("GOOGLE_API_KEY")
-	}
-	if apiKey == "" {
-		apiKey = os.Getenv("GEMINI_API_KEY")
-	}
-	if apiKey == "" {
-		return nil, fmt.Errorf("Google API key not provided. Use --google-api-key flag or GOOGLE_API_KEY/GEMINI_API_KEY environment variable")
+	clientConfig, err := createGoogleClientConfig(config)
+	if err != nil {
+		return nil, err
 	}
 
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
+	client, err := genai.NewClient(ctx, clientConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Google client: %v", err)
 	}
 
+	responseSchema, err := createGoogleResponseSchema(config)
+	if err != nil {
+		return nil, err
+	}
+
 	geminiConfig := &gemini.Config{
-		Client: client,
-		Model:  modelName,
+		Client:              client,
+		Model:               modelName,
+		ResponseSchema:      responseSchema,
+		EnableCodeExecution: config.GoogleCodeExecution,
+		SafetySettings:      createGoogleSafetySettings(config),
 	}
 
 	return gemini.NewChatModel(ctx, geminiConfig)
 }
 
+// createGoogleClientConfig builds the genai client configuration for either the Gemini API or the Vertex AI backend
+func createGoogleClientConfig(config *ProviderConfig) (*genai.ClientConfig, error) {
+	clientConfig := &genai.ClientConfig{
+		HTTPOptions: genai.HTTPOptions{
+			BaseURL: config.GoogleBaseURL,
+		},
+	}
+
+	switch config.GoogleBackend {
+	case "", googleBackendGemini:
+		apiKey := googleAPIKey(config)
+		if apiKey == "" {
+			return nil, fmt.Errorf("Google API key not provided. Use --google-api-key flag or GOOGLE_API_KEY/GEMINI_API_KEY environment variable")
+		}
+
+		clientConfig.Backend = genai.BackendGeminiAPI
+		clientConfig.APIKey = apiKey
+	case googleBackendVertex:
+		// Project and location fall back to GOOGLE_CLOUD_PROJECT and GOOGLE_CLOUD_LOCATION inside genai,
+		// an API key without them selects Vertex AI express mode
+		clientConfig.Backend = genai.BackendVertexAI
+		clientConfig.Project = config.GoogleProject
+		clientConfig.Location = config.GoogleLocation
+		if config.GoogleProject == "" && config.GoogleLocation == "" {
+			clientConfig.APIKey = config.GoogleAPIKey
+		}
+
+		if config.GoogleCredentialsFile != "" {
+			googleCredentials, err := credentials.DetectDefault(&credentials.DetectOptions{
+				Scopes:          []string{googleCloudPlatformScope},
+				CredentialsFile: config.GoogleCredentialsFile,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to load Google credentials file: %v", err)
+			}
+			clientConfig.Credentials = googleCredentials
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Google backend: %s", config.GoogleBackend)
+	}
+
+	return clientConfig, nil
+}
+
+// createGoogleResponseSchema parses the configured JSON response schema, given as text or as a file, into an OpenAPI schema
+func createGoogleResponseSchema(config *ProviderConfig) (*openapi3.Schema, error) {
+	schemaText := []byte(config.GoogleResponseSchema)
+	if config.GoogleResponseSchemaFile != "" {
+		var err error
+		schemaText, err = os.ReadFile(config.GoogleResponseSchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Google response schema file: %v", err)
+		}
+	}
+	if len(bytes.TrimSpace(schemaText)) == 0 {
+		return nil, nil
+	}
+
+	responseSchema := &openapi3.Schema{}
+	if err := json.Unmarshal(schemaText, responseSchema); err != nil {
+		return nil, fmt.Errorf("invalid Google response schema: %v", err)
+	}
+
+	return responseSchema, nil
+}
+
+// createGoogleSafetySettings converts the category to threshold map into genai safety settings
+func createGoogleSafetySettings(config *ProviderConfig) []*genai.SafetySetting {
+	if len(config.GoogleSafetySettings) == 0 {
+		return nil
+	}
+
+	categories := make([]string, 0, len(config.GoogleSafetySettings))
+	for category := range config.GoogleSafetySettings {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	// Configuration keys may have been lower-cased by the config loader, genai enums are upper case
+	safetySettings := make([]*genai.SafetySetting, 0, len(categories))
+	for _, category := range categories {
+		safetySettings = append(safetySettings, &genai.SafetySetting{
+			Category:  genai.HarmCategory(strings.ToUpper(category)),
+			Threshold: genai.HarmBlockThreshold(strings.ToUpper(config.GoogleSafetySettings[category])),
+		})
+	}
+
+	return safetySettings
+}
+
 func createOllamaProvider(ctx context.Context, config *ProviderConfig, modelName string) (model.ToolCallingChatModel, error) {
 	ollamaConfig := &ollama.ChatModelConfig{
-		BaseURL: "http://localhost:11434", // Default Ollama URL
+		BaseURL: ollamaBaseURL(config),
 		Model:   modelName,
 	}
 
-	// Check for custom Ollama host
-	if host := os.Getenv("OLLAMA_HOST"); host != "" {
-		ollamaConfig.BaseURL = host
+	if config.OllamaKeepAlive != "" {
+		keepAlive, err := time.ParseDuration(config.OllamaKeepAlive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ollama keep-alive %q: %v", config.OllamaKeepAlive, err)
+		}
+		ollamaConfig.KeepAlive = &keepAlive
 	}
 
+	options, err := createOllamaOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	ollamaConfig.Options = options
+
 	return ollama.NewChatModel(ctx, ollamaConfig)
 }
+
+// ollamaBaseURL returns the Ollama host, configuration takes precedence over the OLLAMA_HOST environment variable
+func ollamaBaseURL(config *ProviderConfig) string {
+	if config.OllamaBaseURL != "" {
+		return config.OllamaBaseURL
+	}
+	if host := os.Getenv("OLLAMA_HOST"); host != "" {
+		return host
+	}
+	return defaultOllamaBaseURL
+}
+
+// createOllamaOptions builds Ollama runtime options from the generic options map and num_ctx setting
+func createOllamaOptions(config *ProviderConfig) (*api.Options, error) {
+	if len(config.OllamaOptions) == 0 && config.OllamaNumCtx == 0 {
+		return nil, nil
+	}
+
+	options := &api.Options{}
+	if len(config.OllamaOptions) > 0 {
+		marshaledOptions, err := json.Marshal(config.OllamaOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal Ollama options: %v", err)
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(marshaledOptions))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(options); err != nil {
+			return nil, fmt.Errorf("invalid Ollama options: %v", err)
+		}
+	}
+
+	if config.OllamaNumCtx > 0 {
+		options.NumCtx = config.OllamaNumCtx
+	}
+
+	return options, nil
+}
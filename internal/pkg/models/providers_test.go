@@ -0,0 +1,232 @@
+package models
+
+import (
+	"ai-chat/internal/pkg/models/genaiTest"
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/eino/schema"
+	"github.com/ollama/ollama/api"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genai"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newOllamaTestServer starts an httptest stand-in for the Ollama chat API and records the last request
+func newOllamaTestServer(t *testing.T, lastRequest *api.ChatRequest) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(lastRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(api.ChatResponse{
+			Model:   lastRequest.Model,
+			Message: api.Message{Role: "assistant", Content: "pong"},
+			Done:    true,
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestCreateOllamaProviderPositive(t *testing.T) {
+	var lastRequest api.ChatRequest
+	server := newOllamaTestServer(t, &lastRequest)
+
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString:     "ollama:qwen3:8b",
+		OllamaBaseURL:   server.URL,
+		OllamaNumCtx:    8192,
+		OllamaKeepAlive: "10m",
+		OllamaOptions: map[string]any{
+			"temperature": 0.25,
+			"num_gpu":     1,
+		},
+	})
+	assert.NoError(t, err)
+
+	response, err := chatModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("ping")})
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", response.Content)
+
+	assert.Equal(t, "qwen3:8b", lastRequest.Model)
+	assert.Equal(t, float64(8192), lastRequest.Options["num_ctx"])
+	assert.Equal(t, float64(1), lastRequest.Options["num_gpu"])
+	assert.Equal(t, 0.25, lastRequest.Options["temperature"])
+	if assert.NotNil(t, lastRequest.KeepAlive) {
+		assert.Equal(t, 10*time.Minute, lastRequest.KeepAlive.Duration)
+	}
+}
+
+func TestCreateOllamaProviderPositiveEnvironmentHost(t *testing.T) {
+	var lastRequest api.ChatRequest
+	server := newOllamaTestServer(t, &lastRequest)
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString: "ollama:llama3.2:3b",
+	})
+	assert.NoError(t, err)
+
+	_, err = chatModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("ping")})
+	assert.NoError(t, err)
+	assert.Equal(t, "llama3.2:3b", lastRequest.Model)
+	assert.Nil(t, lastRequest.KeepAlive)
+	assert.NotContains(t, lastRequest.Options, "num_ctx")
+}
+
+func TestCreateOllamaProviderNegativeKeepAlive(t *testing.T) {
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString:     "ollama:qwen3:8b",
+		OllamaKeepAlive: "forever",
+	})
+	assert.Nil(t, chatModel)
+	assert.EqualError(t, err, "invalid Ollama keep-alive \"forever\": time: invalid duration \"forever\"")
+}
+
+func TestCreateOllamaProviderNegativeUnknownOption(t *testing.T) {
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString:   "ollama:qwen3:8b",
+		OllamaOptions: map[string]any{"num_context": 4096},
+	})
+	assert.Nil(t, chatModel)
+	assert.EqualError(t, err, "invalid Ollama options: json: unknown field \"num_context\"")
+}
+
+func TestCreateGoogleProviderPositiveGeminiBackend(t *testing.T) {
+	var lastRequest genaiTest.Request
+	server := genaiTest.NewServer(t, &lastRequest, map[string]any{"text": `{"answer":"42"}`})
+
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString:          "google:gemini-2.0-flash",
+		GoogleAPIKey:         "test-key",
+		GoogleBaseURL:        server.URL,
+		GoogleResponseSchema: `{"type": "object", "properties": {"answer": {"type": "string"}}}`,
+		GoogleCodeExecution:  true,
+		GoogleSafetySettings: map[string]string{
+			"harm_category_harassment":  "block_only_high",
+			"harm_category_hate_speech": "block_none",
+		},
+	})
+	assert.NoError(t, err)
+
+	response, err := chatModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("answer")})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"answer":"42"}`, response.Content)
+
+	assert.Equal(t, "/v1beta/models/gemini-2.0-flash:generateContent", lastRequest.Path)
+	generationConfig := lastRequest.Body["generationConfig"].(map[string]any)
+	assert.Equal(t, "application/json", generationConfig["responseMimeType"])
+	assert.Equal(t, map[string]any{
+		"type":       "OBJECT",
+		"properties": map[string]any{"answer": map[string]any{"type": "STRING"}},
+	}, generationConfig["responseSchema"])
+	assert.Equal(t, []any{map[string]any{"codeExecution": map[string]any{}}}, lastRequest.Body["tools"])
+	assert.Equal(t, []any{
+		map[string]any{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_ONLY_HIGH"},
+		map[string]any{"category": "HARM_CATEGORY_HATE_SPEECH", "threshold": "BLOCK_NONE"},
+	}, lastRequest.Body["safetySettings"])
+}
+
+func TestCreateGoogleProviderPositiveResponseSchemaFile(t *testing.T) {
+	var lastRequest genaiTest.Request
+	server := genaiTest.NewServer(t, &lastRequest, map[string]any{"text": `{"answerText":"42"}`})
+
+	// Property names keep their case, they are not read through the configuration map
+	schemaFile := filepath.Join(t.TempDir(), "schema.json")
+	assert.NoError(t, os.WriteFile(schemaFile,
+		[]byte(`{"type": "object", "properties": {"answerText": {"type": "string"}}, "required": ["answerText"]}`), 0o600))
+
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString:              "google:gemini-2.0-flash",
+		GoogleAPIKey:             "test-key",
+		GoogleBaseURL:            server.URL,
+		GoogleResponseSchemaFile: schemaFile,
+	})
+	assert.NoError(t, err)
+
+	_, err = chatModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("answer")})
+	assert.NoError(t, err)
+	generationConfig := lastRequest.Body["generationConfig"].(map[string]any)
+	assert.Equal(t, map[string]any{
+		"type":       "OBJECT",
+		"properties": map[string]any{"answerText": map[string]any{"type": "STRING"}},
+		"required":   []any{"answerText"},
+	}, generationConfig["responseSchema"])
+}
+
+func TestCreateGoogleProviderPositiveVertexExpressMode(t *testing.T) {
+	var lastRequest genaiTest.Request
+	server := genaiTest.NewServer(t, &lastRequest, map[string]any{"text": `{"answer":"42"}`})
+
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString:   "google:gemini-2.0-flash",
+		GoogleBackend: "vertex",
+		GoogleAPIKey:  "test-key",
+		GoogleBaseURL: server.URL,
+	})
+	assert.NoError(t, err)
+
+	_, err = chatModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("answer")})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(lastRequest.Path, "/v1beta1/"))
+	assert.True(t, strings.HasSuffix(lastRequest.Path, "/publishers/google/models/gemini-2.0-flash:generateContent"))
+}
+
+func TestCreateGoogleClientConfigPositiveVertexProject(t *testing.T) {
+	clientConfig, err := createGoogleClientConfig(&ProviderConfig{
+		GoogleBackend:  "vertex",
+		GoogleAPIKey:   "ignored-key",
+		GoogleProject:  "test-project",
+		GoogleLocation: "europe-west4",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, genai.BackendVertexAI, clientConfig.Backend)
+	assert.Equal(t, "test-project", clientConfig.Project)
+	assert.Equal(t, "europe-west4", clientConfig.Location)
+	assert.Empty(t, clientConfig.APIKey)
+}
+
+func TestCreateGoogleProviderNegativeBackend(t *testing.T) {
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString:   "google:gemini-2.0-flash",
+		GoogleBackend: "bedrock",
+	})
+	assert.Nil(t, chatModel)
+	assert.EqualError(t, err, "unsupported Google backend: bedrock")
+}
+
+func TestCreateGoogleProviderNegativeResponseSchemaFile(t *testing.T) {
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString:              "google:gemini-2.0-flash",
+		GoogleAPIKey:             "test-key",
+		GoogleResponseSchemaFile: filepath.Join(t.TempDir(), "missing.json"),
+	})
+	assert.Nil(t, chatModel)
+	assert.ErrorContains(t, err, "failed to read Google response schema file")
+}
+
+func TestCreateGoogleProviderNegativeResponseSchema(t *testing.T) {
+	chatModel, err := CreateProvider(context.Background(), &ProviderConfig{
+		ModelString:          "google:gemini-2.0-flash",
+		GoogleAPIKey:         "test-key",
+		GoogleResponseSchema: `{"required": "answer"}`,
+	})
+	assert.Nil(t, chatModel)
+	assert.ErrorContains(t, err, "invalid Google response schema")
+}
@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// DefaultRole is held by every principal, including requests without an authenticated user
+const DefaultRole = "default"
+
+// Principal is the authenticated user a chat turn runs for
+type Principal struct {
+	User  string
+	Roles []string
+}
+
+// rule is the tool patterns of one role
+type rule struct {
+	allow []string
+	deny  []string
+}
+
+// Policy decides which tools a principal may use, a nil policy allows every tool
+type Policy struct {
+	userHeader  string
+	rolesHeader string
+	users       map[string][]string
+	roles       map[string]rule
+}
+
+// New compiles the tool policy configuration, it returns nil when no policy is configured
+func New(config *mcpConfig.ToolPolicyConfig) *Policy {
+	if config == nil {
+		return nil
+	}
+
+	// Viper lowercases map keys, so users and roles are compared in lower case
+	policy := &Policy{
+		userHeader:  config.UserHeader,
+		rolesHeader: config.RolesHeader,
+		users:       make(map[string][]string, len(config.Users)),
+		roles:       make(map[string]rule, len(config.Roles)),
+	}
+	for user, roles := range config.Users {
+		policy.users[strings.ToLower(user)] = roles
+	}
+	for role, ruleConfig := range config.Roles {
+		policy.roles[strings.ToLower(role)] = rule{allow: ruleConfig.Allow, deny: ruleConfig.Deny}
+	}
+	return policy
+}
+
+// Principal returns the user and roles of a request, taken from the headers set by the authenticating
+// proxy in front of the application, and the roles the configuration assigns to the user
+func (p *Policy) Principal(request *http.Request) Principal {
+	if p == nil {
+		return Principal{}
+	}
+
+	var principal Principal
+	if p.userHeader != "" {
+		principal.User = strings.TrimSpace(request.Header.Get(p.userHeader))
+	}
+	if p.rolesHeader != "" {
+		for _, role := range strings.Split(request.Header.Get(p.rolesHeader), ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				principal.Roles = append(principal.Roles, role)
+			}
+		}
+	}
+	if principal.User != "" {
+		principal.Roles = append(principal.Roles, p.users[strings.ToLower(principal.User)]...)
+	}
+	return principal
+}
+
+// Allowed reports whether the principal may use a tool, toolName is the server__tool name.
+// A tool is allowed when a role of the principal allows it and none of them denies it.
+func (p *Policy) Allowed(principal Principal, toolName string) bool {
+	if p == nil {
+		return true
+	}
+
+	allowed := false
+	for _, role := range append([]string{DefaultRole}, principal.Roles...) {
+		rule, found := p.roles[strings.ToLower(role)]
+		if !found {
+			continue
+		}
+		if matchesAny(rule.deny, toolName) {
+			return false
+		}
+		allowed = allowed || matchesAny(rule.allow, toolName)
+	}
+	return allowed
+}
+
+func matchesAny(patterns []string, toolName string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, toolName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context whose tool calls are checked for the principal
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal set by WithPrincipal, an anonymous principal when there is none
+func PrincipalFromContext(ctx context.Context) Principal {
+	principal, _ := ctx.Value(principalKey{}).(Principal)
+	return principal
+}
@@ -0,0 +1,54 @@
+package policy
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func testPolicy() *Policy {
+	return New(&mcpConfig.ToolPolicyConfig{
+		UserHeader:  "X-Forwarded-User",
+		RolesHeader: "X-Forwarded-Groups",
+		Users:       map[string][]string{"alice": {"admin"}},
+		Roles: map[string]mcpConfig.ToolRuleConfig{
+			"default":    {Allow: []string{"builtin__*", "calculator__*"}},
+			"admin":      {Allow: []string{"*"}},
+			"contractor": {Deny: []string{"calculator__divide"}},
+		},
+	})
+}
+
+func TestPrincipalPositive(t *testing.T) {
+	request := httptest.NewRequest("POST", "/api/ask", nil)
+	request.Header.Set("X-Forwarded-User", "Alice")
+	request.Header.Set("X-Forwarded-Groups", "staff, contractor")
+
+	principal := testPolicy().Principal(request)
+	assert.Equal(t, Principal{User: "Alice", Roles: []string{"staff", "contractor", "admin"}}, principal)
+
+	assert.Equal(t, principal, PrincipalFromContext(WithPrincipal(context.Background(), principal)))
+}
+
+func TestAllowedPositive(t *testing.T) {
+	policy := testPolicy()
+
+	assert.True(t, policy.Allowed(Principal{}, "builtin__calculate"))
+	assert.True(t, policy.Allowed(Principal{}, "calculator__divide"))
+	assert.True(t, policy.Allowed(Principal{User: "alice", Roles: []string{"ADMIN"}}, "files__write"))
+
+	var noPolicy *Policy
+	assert.True(t, noPolicy.Allowed(Principal{}, "files__write"))
+	assert.Equal(t, Principal{}, noPolicy.Principal(httptest.NewRequest("GET", "/", nil)))
+}
+
+func TestAllowedNegative(t *testing.T) {
+	policy := testPolicy()
+
+	assert.False(t, policy.Allowed(Principal{}, "files__write"))
+	assert.False(t, policy.Allowed(Principal{Roles: []string{"contractor"}}, "calculator__divide"))
+	assert.False(t, policy.Allowed(Principal{Roles: []string{"admin", "contractor"}}, "calculator__divide"))
+	assert.False(t, policy.Allowed(Principal{Roles: []string{"unknown"}}, "files__write"))
+}
@@ -41,7 +41,7 @@ func (instance *SessionManager) AddAgentSession(id uuid.UUID, agent *agent.Agent
 		return errors.New("session with such id already exists")
 	}
 
-	chat, err := chatSession.NewAgentChatSession(agent, responseFunc)
+	chat, err := chatSession.NewAgentChatSession(id.String(), agent, responseFunc)
 	if err != nil {
 		return fmt.Errorf("chatSession.NewAgentChatSession() failed: %w", err)
 	}
@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"github.com/google/uuid"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// defaultArtifactStoreSize bounds the bytes kept in memory, the oldest artifacts are dropped first
+const defaultArtifactStoreSize = 64 << 20
+
+// Types of the artifacts shown in the chat and served inline: raster images and audio, which cannot run scripts.
+// SVG is left out as it can, every other type is served as a download.
+var (
+	inlineImageTypes = map[string]bool{
+		"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true, "image/bmp": true, "image/avif": true,
+	}
+	inlineAudioTypes = map[string]bool{
+		"audio/mpeg": true, "audio/wav": true, "audio/x-wav": true, "audio/ogg": true, "audio/webm": true,
+		"audio/mp4": true, "audio/aac": true, "audio/flac": true,
+	}
+)
+
+// Artifact describes a binary tool output kept for display in the chat UI
+type Artifact struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType"`
+	Size     int    `json:"size"`
+}
+
+// IsImage reports whether the artifact can be shown as an image
+func (a Artifact) IsImage() bool {
+	return inlineImageTypes[a.mediaType()]
+}
+
+// IsAudio reports whether the artifact can be played as audio
+func (a Artifact) IsAudio() bool {
+	return inlineAudioTypes[a.mediaType()]
+}
+
+// IsInline reports whether the artifact is safe to serve inline, the other ones are only downloaded
+func (a Artifact) IsInline() bool {
+	return a.IsImage() || a.IsAudio()
+}
+
+// mediaType returns the MIME type in lower case without parameters, the type claimed by the server is not trusted
+func (a Artifact) mediaType() string {
+	mediaType, _, err := mime.ParseMediaType(a.MimeType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mediaType)
+}
+
+type storedArtifact struct {
+	artifact Artifact
+	data     []byte
+}
+
+// ArtifactStore keeps tool artifacts in memory up to a total size
+type ArtifactStore struct {
+	mutex     sync.RWMutex
+	artifacts map[string]storedArtifact
+	order     []string
+	size      int
+	maxSize   int
+}
+
+// NewArtifactStore creates a store holding at most maxSize bytes
+func NewArtifactStore(maxSize int) *ArtifactStore {
+	return &ArtifactStore{
+		artifacts: make(map[string]storedArtifact),
+		maxSize:   maxSize,
+	}
+}
+
+// Put stores the data and returns its description, data larger than the store is described but not kept
+func (s *ArtifactStore) Put(name string, mimeType string, data []byte) Artifact {
+	artifact := Artifact{
+		ID:       uuid.NewString(),
+		Name:     name,
+		MimeType: mimeType,
+		Size:     len(data),
+	}
+	if len(data) > s.maxSize {
+		return artifact
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for s.size+len(data) > s.maxSize && len(s.order) > 0 {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		s.size -= len(s.artifacts[oldest].data)
+		delete(s.artifacts, oldest)
+	}
+
+	s.artifacts[artifact.ID] = storedArtifact{artifact: artifact, data: data}
+	s.order = append(s.order, artifact.ID)
+	s.size += len(data)
+
+	return artifact
+}
+
+// Get returns an artifact and its data
+func (s *ArtifactStore) Get(id string) (Artifact, []byte, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stored, found := s.artifacts[id]
+	return stored.artifact, stored.data, found
+}
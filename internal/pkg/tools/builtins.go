@@ -0,0 +1,264 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Names of the built-in tools
+const (
+	currentTimeToolName = "current_time"
+	calculateToolName   = "calculate"
+	notesToolName       = "notes"
+)
+
+// RegisterBuiltins adds the built-in tools that work without any MCP server
+func RegisterBuiltins(registry *Registry) error {
+	if err := RegisterFunc(registry, currentTimeToolName,
+		"Returns the current date and time, optionally in an IANA time zone such as Europe/Berlin.", currentTime); err != nil {
+		return err
+	}
+	if err := RegisterFunc(registry, calculateToolName,
+		"Evaluates an arithmetic expression with + - * / %, parentheses, the constants pi and e and the functions "+
+			"abs, sqrt, pow, exp, ln, log10, sin, cos, tan, floor, ceil, round, min and max.", calculate); err != nil {
+		return err
+	}
+	return RegisterFunc(registry, notesToolName,
+		"Keeps notes for the rest of the conversation: add a note, list all notes or clear them.", takeNotes)
+}
+
+type currentTimeInput struct {
+	Timezone string `json:"timezone,omitempty" jsonschema:"description=IANA time zone, the local time zone of the server if empty"`
+}
+
+type currentTimeOutput struct {
+	Time     string `json:"time"`
+	Date     string `json:"date"`
+	Weekday  string `json:"weekday"`
+	Timezone string `json:"timezone"`
+}
+
+func currentTime(ctx context.Context, input currentTimeInput) (currentTimeOutput, error) {
+	location := time.Local
+	if input.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(input.Timezone); err != nil {
+			return currentTimeOutput{}, fmt.Errorf("unknown time zone %s", input.Timezone)
+		}
+	}
+
+	now := time.Now().In(location)
+	return currentTimeOutput{
+		Time:     now.Format(time.RFC3339),
+		Date:     now.Format(time.DateOnly),
+		Weekday:  now.Weekday().String(),
+		Timezone: location.String(),
+	}, nil
+}
+
+type calculateInput struct {
+	Expression string `json:"expression" jsonschema:"description=Arithmetic expression such as (2 + 3) * sqrt(16),required"`
+}
+
+type calculateOutput struct {
+	Result float64 `json:"result"`
+}
+
+func calculate(ctx context.Context, input calculateInput) (calculateOutput, error) {
+	result, err := evaluate(input.Expression)
+	if err != nil {
+		return calculateOutput{}, err
+	}
+	return calculateOutput{Result: result}, nil
+}
+
+// evaluate computes an arithmetic expression, it is parsed as a Go expression and
+// anything other than numbers, operators, the known constants and functions is rejected
+func evaluate(expression string) (float64, error) {
+	node, err := parser.ParseExpr(expression)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expression: %v", err)
+	}
+	result, err := evaluateNode(node)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return result, nil
+}
+
+var constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+var functions = map[string]func(arguments []float64) (float64, error){
+	"abs":   unary(math.Abs),
+	"sqrt":  unary(math.Sqrt),
+	"exp":   unary(math.Exp),
+	"ln":    unary(math.Log),
+	"log10": unary(math.Log10),
+	"sin":   unary(math.Sin),
+	"cos":   unary(math.Cos),
+	"tan":   unary(math.Tan),
+	"floor": unary(math.Floor),
+	"ceil":  unary(math.Ceil),
+	"round": unary(math.Round),
+	"pow":   binary(math.Pow),
+	"min":   binary(math.Min),
+	"max":   binary(math.Max),
+}
+
+func unary(function func(float64) float64) func(arguments []float64) (float64, error) {
+	return func(arguments []float64) (float64, error) {
+		if len(arguments) != 1 {
+			return 0, fmt.Errorf("expects 1 argument, got %d", len(arguments))
+		}
+		return function(arguments[0]), nil
+	}
+}
+
+func binary(function func(float64, float64) float64) func(arguments []float64) (float64, error) {
+	return func(arguments []float64) (float64, error) {
+		if len(arguments) != 2 {
+			return 0, fmt.Errorf("expects 2 arguments, got %d", len(arguments))
+		}
+		return function(arguments[0], arguments[1]), nil
+	}
+}
+
+func evaluateNode(node ast.Expr) (float64, error) {
+	switch node := node.(type) {
+	case *ast.BasicLit:
+		switch node.Kind {
+		case token.INT:
+			value, err := strconv.ParseInt(node.Value, 0, 64)
+			return float64(value), err
+		case token.FLOAT:
+			return strconv.ParseFloat(node.Value, 64)
+		}
+		return 0, fmt.Errorf("unsupported literal %s", node.Value)
+	case *ast.Ident:
+		if value, found := constants[node.Name]; found {
+			return value, nil
+		}
+		return 0, fmt.Errorf("unknown constant %s", node.Name)
+	case *ast.ParenExpr:
+		return evaluateNode(node.X)
+	case *ast.UnaryExpr:
+		value, err := evaluateNode(node.X)
+		if err != nil {
+			return 0, err
+		}
+		switch node.Op {
+		case token.ADD:
+			return value, nil
+		case token.SUB:
+			return -value, nil
+		}
+		return 0, fmt.Errorf("unsupported operator %s", node.Op)
+	case *ast.BinaryExpr:
+		return evaluateBinary(node)
+	case *ast.CallExpr:
+		name, ok := node.Fun.(*ast.Ident)
+		if !ok {
+			return 0, fmt.Errorf("unsupported function call")
+		}
+		function, found := functions[name.Name]
+		if !found {
+			return 0, fmt.Errorf("unknown function %s", name.Name)
+		}
+		arguments := make([]float64, len(node.Args))
+		for index, argument := range node.Args {
+			value, err := evaluateNode(argument)
+			if err != nil {
+				return 0, err
+			}
+			arguments[index] = value
+		}
+		result, err := function(arguments)
+		if err != nil {
+			return 0, fmt.Errorf("%s %v", name.Name, err)
+		}
+		return result, nil
+	}
+	return 0, fmt.Errorf("unsupported expression")
+}
+
+func evaluateBinary(node *ast.BinaryExpr) (float64, error) {
+	left, err := evaluateNode(node.X)
+	if err != nil {
+		return 0, err
+	}
+	right, err := evaluateNode(node.Y)
+	if err != nil {
+		return 0, err
+	}
+
+	switch node.Op {
+	case token.ADD:
+		return left + right, nil
+	case token.SUB:
+		return left - right, nil
+	case token.MUL:
+		return left * right, nil
+	case token.QUO:
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return left / right, nil
+	case token.REM:
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return math.Mod(left, right), nil
+	case token.XOR:
+		return 0, fmt.Errorf("use pow(x, y) for powers")
+	}
+	return 0, fmt.Errorf("unsupported operator %s", node.Op)
+}
+
+// Actions of the notes tool
+const (
+	notesAdd   = "add"
+	notesList  = "list"
+	notesClear = "clear"
+)
+
+type notesInput struct {
+	Action string `json:"action" jsonschema:"description=What to do with the notes,enum=add,enum=list,enum=clear,required"`
+	Text   string `json:"text,omitempty" jsonschema:"description=The note to add"`
+}
+
+type notesOutput struct {
+	Notes []string `json:"notes"`
+}
+
+func takeNotes(ctx context.Context, input notesInput) (notesOutput, error) {
+	scratchpad := scratchpadFromContext(ctx)
+	if scratchpad == nil {
+		return notesOutput{}, fmt.Errorf("notes are only available in a conversation")
+	}
+
+	switch input.Action {
+	case notesAdd:
+		if input.Text == "" {
+			return notesOutput{}, fmt.Errorf("text is required to add a note")
+		}
+		scratchpad.Add(input.Text)
+	case notesClear:
+		scratchpad.Clear()
+	case notesList:
+	default:
+		return notesOutput{}, fmt.Errorf("action must be one of add, list or clear")
+	}
+	return notesOutput{Notes: scratchpad.Notes()}, nil
+}
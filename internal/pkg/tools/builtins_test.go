@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// builtinTools registers the built-in tools and returns them by name
+func builtinTools(t *testing.T) map[string]tool.InvokableTool {
+	t.Helper()
+
+	registry := NewRegistry()
+	assert.NoError(t, RegisterBuiltins(registry))
+
+	tools := make(map[string]tool.InvokableTool)
+	for _, baseTool := range registry.Tools() {
+		info, err := baseTool.Info(context.Background())
+		assert.NoError(t, err)
+		tools[info.Name] = baseTool.(tool.InvokableTool)
+	}
+	return tools
+}
+
+func TestRegistryPositive(t *testing.T) {
+	tools := builtinTools(t)
+	assert.Len(t, tools, 3)
+
+	info, err := tools[notesToolName].Info(context.Background())
+	assert.NoError(t, err)
+	parameters, err := info.ParamsOneOf.ToOpenAPIV3()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"action"}, parameters.Required)
+	assert.Len(t, parameters.Properties["action"].Value.Enum, 3)
+}
+
+func TestRegistryNegativeDuplicateAndInvalidNames(t *testing.T) {
+	registry := NewRegistry()
+	assert.NoError(t, RegisterBuiltins(registry))
+
+	err := RegisterFunc(registry, calculateToolName, "Again", calculate)
+	assert.EqualError(t, err, "tool calculate is already registered")
+
+	err = RegisterFunc(registry, "server__calculate", "Looks like an MCP tool", calculate)
+	assert.EqualError(t, err, `invalid tool name "server__calculate"`)
+}
+
+func TestEvaluatePositive(t *testing.T) {
+	for expression, expected := range map[string]float64{
+		"1 + 2 * 3":             7,
+		"(1 + 2) * 3":           9,
+		"-4 / 8":                -0.5,
+		"10 % 4":                2,
+		"sqrt(16) + pow(2, 10)": 1028,
+		"max(1, min(5, 3))":     3,
+		"round(pi * 100)":       314,
+		"0x10 + 1.5e1":          31,
+	} {
+		result, err := evaluate(expression)
+		assert.NoError(t, err, expression)
+		assert.Equal(t, expected, result, expression)
+	}
+}
+
+func TestEvaluateNegative(t *testing.T) {
+	for expression, message := range map[string]string{
+		"1 / 0":      "division by zero",
+		"2 ^ 3":      "use pow(x, y) for powers",
+		"os.Exit(1)": "unsupported function call",
+		"system(1)":  "unknown function system",
+		"x + 1":      "unknown constant x",
+		`"text"`:     "unsupported literal",
+		"pow(2)":     "pow expects 2 arguments, got 1",
+		"sqrt(-1)":   "result is not a finite number",
+		"1 +":        "invalid expression",
+		"1 == 1":     "unsupported operator ==",
+	} {
+		_, err := evaluate(expression)
+		assert.ErrorContains(t, err, message, expression)
+	}
+}
+
+func TestCurrentTimePositive(t *testing.T) {
+	output, err := builtinTools(t)[currentTimeToolName].InvokableRun(context.Background(), `{"timezone":"Asia/Tokyo"}`)
+	assert.NoError(t, err)
+
+	var result currentTimeOutput
+	assert.NoError(t, json.Unmarshal([]byte(output), &result))
+	assert.Equal(t, "Asia/Tokyo", result.Timezone)
+	parsed, err := time.Parse(time.RFC3339, result.Time)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), parsed, time.Minute)
+}
+
+func TestCurrentTimeNegativeUnknownZone(t *testing.T) {
+	_, err := builtinTools(t)[currentTimeToolName].InvokableRun(context.Background(), `{"timezone":"Mars/Olympus"}`)
+	assert.ErrorContains(t, err, "unknown time zone Mars/Olympus")
+}
+
+func TestNotesPositive(t *testing.T) {
+	notes := builtinTools(t)[notesToolName]
+	scratchpad := NewScratchpad()
+	ctx := WithScratchpad(context.Background(), scratchpad)
+
+	_, err := notes.InvokableRun(ctx, `{"action":"add","text":"user prefers metric units"}`)
+	assert.NoError(t, err)
+	output, err := notes.InvokableRun(ctx, `{"action":"list"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"notes":["user prefers metric units"]}`, output)
+
+	output, err = notes.InvokableRun(ctx, `{"action":"clear"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"notes":[]}`, output)
+	assert.Empty(t, scratchpad.Notes())
+}
+
+func TestNotesNegativeWithoutConversation(t *testing.T) {
+	_, err := builtinTools(t)[notesToolName].InvokableRun(context.Background(), `{"action":"list"}`)
+	assert.ErrorContains(t, err, "notes are only available in a conversation")
+}
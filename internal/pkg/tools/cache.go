@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheTTL        = 5 * time.Minute
+	defaultCacheMaxEntries = 1000
+)
+
+// CacheStats are the counters of the tool result cache
+type CacheStats struct {
+	Entries int                    `json:"entries"`
+	Hits    int64                  `json:"hits"`
+	Misses  int64                  `json:"misses"`
+	Tools   map[string]CacheCounts `json:"tools"` // by prefixed tool name
+}
+
+// CacheCounts are the cache hits and misses of one tool
+type CacheCounts struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// resultCache keeps the results of idempotent tools by server, tool and canonical arguments
+type resultCache struct {
+	mutex      sync.Mutex
+	entries    map[string]cacheEntry
+	maxEntries int
+	counts     map[string]CacheCounts
+}
+
+type cacheEntry struct {
+	result  *ToolResult
+	expires time.Time
+}
+
+func newResultCache(maxEntries int) *resultCache {
+	return &resultCache{
+		entries:    make(map[string]cacheEntry),
+		maxEntries: maxEntries,
+		counts:     make(map[string]CacheCounts),
+	}
+}
+
+// cacheSettings returns the cache settings of a tool, the server settings with the tool's overrides applied
+func (s *mcpServer) cacheSettings(toolName string) mcpConfig.ToolCache {
+	settings := s.config.ToolCache.Merge(toolOverride(s.config.Tools, toolName).ToolCache)
+	if settings.CacheTTL == 0 {
+		settings.CacheTTL = defaultCacheTTL
+	}
+	return settings
+}
+
+type sessionKey struct{}
+
+// WithSession returns a context whose tool calls share the results cached for the chat session
+func WithSession(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, sessionID)
+}
+
+func sessionFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionKey{}).(string)
+	return sessionID
+}
+
+// newCacheKey returns the key of a call, arguments that are not JSON and calls of session scoped tools
+// outside a session are not cached
+func newCacheKey(ctx context.Context, settings mcpConfig.ToolCache, server, toolName, arguments string) (string, bool) {
+	var value any
+	if err := json.Unmarshal([]byte(arguments), &value); err != nil {
+		return "", false
+	}
+	// Maps are marshalled with sorted keys, so equal arguments get the same key whatever their order and spacing
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+
+	scope := ""
+	if settings.CacheScope != mcpConfig.CacheScopeGlobal {
+		if scope = sessionFromContext(ctx); scope == "" {
+			return "", false
+		}
+	}
+	return strings.Join([]string{scope, server, toolName, string(canonical)}, "\x00"), true
+}
+
+// get returns a cached result and counts the hit or miss for the tool
+func (c *resultCache) get(key string, toolName string) (*ToolResult, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counts := c.counts[toolName]
+	defer func() { c.counts[toolName] = counts }()
+
+	entry, found := c.entries[key]
+	if !found || time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		counts.Misses++
+		return nil, false
+	}
+	counts.Hits++
+	return entry.result, true
+}
+
+// put stores a result, expired entries and then the ones expiring first make room when the cache is full
+func (c *resultCache) put(key string, result *ToolResult, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.maxEntries {
+		for entryKey, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, entryKey)
+			}
+		}
+	}
+	for len(c.entries) >= c.maxEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for entryKey, entry := range c.entries {
+			if oldestKey == "" || entry.expires.Before(oldest) {
+				oldestKey, oldest = entryKey, entry.expires
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+
+	c.entries[key] = cacheEntry{result: result, expires: now.Add(ttl)}
+}
+
+// stats returns a copy of the counters
+func (c *resultCache) stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := CacheStats{Entries: len(c.entries), Tools: make(map[string]CacheCounts, len(c.counts))}
+	for toolName, counts := range c.counts {
+		stats.Hits += counts.Hits
+		stats.Misses += counts.Misses
+		stats.Tools[toolName] = counts
+	}
+	return stats
+}
+
+// CacheStats returns the hit and miss counts of the tool result cache
+func (m *MCPToolManager) CacheStats() CacheStats {
+	return m.cache.stats()
+}
@@ -0,0 +1,149 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// loadCountingServer serves a lookup tool counting its calls, keys starting with "bad" return an error result
+func loadCountingServer(t *testing.T, serverConfig mcpConfig.MCPServerConfig) (*MCPToolManager, ResultTool, *atomic.Int32) {
+	t.Helper()
+
+	calls := &atomic.Int32{}
+	mcpServer := server.NewMCPServer("lookup", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("lookup", mcp.WithString("key"), mcp.WithNumber("page")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls.Add(1)
+			key := request.GetString("key", "")
+			if len(key) >= 3 && key[:3] == "bad" {
+				return mcp.NewToolResultError("no such key"), nil
+			}
+			return mcp.NewToolResultText("value of " + key), nil
+		})
+	httpServer := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer))
+	t.Cleanup(httpServer.Close)
+
+	serverConfig.Transport = mcpConfig.TransportStreamableHTTP
+	serverConfig.URL = httpServer.URL + "/mcp"
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{"lookup": serverConfig},
+	})
+	assert.NoError(t, err)
+	if !assert.Len(t, manager.GetTools(), 1) {
+		t.FailNow()
+	}
+	return manager, manager.GetTools()[0].(ResultTool), calls
+}
+
+func TestToolCachePositive(t *testing.T) {
+	idempotent := true
+	manager, lookup, calls := loadCountingServer(t, mcpConfig.MCPServerConfig{
+		Tools: map[string]mcpConfig.ToolSettings{"lookup": {ToolCache: mcpConfig.ToolCache{Idempotent: &idempotent}}},
+	})
+	ctx := WithSession(context.Background(), "session-1")
+
+	for _, arguments := range []string{`{"key":"a","page":1}`, `{ "page": 1, "key": "a" }`} {
+		result, err := lookup.RunWithResult(ctx, arguments)
+		assert.NoError(t, err)
+		assert.Equal(t, "value of a", result.Text)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Results are kept per session by default
+	_, err := lookup.RunWithResult(WithSession(context.Background(), "session-2"), `{"key":"a","page":1}`)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	stats := manager.CacheStats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Equal(t, CacheCounts{Hits: 1, Misses: 2}, stats.Tools["lookup__lookup"])
+}
+
+func TestToolCachePositiveGlobalScope(t *testing.T) {
+	idempotent := true
+	_, lookup, calls := loadCountingServer(t, mcpConfig.MCPServerConfig{
+		ToolCache: mcpConfig.ToolCache{Idempotent: &idempotent, CacheScope: mcpConfig.CacheScopeGlobal},
+	})
+
+	for _, sessionID := range []string{"session-1", "session-2"} {
+		_, err := lookup.RunWithResult(WithSession(context.Background(), sessionID), `{"key":"a"}`)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestToolCacheNegative(t *testing.T) {
+	idempotent := true
+	_, lookup, calls := loadCountingServer(t, mcpConfig.MCPServerConfig{
+		ToolCache: mcpConfig.ToolCache{Idempotent: &idempotent, CacheTTL: 50 * time.Millisecond},
+	})
+
+	ctx := WithSession(context.Background(), "session-1")
+
+	// Error results are not cached
+	for range 2 {
+		result, err := lookup.RunWithResult(ctx, `{"key":"bad"}`)
+		assert.NoError(t, err)
+		assert.True(t, result.IsError)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Results expire
+	_, err := lookup.RunWithResult(ctx, `{"key":"a"}`)
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	_, err = lookup.RunWithResult(ctx, `{"key":"a"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestToolCacheNegativeWithoutSession(t *testing.T) {
+	idempotent := true
+	manager, lookup, calls := loadCountingServer(t, mcpConfig.MCPServerConfig{
+		ToolCache: mcpConfig.ToolCache{Idempotent: &idempotent},
+	})
+
+	// Session scoped results are not shared by calls made outside a session
+	for range 2 {
+		_, err := lookup.RunWithResult(context.Background(), `{"key":"a"}`)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, CacheStats{Tools: map[string]CacheCounts{}}, manager.CacheStats())
+}
+
+func TestToolCacheNegativeNotIdempotent(t *testing.T) {
+	manager, lookup, calls := loadCountingServer(t, mcpConfig.MCPServerConfig{})
+
+	for range 2 {
+		_, err := lookup.RunWithResult(context.Background(), `{"key":"a"}`)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, CacheStats{Tools: map[string]CacheCounts{}}, manager.CacheStats())
+}
+
+func TestResultCachePositiveEviction(t *testing.T) {
+	cache := newResultCache(2)
+	cache.put("a", &ToolResult{Text: "a"}, time.Minute)
+	cache.put("b", &ToolResult{Text: "b"}, time.Hour)
+	cache.put("c", &ToolResult{Text: "c"}, time.Hour)
+
+	_, found := cache.get("a", "tool")
+	assert.False(t, found)
+	result, found := cache.get("c", "tool")
+	assert.True(t, found)
+	assert.Equal(t, "c", result.Text)
+}
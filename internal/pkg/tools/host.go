@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog/log"
+	"slices"
+)
+
+// Default limits of sampling requests
+const (
+	defaultSamplingMaxTokens   = 1024
+	defaultSamplingMaxRequests = 3
+)
+
+// Host answers the requests an MCP server sends back to the client while one of its tools runs,
+// LLM completions (sampling) and questions to the user (elicitation)
+type Host interface {
+	CreateMessage(ctx context.Context, serverName string, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+	Elicit(ctx context.Context, serverName string, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error)
+}
+
+type hostContextKey struct{}
+
+// WithHost returns a context whose tool calls route server requests to the host
+func WithHost(ctx context.Context, host Host) context.Context {
+	return context.WithValue(ctx, hostContextKey{}, host)
+}
+
+func hostFromContext(ctx context.Context) Host {
+	host, _ := ctx.Value(hostContextKey{}).(Host)
+	return host
+}
+
+// hostCall is a tool call in progress whose host answers the server requests
+type hostCall struct {
+	host             Host
+	samplingRequests int
+}
+
+// enterCall registers a tool call of the host, the returned function unregisters it
+func (s *mcpServer) enterCall(host Host) func() {
+	call := &hostCall{host: host}
+
+	s.mutex.Lock()
+	s.calls = append(s.calls, call)
+	s.mutex.Unlock()
+
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.calls = slices.DeleteFunc(s.calls, func(c *hostCall) bool { return c == call })
+	}
+}
+
+// activeCall returns the latest tool call in progress. Server requests carry no reference to the call that
+// caused them, so they are refused while calls of several hosts are in progress: answering with the wrong
+// host would show a question to another user or spend another session's model.
+func (s *mcpServer) activeCall() (*hostCall, error) {
+	if len(s.calls) == 0 {
+		return nil, fmt.Errorf("no tool call of server %s is in progress", s.name)
+	}
+	call := s.calls[len(s.calls)-1]
+	for _, other := range s.calls {
+		if other.host != call.host {
+			return nil, fmt.Errorf("tool calls of server %s from several sessions are in progress", s.name)
+		}
+	}
+	return call, nil
+}
+
+// samplingHost counts a sampling request against the limit of the active tool call and returns its host
+func (s *mcpServer) samplingHost(maxRequests int) (Host, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	call, err := s.activeCall()
+	if err != nil {
+		return nil, err
+	}
+	if call.samplingRequests >= maxRequests {
+		return nil, fmt.Errorf("sampling limit of %d requests per tool call reached", maxRequests)
+	}
+	call.samplingRequests++
+	return call.host, nil
+}
+
+// elicitationHost returns the host of the active tool call
+func (s *mcpServer) elicitationHost() (Host, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	call, err := s.activeCall()
+	if err != nil {
+		return nil, err
+	}
+	return call.host, nil
+}
+
+// clientOptions declares the sampling and elicitation capabilities the server configuration allows
+func (s *mcpServer) clientOptions() []client.ClientOption {
+	var options []client.ClientOption
+	if !s.config.Sampling.Disabled {
+		options = append(options, client.WithSamplingHandler(&samplingHandler{server: s}))
+	}
+	if !s.config.DisableElicitation {
+		options = append(options, client.WithElicitationHandler(&elicitationHandler{server: s}))
+	}
+	return options
+}
+
+// samplingHandler applies the sampling limits of a server and passes its requests to the host
+type samplingHandler struct {
+	server *mcpServer
+}
+
+// CreateMessage answers a sampling/createMessage request
+func (h *samplingHandler) CreateMessage(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	maxRequests := h.server.config.Sampling.MaxRequests
+	if maxRequests <= 0 {
+		maxRequests = defaultSamplingMaxRequests
+	}
+	maxTokens := h.server.config.Sampling.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultSamplingMaxTokens
+	}
+
+	host, err := h.server.samplingHost(maxRequests)
+	if err != nil {
+		log.Warn().Err(err).Str("server", h.server.name).Msg("MCP sampling request rejected")
+		return nil, err
+	}
+
+	if request.MaxTokens <= 0 || request.MaxTokens > maxTokens {
+		request.MaxTokens = maxTokens
+	}
+
+	log.Info().Str("server", h.server.name).Int("max_tokens", request.MaxTokens).Msg("MCP sampling request")
+	return host.CreateMessage(ctx, h.server.name, request)
+}
+
+// elicitationHandler passes the questions of a server to the host
+type elicitationHandler struct {
+	server *mcpServer
+}
+
+// Elicit answers an elicitation/create request
+func (h *elicitationHandler) Elicit(ctx context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	host, err := h.server.elicitationHost()
+	if err != nil {
+		log.Warn().Err(err).Str("server", h.server.name).Msg("MCP elicitation request rejected")
+		return nil, err
+	}
+
+	log.Info().Str("server", h.server.name).Msg("MCP elicitation request")
+	return host.Elicit(ctx, h.server.name, request)
+}
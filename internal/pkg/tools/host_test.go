@@ -0,0 +1,226 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"fmt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingHost answers server requests with fixed responses and remembers them
+type recordingHost struct {
+	mutex     sync.Mutex
+	maxTokens []int
+	messages  []string
+}
+
+func (h *recordingHost) CreateMessage(ctx context.Context, serverName string, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.maxTokens = append(h.maxTokens, request.MaxTokens)
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{Role: mcp.RoleAssistant, Content: mcp.NewTextContent("sampled by " + serverName)},
+		Model:           "test",
+		StopReason:      "endTurn",
+	}, nil
+}
+
+func (h *recordingHost) Elicit(ctx context.Context, serverName string, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.messages = append(h.messages, request.Params.Message)
+	return &mcp.ElicitationResult{ElicitationResponse: mcp.ElicitationResponse{
+		Action:  mcp.ElicitationResponseActionAccept,
+		Content: map[string]any{"name": "Ricky"},
+	}}, nil
+}
+
+const hostHelperVariable = "TOOLS_TEST_HOST_HELPER"
+
+// TestHostHelperServer is not a real test, it serves an MCP server on stdio whose tools request
+// completions and ask the user when started by the tests below
+func TestHostHelperServer(t *testing.T) {
+	if os.Getenv(hostHelperVariable) != "1" {
+		t.Skip("helper process")
+	}
+
+	mcpServer := server.NewMCPServer("host", "1.0.0", server.WithElicitation())
+	mcpServer.EnableSampling()
+
+	mcpServer.AddTool(mcp.NewTool("summarize", mcp.WithNumber("times")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var output []string
+			for range request.GetInt("times", 1) {
+				result, err := mcpServer.RequestSampling(ctx, mcp.CreateMessageRequest{
+					CreateMessageParams: mcp.CreateMessageParams{
+						Messages:  []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.NewTextContent("Summarize")}},
+						MaxTokens: 100000,
+					},
+				})
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				output = append(output, fmt.Sprint(result.Content))
+			}
+			return mcp.NewToolResultText(strings.Join(output, "\n")), nil
+		})
+
+	mcpServer.AddTool(mcp.NewTool("greet"),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := mcpServer.RequestElicitation(ctx, mcp.ElicitationRequest{
+				Params: mcp.ElicitationParams{
+					Message: "What is your name?",
+					RequestedSchema: map[string]any{
+						"type":       "object",
+						"properties": map[string]any{"name": map[string]any{"type": "string"}},
+					},
+				},
+			})
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprint(result.Content)), nil
+		})
+
+	_ = server.ServeStdio(mcpServer)
+	os.Exit(0)
+}
+
+// loadHostServer starts the host server and returns its tools by name
+func loadHostServer(t *testing.T, serverConfig mcpConfig.MCPServerConfig) map[string]tool.InvokableTool {
+	t.Helper()
+
+	serverConfig.Command = os.Args[0]
+	serverConfig.Args = []string{"-test.run=^TestHostHelperServer$"}
+	serverConfig.Env = []string{hostHelperVariable + "=1"}
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{"host": serverConfig},
+	})
+	assert.NoError(t, err)
+
+	tools := make(map[string]tool.InvokableTool)
+	for _, baseTool := range manager.GetTools() {
+		info, err := baseTool.Info(context.Background())
+		assert.NoError(t, err)
+		tools[info.Name] = baseTool.(tool.InvokableTool)
+	}
+	return tools
+}
+
+func TestSamplingPositive(t *testing.T) {
+	tools := loadHostServer(t, mcpConfig.MCPServerConfig{Sampling: mcpConfig.SamplingConfig{MaxTokens: 256}})
+	host := &recordingHost{}
+
+	output, err := tools["host__summarize"].InvokableRun(WithHost(context.Background(), host), `{}`)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "sampled by host")
+	assert.Equal(t, []int{256}, host.maxTokens)
+}
+
+func TestSamplingNegativeLimitReached(t *testing.T) {
+	tools := loadHostServer(t, mcpConfig.MCPServerConfig{Sampling: mcpConfig.SamplingConfig{MaxRequests: 1}})
+	host := &recordingHost{}
+	ctx := WithHost(context.Background(), host)
+
+	output, err := tools["host__summarize"].InvokableRun(ctx, `{"times":2}`)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "sampling limit of 1 requests per tool call reached")
+	assert.Len(t, host.maxTokens, 1)
+
+	// The next call has its own budget
+	output, err = tools["host__summarize"].InvokableRun(ctx, `{}`)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "sampled by host")
+	assert.Len(t, host.maxTokens, 2)
+}
+
+func TestSamplingNegativeWithoutHost(t *testing.T) {
+	tools := loadHostServer(t, mcpConfig.MCPServerConfig{})
+
+	result, err := tools["host__summarize"].(ResultTool).RunWithResult(context.Background(), `{}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+}
+
+func TestSamplingNegativeDisabled(t *testing.T) {
+	tools := loadHostServer(t, mcpConfig.MCPServerConfig{Sampling: mcpConfig.SamplingConfig{Disabled: true}})
+	host := &recordingHost{}
+
+	result, err := tools["host__summarize"].(ResultTool).RunWithResult(WithHost(context.Background(), host), `{}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Empty(t, host.maxTokens)
+}
+
+func TestElicitationPositive(t *testing.T) {
+	tools := loadHostServer(t, mcpConfig.MCPServerConfig{})
+	host := &recordingHost{}
+
+	output, err := tools["host__greet"].InvokableRun(WithHost(context.Background(), host), `{}`)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Ricky")
+	assert.Equal(t, []string{"What is your name?"}, host.messages)
+}
+
+func TestElicitationNegativeDisabled(t *testing.T) {
+	tools := loadHostServer(t, mcpConfig.MCPServerConfig{DisableElicitation: true})
+	host := &recordingHost{}
+
+	result, err := tools["host__greet"].(ResultTool).RunWithResult(WithHost(context.Background(), host), `{}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Empty(t, host.messages)
+}
+
+// waitingHost is a recording host whose questions wait until they are released
+type waitingHost struct {
+	recordingHost
+	asked   chan struct{}
+	release chan struct{}
+}
+
+func (h *waitingHost) Elicit(ctx context.Context, serverName string, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	h.asked <- struct{}{}
+	<-h.release
+	return h.recordingHost.Elicit(ctx, serverName, request)
+}
+
+func TestElicitationNegativeSeveralHosts(t *testing.T) {
+	tools := loadHostServer(t, mcpConfig.MCPServerConfig{})
+	first := &waitingHost{asked: make(chan struct{}, 1), release: make(chan struct{})}
+	second := &recordingHost{}
+
+	var output string
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		output, err = tools["host__greet"].InvokableRun(WithHost(context.Background(), first), `{}`)
+	}()
+	<-first.asked
+
+	// The question of the second session's call cannot be told apart from the first one's, it is refused
+	result, secondErr := tools["host__greet"].(ResultTool).RunWithResult(WithHost(context.Background(), second), `{}`)
+	assert.NoError(t, secondErr)
+	assert.True(t, result.IsError)
+	assert.Empty(t, second.messages)
+
+	close(first.release)
+	<-done
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Ricky")
+	assert.Equal(t, []string{"What is your name?"}, first.messages)
+}
@@ -0,0 +1,395 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"fmt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MCP server states reported in ServerStatus
+const (
+	ServerStateConnecting = "connecting"
+	ServerStateReady      = "ready"
+	ServerStateFailed     = "failed" // waiting for the next reconnect attempt
+	ServerStateStopped    = "stopped"
+)
+
+// ServerStatus describes the connection state of an MCP server
+type ServerStatus struct {
+	Name        string    `json:"name"`
+	Transport   string    `json:"transport"`
+	State       string    `json:"state"`
+	Tools       int       `json:"tools"`
+	Error       string    `json:"error,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt,omitzero"`
+	LastPingAt  time.Time `json:"lastPingAt,omitzero"`
+	NextRetryAt time.Time `json:"nextRetryAt,omitzero"`
+	Reconnects  int       `json:"reconnects"`
+}
+
+// mcpServer holds the client, tools and status of one configured MCP server
+type mcpServer struct {
+	name   string
+	config mcpConfig.MCPServerConfig
+	check  chan struct{} // asks the supervisor for an immediate health check
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the supervisor exits
+
+	toolsChanged atomic.Bool // set by tools/list_changed notifications
+
+	slots chan struct{} // server wide limit of concurrent tool calls, nil when unlimited
+
+	mutex        sync.RWMutex
+	client       client.MCPClient
+	capabilities mcp.ServerCapabilities
+	tools        []tool.BaseTool
+	status       ServerStatus
+	calls        []*hostCall // tool calls in progress, answering sampling and elicitation requests
+	limiters     map[string]*toolLimiter
+}
+
+func newMCPServer(ctx context.Context, name string, config mcpConfig.MCPServerConfig) *mcpServer {
+	ctx, cancel := context.WithCancel(ctx)
+	server := &mcpServer{
+		name:   name,
+		config: config,
+		check:  make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: ServerStatus{
+			Name:      name,
+			Transport: config.TransportType(),
+			State:     ServerStateConnecting,
+		},
+		limiters: make(map[string]*toolLimiter),
+	}
+	if config.MaxConcurrent > 0 {
+		server.slots = make(chan struct{}, config.MaxConcurrent)
+	}
+	return server
+}
+
+// Client returns the connected client or nil while the server is unavailable
+func (s *mcpServer) Client() client.MCPClient {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.status.State != ServerStateReady {
+		return nil
+	}
+	return s.client
+}
+
+// Tools returns the last known tools of the server
+func (s *mcpServer) Tools() []tool.BaseTool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.tools
+}
+
+// Status returns a copy of the server status
+func (s *mcpServer) Status() ServerStatus {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.status
+}
+
+func (s *mcpServer) setState(state string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.State = state
+}
+
+// Capabilities returns the capabilities announced by the server when it was last initialized
+func (s *mcpServer) Capabilities() mcp.ServerCapabilities {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.capabilities
+}
+
+// connected installs a freshly initialized client and its tools
+func (s *mcpServer) connected(mcpClient client.MCPClient, capabilities mcp.ServerCapabilities, tools []tool.BaseTool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.status.ConnectedAt.IsZero() {
+		s.status.Reconnects++
+	}
+	s.client = mcpClient
+	s.capabilities = capabilities
+	s.tools = tools
+	s.status.State = ServerStateReady
+	s.status.Tools = len(tools)
+	s.status.Error = ""
+	s.status.ConnectedAt = time.Now()
+	s.status.NextRetryAt = time.Time{}
+}
+
+// failed closes the client, if any, and records the error
+func (s *mcpServer) failed(err error) {
+	s.mutex.Lock()
+	mcpClient := s.client
+	s.client = nil
+	s.status.State = ServerStateFailed
+	s.status.Error = err.Error()
+	s.mutex.Unlock()
+
+	if mcpClient != nil {
+		_ = mcpClient.Close()
+	}
+}
+
+// setTools replaces the tools after the server reported a change
+func (s *mcpServer) setTools(tools []tool.BaseTool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tools = tools
+	s.status.Tools = len(tools)
+}
+
+func (s *mcpServer) scheduleRetry(at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.NextRetryAt = at
+}
+
+func (s *mcpServer) pinged() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status.LastPingAt = time.Now()
+}
+
+// requestCheck wakes the supervisor without blocking, a pending request is enough
+func (s *mcpServer) requestCheck() {
+	select {
+	case s.check <- struct{}{}:
+	default:
+	}
+}
+
+// stop closes the client for good
+func (s *mcpServer) stop() error {
+	s.mutex.Lock()
+	mcpClient := s.client
+	s.client = nil
+	s.status.State = ServerStateStopped
+	s.status.NextRetryAt = time.Time{}
+	s.mutex.Unlock()
+
+	if mcpClient == nil {
+		return nil
+	}
+	return mcpClient.Close()
+}
+
+// startServer connects a server and starts its supervisor, a failed first connection is retried by the supervisor
+func (m *MCPToolManager) startServer(ctx context.Context, server *mcpServer) {
+	m.mutex.Lock()
+	m.servers[server.name] = server
+	m.mutex.Unlock()
+
+	if err := m.connect(ctx, server); err != nil {
+		log.Error().Err(err).Str("server", server.name).Msg("MCP server failed to start, retrying in background")
+	}
+
+	m.wait.Add(1)
+	go m.supervise(server)
+}
+
+// stopServer stops the supervisor, closes the client and drops the server with its tools
+func (m *MCPToolManager) stopServer(server *mcpServer) error {
+	server.cancel()
+	<-server.done
+	err := server.stop()
+
+	m.mutex.Lock()
+	if m.servers[server.name] == server {
+		delete(m.servers, server.name)
+	}
+	m.mutex.Unlock()
+	m.rebuildTools()
+
+	return err
+}
+
+// connect creates, initializes and lists the tools of a server client, the client lives as long as the server
+func (m *MCPToolManager) connect(ctx context.Context, server *mcpServer) error {
+	server.setState(ServerStateConnecting)
+
+	mcpClient, err := m.createMCPClient(server.ctx, server.name, server.config, server.clientOptions()...)
+	if err != nil {
+		err = fmt.Errorf("failed to create MCP client for %s: %v", server.name, err)
+		server.failed(err)
+		return err
+	}
+
+	// Registered before initialization, a server may announce changes as soon as it is initialized
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == mcp.MethodNotificationToolsListChanged {
+			server.toolsChanged.Store(true)
+			server.requestCheck()
+		}
+	})
+
+	requestCtx, cancel := context.WithTimeout(ctx, m.requestTimeout)
+	defer cancel()
+
+	initResult, err := m.initializeClient(requestCtx, mcpClient)
+	if err != nil {
+		_ = mcpClient.Close()
+		err = fmt.Errorf("failed to initialize MCP client for %s: %v", server.name, err)
+		server.failed(err)
+		return err
+	}
+
+	// A server offering only resources or prompts has no tools to list
+	var serverTools []mcp.Tool
+	if initResult.Capabilities.Tools != nil {
+		listResults, err := mcpClient.ListTools(requestCtx, mcp.ListToolsRequest{})
+		if err != nil {
+			_ = mcpClient.Close()
+			err = fmt.Errorf("failed to list tools from server %s: %v", server.name, err)
+			server.failed(err)
+			return err
+		}
+		serverTools = listResults.Tools
+	}
+
+	tools, err := m.convertTools(server, serverTools)
+	if err != nil {
+		_ = mcpClient.Close()
+		server.failed(err)
+		return err
+	}
+
+	server.toolsChanged.Store(false)
+	server.connected(mcpClient, initResult.Capabilities, tools)
+	m.rebuildTools()
+	return nil
+}
+
+// refreshTools lists the tools of a connected server again
+func (m *MCPToolManager) refreshTools(server *mcpServer) error {
+	mcpClient := server.Client()
+	if mcpClient == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(server.ctx, m.requestTimeout)
+	defer cancel()
+
+	listResults, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		return err
+	}
+
+	tools, err := m.convertTools(server, listResults.Tools)
+	if err != nil {
+		return err
+	}
+
+	server.setTools(tools)
+	m.rebuildTools()
+	return nil
+}
+
+// supervise pings a ready server, refreshes its tools when they change and reconnects a failed one
+// with exponential backoff until the server is stopped
+func (m *MCPToolManager) supervise(server *mcpServer) {
+	defer m.wait.Done()
+	defer close(server.done)
+
+	backoff := m.minBackoff
+	for {
+		if server.Status().State != ServerStateReady {
+			server.scheduleRetry(time.Now().Add(backoff))
+			if !sleep(server.ctx, backoff, nil) {
+				return
+			}
+
+			if err := m.connect(server.ctx, server); err != nil {
+				if server.ctx.Err() != nil {
+					return
+				}
+				log.Warn().Err(err).Str("server", server.name).Dur("backoff", backoff).Msg("MCP server reconnect failed")
+				backoff = min(2*backoff, m.maxBackoff)
+				continue
+			}
+			log.Info().Str("server", server.name).Msg("MCP server reconnected")
+			backoff = m.minBackoff
+		}
+
+		if !sleep(server.ctx, m.pingInterval, server.check) {
+			return
+		}
+
+		if server.toolsChanged.Swap(false) {
+			if err := m.refreshTools(server); err != nil {
+				if server.ctx.Err() != nil {
+					return
+				}
+				log.Warn().Err(err).Str("server", server.name).Msg("MCP server tool refresh failed")
+				server.failed(fmt.Errorf("tool refresh failed: %v", err))
+			} else {
+				log.Info().Str("server", server.name).Msg("MCP server tools refreshed")
+			}
+			continue
+		}
+
+		if err := m.ping(server); err != nil {
+			if server.ctx.Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Str("server", server.name).Msg("MCP server health check failed")
+			server.failed(fmt.Errorf("health check failed: %v", err))
+		}
+	}
+}
+
+// ping checks that the server still answers requests
+func (m *MCPToolManager) ping(server *mcpServer) error {
+	mcpClient := server.Client()
+	if mcpClient == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(server.ctx, m.requestTimeout)
+	defer cancel()
+
+	if err := mcpClient.Ping(ctx); err != nil {
+		return err
+	}
+	server.pinged()
+	return nil
+}
+
+// sleep waits for the duration or a wake-up, it returns false when the context is done
+func sleep(ctx context.Context, duration time.Duration, wake <-chan struct{}) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	case <-wake:
+		return true
+	}
+}
@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultToolTimeout      = 2 * time.Minute
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+)
+
+// toolLimiter enforces the timeout, the concurrency limit and the circuit breaker of one tool.
+// Failed calls are calls that return an error or time out, error results of the tool itself do not count
+type toolLimiter struct {
+	limits mcpConfig.ToolLimits
+	slots  chan struct{} // nil when the concurrency is unlimited
+
+	mutex     sync.Mutex
+	failures  int // consecutive failed calls
+	openUntil time.Time
+	probing   bool // a trial call is let through after the open duration, the others wait for its outcome
+}
+
+func newToolLimiter(limits mcpConfig.ToolLimits) *toolLimiter {
+	if limits.Timeout == 0 {
+		limits.Timeout = defaultToolTimeout
+	}
+	if limits.FailureThreshold == 0 {
+		limits.FailureThreshold = defaultFailureThreshold
+	}
+	if limits.OpenDuration == 0 {
+		limits.OpenDuration = defaultOpenDuration
+	}
+
+	limiter := &toolLimiter{limits: limits}
+	if limits.MaxConcurrent > 0 {
+		limiter.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return limiter
+}
+
+// toolLimiter returns the limiter of a tool, it is kept while the server is configured
+// so the circuit state survives refreshed tool lists and reconnects
+func (s *mcpServer) toolLimiter(toolName string) *toolLimiter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	limiter, found := s.limiters[toolName]
+	if !found {
+		// The server wide concurrency limit is enforced with the server's slots
+		limits := s.config.ToolLimits
+		limits.MaxConcurrent = 0
+		limiter = newToolLimiter(limits.Merge(toolOverride(s.config.Tools, toolName).ToolLimits))
+		s.limiters[toolName] = limiter
+	}
+	return limiter
+}
+
+// toolOverride returns the settings configured for a single tool
+func toolOverride(tools map[string]mcpConfig.ToolSettings, toolName string) mcpConfig.ToolSettings {
+	for name, override := range tools {
+		// The configuration reader lowercases map keys
+		if strings.EqualFold(name, toolName) {
+			return override
+		}
+	}
+	return mcpConfig.ToolSettings{}
+}
+
+// toolGuard bounds the calls of one tool of a server or REST service
+type toolGuard struct {
+	server   string
+	toolName string // original tool name or operation id
+	cache    mcpConfig.ToolCache
+	limiter  *toolLimiter
+	slots    chan struct{} // server wide limit of concurrent calls, nil when unlimited
+}
+
+// guardedCall calls a tool through its result cache, timeout, concurrency limits and circuit breaker.
+// The call receives the context bounded by the timeout, its errors count as failures and error results do not
+func (m *MCPToolManager) guardedCall(ctx context.Context, name string, guard toolGuard, argumentsInJSON string,
+	call func(callCtx context.Context) (*ToolResult, error)) (*ToolResult, error) {
+
+	// Results of idempotent tools are reused for calls with the same arguments
+	cacheKey, cacheable := "", false
+	if guard.cache.Idempotent != nil && *guard.cache.Idempotent {
+		cacheKey, cacheable = newCacheKey(ctx, guard.cache, guard.server, guard.toolName, argumentsInJSON)
+	}
+	if cacheable {
+		if cached, found := m.cache.get(cacheKey, name); found {
+			return cached, nil
+		}
+	}
+
+	// Calls are bounded in time and number, a tool failing repeatedly is rejected for a while
+	limiter := guard.limiter
+	probe, err := limiter.allow()
+	if err != nil {
+		return &ToolResult{Text: err.Error(), IsError: true}, nil
+	}
+	if probe {
+		defer limiter.endProbe()
+	}
+	callCtx, cancel := limiter.timeout(ctx)
+	defer cancel()
+
+	release, err := acquire(callCtx, guard.slots, limiter.slots)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return &ToolResult{Text: fmt.Sprintf("tool call timed out after %s waiting for a free slot", limiter.limits.Timeout), IsError: true}, nil
+	}
+	defer release()
+
+	result, err := call(callCtx)
+	if ctx.Err() == nil {
+		limiter.record(err != nil)
+	}
+	if err != nil {
+		if ctx.Err() == nil && callCtx.Err() != nil {
+			return &ToolResult{Text: fmt.Sprintf("tool call timed out after %s", limiter.limits.Timeout), IsError: true}, nil
+		}
+		return nil, err
+	}
+
+	if cacheable && !result.IsError {
+		m.cache.put(cacheKey, result, guard.cache.CacheTTL)
+	}
+	return result, nil
+}
+
+// timeout returns the context bounding a call, a negative timeout leaves the call unbounded
+func (l *toolLimiter) timeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.limits.Timeout < 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, l.limits.Timeout)
+}
+
+// allow rejects calls while the circuit is open. After the open duration a single call is let through
+// as a probe, it reports true and the caller ends it with endProbe once the call is over
+func (l *toolLimiter) allow() (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if wait := time.Until(l.openUntil); wait > 0 {
+		return false, fmt.Errorf("tool is unavailable after %d consecutive failures, retry in %s", l.failures, wait.Round(time.Second))
+	}
+	if l.failures < l.limits.FailureThreshold {
+		return false, nil
+	}
+	if l.probing {
+		return false, fmt.Errorf("tool is unavailable after %d consecutive failures, a trial call is in progress", l.failures)
+	}
+	l.probing = true
+	return true, nil
+}
+
+// endProbe lets the next call probe the tool when the probe ended without being recorded, e.g. when it was cancelled
+func (l *toolLimiter) endProbe() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.probing = false
+}
+
+// record counts consecutive failures and opens the circuit when they reach the threshold,
+// a failed probe opens it again for the open duration and a successful one closes it
+func (l *toolLimiter) record(failed bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.probing = false
+	if !failed {
+		l.failures = 0
+		return
+	}
+	l.failures++
+	if l.failures >= l.limits.FailureThreshold {
+		l.openUntil = time.Now().Add(l.limits.OpenDuration)
+	}
+}
+
+// acquire waits for a free slot in each of the given slot channels, nil channels are unlimited.
+// The returned function releases the slots
+func acquire(ctx context.Context, slotChannels ...chan struct{}) (func(), error) {
+	var acquired []chan struct{}
+	release := func() {
+		for _, slots := range acquired {
+			<-slots
+		}
+	}
+
+	for _, slots := range slotChannels {
+		if slots == nil {
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+			acquired = append(acquired, slots)
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
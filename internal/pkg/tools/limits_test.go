@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// loadSlowServer serves a tool sleeping for the given milliseconds and returns it
+func loadSlowServer(t *testing.T, serverConfig mcpConfig.MCPServerConfig) ResultTool {
+	t.Helper()
+
+	mcpServer := server.NewMCPServer("slow", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("sleep", mcp.WithNumber("milliseconds")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			select {
+			case <-time.After(time.Duration(request.GetInt("milliseconds", 0)) * time.Millisecond):
+				return mcp.NewToolResultText("awake"), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		})
+	httpServer := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer))
+	t.Cleanup(httpServer.Close)
+
+	serverConfig.Transport = mcpConfig.TransportStreamableHTTP
+	serverConfig.URL = httpServer.URL + "/mcp"
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{"slow": serverConfig},
+	})
+	assert.NoError(t, err)
+	if !assert.Len(t, manager.GetTools(), 1) {
+		t.FailNow()
+	}
+	return manager.GetTools()[0].(ResultTool)
+}
+
+func TestToolLimitsPositive(t *testing.T) {
+	sleepTool := loadSlowServer(t, mcpConfig.MCPServerConfig{ToolLimits: mcpConfig.ToolLimits{Timeout: time.Second}})
+
+	result, err := sleepTool.RunWithResult(context.Background(), `{"milliseconds":10}`)
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Equal(t, "awake", result.Text)
+}
+
+func TestToolLimitsNegativeTimeoutOpensCircuit(t *testing.T) {
+	sleepTool := loadSlowServer(t, mcpConfig.MCPServerConfig{
+		ToolLimits: mcpConfig.ToolLimits{FailureThreshold: 1, OpenDuration: time.Minute},
+		Tools:      map[string]mcpConfig.ToolSettings{"sleep": {ToolLimits: mcpConfig.ToolLimits{Timeout: 50 * time.Millisecond}}},
+	})
+
+	result, err := sleepTool.RunWithResult(context.Background(), `{"milliseconds":5000}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Equal(t, "tool call timed out after 50ms", result.Text)
+
+	// The first failure reached the threshold, the next call is rejected without reaching the server
+	result, err = sleepTool.RunWithResult(context.Background(), `{"milliseconds":0}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text, "tool is unavailable after 1 consecutive failures")
+}
+
+func TestToolLimiterPositiveCircuitCloses(t *testing.T) {
+	limiter := newToolLimiter(mcpConfig.ToolLimits{FailureThreshold: 2, OpenDuration: 20 * time.Millisecond})
+
+	limiter.record(true)
+	_, err := limiter.allow()
+	assert.NoError(t, err)
+	limiter.record(true)
+	_, err = limiter.allow()
+	assert.Error(t, err)
+
+	time.Sleep(30 * time.Millisecond)
+	probe, err := limiter.allow()
+	assert.NoError(t, err)
+	assert.True(t, probe)
+
+	// A successful probe closes the circuit and resets the count
+	limiter.record(false)
+	limiter.record(true)
+	probe, err = limiter.allow()
+	assert.NoError(t, err)
+	assert.False(t, probe)
+}
+
+func TestToolLimiterNegativeSingleProbe(t *testing.T) {
+	limiter := newToolLimiter(mcpConfig.ToolLimits{FailureThreshold: 1, OpenDuration: 20 * time.Millisecond})
+	limiter.record(true)
+	time.Sleep(30 * time.Millisecond)
+
+	// Concurrent calls after the open duration: one probes, the others are rejected until it resolves
+	probes := 0
+	for range 5 {
+		if probe, err := limiter.allow(); err == nil {
+			assert.True(t, probe)
+			probes++
+		}
+	}
+	assert.Equal(t, 1, probes)
+
+	// A failed probe opens the circuit again
+	limiter.record(true)
+	_, err := limiter.allow()
+	assert.ErrorContains(t, err, "retry in")
+
+	// A probe ending without an outcome lets the next call probe
+	time.Sleep(30 * time.Millisecond)
+	probe, err := limiter.allow()
+	assert.True(t, probe)
+	assert.NoError(t, err)
+	limiter.endProbe()
+	probe, err = limiter.allow()
+	assert.True(t, probe)
+	assert.NoError(t, err)
+}
+
+func TestAcquireNegativeNoFreeSlot(t *testing.T) {
+	serverSlots := make(chan struct{}, 2)
+	toolSlots := make(chan struct{}, 1)
+
+	release, err := acquire(context.Background(), serverSlots, nil, toolSlots)
+	assert.NoError(t, err)
+	assert.Len(t, serverSlots, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = acquire(ctx, serverSlots, toolSlots)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, serverSlots, 1, "the server slot taken before waiting is released")
+
+	release()
+	assert.Empty(t, serverSlots)
+	assert.Empty(t, toolSlots)
+}
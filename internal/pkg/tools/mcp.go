@@ -2,6 +2,7 @@ package tools
 
 import (
 	"ai-chat/internal/pkg/mcpConfig"
+	"ai-chat/internal/pkg/policy"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,119 +11,274 @@ import (
 	"github.com/cloudwego/eino/schema"
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog/log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// MCPToolManager manages MCP tools and clients
+const (
+	defaultPingInterval   = 30 * time.Second
+	defaultRequestTimeout = 30 * time.Second
+	defaultMinBackoff     = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+)
+
+// MCPToolManager manages MCP tools and clients, each server is supervised and reconnected on its own
 type MCPToolManager struct {
-	clients map[string]client.MCPClient
-	tools   []tool.BaseTool
-	toolMap map[string]*toolMapping // maps prefixed tool names to their server and original name
+	reloadMutex sync.Mutex // serializes LoadTools and Reload
+	mutex       sync.RWMutex
+	servers     map[string]*mcpServer
+	tools       []tool.BaseTool
+	toolMap     map[string]*toolMapping    // maps prefixed tool names to their server and original name
+	services    map[string]*openAPIService // REST services attached through their OpenAPI document
+	resultLimit int                        // characters of a tool result passed to the model
+	selection   mcpConfig.ToolSelectionConfig
+	artifacts   *ArtifactStore
+	cache       *resultCache                   // results of idempotent tools
+	toolPolicy  *atomic.Pointer[policy.Policy] // guards the resources and prompts of the servers, nil allows all
+
+	ctx    context.Context // lifetime of the clients and supervisors, cancelled by Close
+	cancel context.CancelFunc
+	wait   sync.WaitGroup
+
+	pingInterval   time.Duration
+	requestTimeout time.Duration
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
 }
 
 // toolMapping stores the mapping between prefixed tool names and their original details
 type toolMapping struct {
 	serverName   string
 	originalName string
-	client       client.MCPClient
+	server       *mcpServer
 }
 
 // mcpToolImpl implements the eino tool interface with server prefixing
 type mcpToolImpl struct {
-	info    *schema.ToolInfo
-	mapping *toolMapping
+	info        *schema.ToolInfo
+	inputSchema *openapi3.Schema // arguments are validated against it before the call, nil when it cannot be checked
+	mapping     *toolMapping
+	manager     *MCPToolManager
 }
 
 // NewMCPToolManager creates a new MCP tool manager
 func NewMCPToolManager() *MCPToolManager {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &MCPToolManager{
-		clients: make(map[string]client.MCPClient),
-		tools:   make([]tool.BaseTool, 0),
-		toolMap: make(map[string]*toolMapping),
+		servers:        make(map[string]*mcpServer),
+		tools:          make([]tool.BaseTool, 0),
+		toolMap:        make(map[string]*toolMapping),
+		resultLimit:    defaultResultLimit,
+		artifacts:      NewArtifactStore(defaultArtifactStoreSize),
+		cache:          newResultCache(defaultCacheMaxEntries),
+		ctx:            ctx,
+		cancel:         cancel,
+		pingInterval:   defaultPingInterval,
+		requestTimeout: defaultRequestTimeout,
+		minBackoff:     defaultMinBackoff,
+		maxBackoff:     defaultMaxBackoff,
 	}
 }
 
-// LoadTools loads tools from MCP servers based on configuration
+// LoadTools connects to the configured MCP servers and loads their tools, a server that fails to start
+// does not prevent the others from loading and is retried in the background
 func (m *MCPToolManager) LoadTools(ctx context.Context, config *mcpConfig.Config) error {
-	for serverName, serverConfig := range config.MCPServers {
-		client, err := m.createMCPClient(ctx, serverName, serverConfig)
-		if err != nil {
-			return fmt.Errorf("failed to create MCP client for %s: %v", serverName, err)
+	serverNames := make([]string, 0, len(config.MCPServers))
+	for serverName := range config.MCPServers {
+		serverNames = append(serverNames, serverName)
+	}
+	sort.Strings(serverNames)
+
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+
+	m.setResultLimit(config.ToolResultLimit)
+	m.setSelection(config.ToolSelection)
+
+	for _, serverName := range serverNames {
+		m.mutex.RLock()
+		_, exists := m.servers[serverName]
+		m.mutex.RUnlock()
+		if exists {
+			return fmt.Errorf("MCP server %s is already loaded", serverName)
 		}
 
-		m.clients[serverName] = client
+		m.startServer(ctx, newMCPServer(m.ctx, serverName, config.MCPServers[serverName]))
+	}
+
+	m.loadOpenAPIServices(ctx, config)
+
+	return nil
+}
+
+// Reload applies a changed configuration: removed servers are stopped, added servers are started and
+// servers whose settings changed are restarted, the others keep their connection
+func (m *MCPToolManager) Reload(ctx context.Context, config *mcpConfig.Config) {
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+
+	m.setResultLimit(config.ToolResultLimit)
+	m.setSelection(config.ToolSelection)
 
-		// Initialize the client
-		if err := m.initializeClient(ctx, client); err != nil {
-			return fmt.Errorf("failed to initialize MCP client for %s: %v", serverName, err)
+	m.mutex.RLock()
+	current := make(map[string]*mcpServer, len(m.servers))
+	for serverName, server := range m.servers {
+		current[serverName] = server
+	}
+	m.mutex.RUnlock()
+
+	for serverName, server := range current {
+		serverConfig, configured := config.MCPServers[serverName]
+		if configured && reflect.DeepEqual(serverConfig, server.config) {
+			continue
 		}
 
-		// Get tools from this server
-		listResults, err := client.ListTools(ctx, mcp.ListToolsRequest{})
-		if err != nil {
-			return fmt.Errorf("failed to list tools from server %s: %v", serverName, err)
+		if err := m.stopServer(server); err != nil {
+			log.Warn().Err(err).Str("server", serverName).Msg("MCP server close failed")
+		}
+		if configured {
+			log.Info().Str("server", serverName).Msg("MCP server configuration changed, restarting")
+		} else {
+			log.Info().Str("server", serverName).Msg("MCP server removed")
 		}
+	}
 
-		// Create name set for allowed tools
-		var nameSet map[string]struct{}
-		if len(serverConfig.AllowedTools) > 0 {
-			nameSet = make(map[string]struct{})
-			for _, name := range serverConfig.AllowedTools {
-				nameSet[name] = struct{}{}
-			}
+	serverNames := make([]string, 0, len(config.MCPServers))
+	for serverName := range config.MCPServers {
+		serverNames = append(serverNames, serverName)
+	}
+	sort.Strings(serverNames)
+
+	for _, serverName := range serverNames {
+		m.mutex.RLock()
+		_, running := m.servers[serverName]
+		m.mutex.RUnlock()
+		if running {
+			continue
 		}
 
-		// Convert MCP tools to eino tools with prefixed names
-		for _, mcpTool := range listResults.Tools {
-			// Filter tools based on allowedTools/excludedTools
-			if len(serverConfig.AllowedTools) > 0 {
-				if _, ok := nameSet[mcpTool.Name]; !ok {
-					continue
-				}
-			}
+		log.Info().Str("server", serverName).Msg("MCP server starting")
+		m.startServer(ctx, newMCPServer(m.ctx, serverName, config.MCPServers[serverName]))
+	}
+
+	m.loadOpenAPIServices(ctx, config)
+}
+
+// convertTools converts the MCP tools of a server to eino tools with prefixed names
+func (m *MCPToolManager) convertTools(server *mcpServer, mcpTools []mcp.Tool) ([]tool.BaseTool, error) {
+	serverName := server.name
+	serverConfig := server.config
+
+	// Create name set for allowed tools
+	var nameSet map[string]struct{}
+	if len(serverConfig.AllowedTools) > 0 {
+		nameSet = make(map[string]struct{})
+		for _, name := range serverConfig.AllowedTools {
+			nameSet[name] = struct{}{}
+		}
+	}
 
-			// Check if tool should be excluded
-			if m.shouldExcludeTool(mcpTool.Name, serverConfig) {
+	tools := make([]tool.BaseTool, 0, len(mcpTools))
+	for _, mcpTool := range mcpTools {
+		// Filter tools based on allowedTools/excludedTools
+		if len(serverConfig.AllowedTools) > 0 {
+			if _, ok := nameSet[mcpTool.Name]; !ok {
 				continue
 			}
+		}
 
-			// Convert schema
-			marshaledInputSchema, err := sonic.Marshal(mcpTool.InputSchema)
-			if err != nil {
-				return fmt.Errorf("conv mcp tool input schema fail(marshal): %w, tool name: %s", err, mcpTool.Name)
-			}
-			inputSchema := &openapi3.Schema{}
-			err = sonic.Unmarshal(marshaledInputSchema, inputSchema)
-			if err != nil {
-				return fmt.Errorf("conv mcp tool input schema fail(unmarshal): %w, tool name: %s", err, mcpTool.Name)
-			}
+		// Check if tool should be excluded
+		if m.shouldExcludeTool(mcpTool.Name, serverConfig) {
+			continue
+		}
 
-			// Create prefixed tool name
-			prefixedName := fmt.Sprintf("%s__%s", serverName, mcpTool.Name)
+		// Convert schema
+		marshaledInputSchema, err := sonic.Marshal(mcpTool.InputSchema)
+		if err != nil {
+			return nil, fmt.Errorf("conv mcp tool input schema fail(marshal): %w, tool name: %s", err, mcpTool.Name)
+		}
+		inputSchema := &openapi3.Schema{}
+		err = sonic.Unmarshal(marshaledInputSchema, inputSchema)
+		if err != nil {
+			return nil, fmt.Errorf("conv mcp tool input schema fail(unmarshal): %w, tool name: %s", err, mcpTool.Name)
+		}
+
+		// Create prefixed tool name
+		prefixedName := fmt.Sprintf("%s__%s", serverName, mcpTool.Name)
+
+		validationSchema := checkableSchema(marshaledInputSchema)
+		if validationSchema == nil && !serverConfig.DisableValidation {
+			log.Warn().Str("tool", prefixedName).Msg("MCP tool input schema cannot be fully checked, arguments are sent unchecked")
+		}
 
-			// Create tool mapping
-			mapping := &toolMapping{
+		// Create eino tool
+		tools = append(tools, &mcpToolImpl{
+			info: &schema.ToolInfo{
+				Name:        prefixedName,
+				Desc:        mcpTool.Description,
+				ParamsOneOf: schema.NewParamsOneOfByOpenAPIV3(inputSchema),
+			},
+			inputSchema: validationSchema,
+			mapping: &toolMapping{
 				serverName:   serverName,
 				originalName: mcpTool.Name,
-				client:       client,
-			}
-			m.toolMap[prefixedName] = mapping
-
-			// Create eino tool
-			einoTool := &mcpToolImpl{
-				info: &schema.ToolInfo{
-					Name:        prefixedName,
-					Desc:        mcpTool.Description,
-					ParamsOneOf: schema.NewParamsOneOfByOpenAPIV3(inputSchema),
-				},
-				mapping: mapping,
-			}
+				server:       server,
+			},
+			manager: m,
+		})
+	}
 
-			m.tools = append(m.tools, einoTool)
+	return tools, nil
+}
+
+// rebuildTools collects the tools of all servers, a disconnected server keeps its last known tools.
+// The slice is replaced rather than modified, so a GetTools result stays stable for the rest of an agent turn
+func (m *MCPToolManager) rebuildTools() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	serverNames := make([]string, 0, len(m.servers))
+	for serverName := range m.servers {
+		serverNames = append(serverNames, serverName)
+	}
+	sort.Strings(serverNames)
+
+	tools := make([]tool.BaseTool, 0, len(m.tools))
+	toolMap := make(map[string]*toolMapping, len(m.toolMap))
+	hasResources := false
+	for _, serverName := range serverNames {
+		hasResources = hasResources || m.servers[serverName].Capabilities().Resources != nil
+		for _, serverTool := range m.servers[serverName].Tools() {
+			mcpTool := serverTool.(*mcpToolImpl)
+			tools = append(tools, mcpTool)
+			toolMap[mcpTool.info.Name] = mcpTool.mapping
 		}
 	}
 
-	return nil
+	// REST services follow the MCP servers
+	serviceNames := make([]string, 0, len(m.services))
+	for serviceName := range m.services {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+	for _, serviceName := range serviceNames {
+		tools = append(tools, m.services[serviceName].tools...)
+	}
+
+	if hasResources {
+		tools = append(tools, m.resourceTools()...)
+	}
+
+	m.tools = tools
+	m.toolMap = toolMap
 }
 
 // Info returns the tool information
@@ -130,50 +286,150 @@ func (t *mcpToolImpl) Info(ctx context.Context) (*schema.ToolInfo, error) {
 	return t.info, nil
 }
 
-// InvokableRun executes the tool by mapping back to the original name and server
+// InvokableRun executes the tool and returns the text of its result
 func (t *mcpToolImpl) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
-	result, err := t.mapping.client.CallTool(ctx, mcp.CallToolRequest{
-		Request: mcp.Request{
-			Method: "tools/call",
-		},
-		Params: struct {
-			Name      string    `json:"name"`
-			Arguments any       `json:"arguments,omitempty"`
-			Meta      *mcp.Meta `json:"_meta,omitempty"`
-		}{
-			Name:      t.mapping.originalName, // Use original name, not prefixed
-			Arguments: json.RawMessage(argumentsInJSON),
-		},
-	})
+	result, err := t.RunWithResult(ctx, argumentsInJSON)
 	if err != nil {
-		return "", fmt.Errorf("failed to call mcp tool: %w", err)
+		return "", err
 	}
+	return result.Text, nil
+}
 
-	marshaledResult, err := sonic.MarshalString(result)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal mcp tool result: %w", err)
+// RunWithResult executes the tool by mapping back to the original name and server
+func (t *mcpToolImpl) RunWithResult(ctx context.Context, argumentsInJSON string) (*ToolResult, error) {
+	mcpClient := t.mapping.server.Client()
+	if mcpClient == nil {
+		return nil, fmt.Errorf("MCP server %s is unavailable", t.mapping.serverName)
+	}
+
+	// Invalid arguments are returned to the model to correct them without a round trip to the server
+	serverConfig := t.mapping.server.config
+	if !serverConfig.DisableValidation {
+		validated, err := validateArguments(t.inputSchema, argumentsInJSON, !serverConfig.DisableCoercion)
+		if err != nil {
+			return &ToolResult{Text: err.Error(), IsError: true}, nil
+		}
+		argumentsInJSON = validated
 	}
 
-	// If the MCP server returned an error, we still return the error content as the response
-	// to the LLM so it can see what went wrong. The error will be shown to the user via
-	// the UI callbacks, but the LLM needs to see the actual error details to continue
-	// the conversation appropriately.
-	return marshaledResult, nil
+	server := t.mapping.server
+	guard := toolGuard{
+		server:   t.mapping.serverName,
+		toolName: t.mapping.originalName,
+		cache:    server.cacheSettings(t.mapping.originalName),
+		limiter:  server.toolLimiter(t.mapping.originalName),
+		slots:    server.slots,
+	}
+	return t.manager.guardedCall(ctx, t.info.Name, guard, argumentsInJSON, func(callCtx context.Context) (*ToolResult, error) {
+		// Sampling and elicitation requests sent by the server during the call are answered by the caller's host
+		if host := hostFromContext(ctx); host != nil {
+			defer server.enterCall(host)()
+		}
+
+		result, err := mcpClient.CallTool(callCtx, mcp.CallToolRequest{
+			Request: mcp.Request{
+				Method: "tools/call",
+			},
+			Params: mcp.CallToolParams{
+				Name:      t.mapping.originalName, // Use original name, not prefixed
+				Arguments: json.RawMessage(argumentsInJSON),
+			},
+		})
+		if err != nil {
+			// The server may have crashed, let the supervisor check it now rather than at the next ping
+			if callCtx.Err() == nil {
+				server.requestCheck()
+			}
+			return nil, fmt.Errorf("failed to call mcp tool: %w", err)
+		}
+
+		// If the MCP server returned an error, we still return the error content as the response
+		// to the LLM so it can see what went wrong. The error will be shown to the user via
+		// the UI callbacks, but the LLM needs to see the actual error details to continue
+		// the conversation appropriately.
+		return t.manager.convertResult(t.info.Name, result), nil
+	})
+}
+
+// setResultLimit sets the characters of a tool result passed to the model, zero keeps the default
+func (m *MCPToolManager) setResultLimit(limit int) {
+	if limit == 0 {
+		limit = defaultResultLimit
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.resultLimit = limit
+}
+
+// setSelection sets how the tools offered per turn are selected
+func (m *MCPToolManager) setSelection(selection mcpConfig.ToolSelectionConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.selection = selection
+}
+
+// Selection returns how the tools offered per turn are selected
+func (m *MCPToolManager) Selection() mcpConfig.ToolSelectionConfig {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.selection
+}
+
+// ResultLimit returns the characters of a tool result passed to the model, negative means unlimited
+func (m *MCPToolManager) ResultLimit() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.resultLimit
+}
+
+// Artifact returns a stored tool artifact and its data
+func (m *MCPToolManager) Artifact(id string) (Artifact, []byte, bool) {
+	return m.artifacts.Get(id)
 }
 
 // GetTools returns all loaded tools
 func (m *MCPToolManager) GetTools() []tool.BaseTool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
 	return m.tools
 }
 
-// Close closes all MCP clients
+// ServerStatuses returns the status of every configured server ordered by name
+func (m *MCPToolManager) ServerStatuses() []ServerStatus {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	statuses := make([]ServerStatus, 0, len(m.servers))
+	for _, server := range m.servers {
+		statuses = append(statuses, server.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Close stops the supervisors and closes all MCP clients
 func (m *MCPToolManager) Close() error {
-	for name, client := range m.clients {
-		if err := client.Close(); err != nil {
-			return fmt.Errorf("failed to close client %s: %v", name, err)
+	m.cancel()
+	m.wait.Wait()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var closeErr error
+	for name, server := range m.servers {
+		if err := server.stop(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("failed to close client %s: %v", name, err)
 		}
 	}
-	return nil
+	return closeErr
 }
 
 // shouldExcludeTool determines if a tool should be excluded based on excludedTools
@@ -190,13 +446,20 @@ func (m *MCPToolManager) shouldExcludeTool(toolName string, serverConfig mcpConf
 	return false
 }
 
-func (m *MCPToolManager) createMCPClient(ctx context.Context, serverName string, serverConfig mcpConfig.MCPServerConfig) (client.MCPClient, error) {
-	if serverConfig.Command != "" {
-		// STDIO client
-		return client.NewStdioMCPClient(serverConfig.Command, nil, serverConfig.Args...)
-	} else if serverConfig.URL != "" {
-		// SSE client
-		sseClient, err := client.NewSSEMCPClient(serverConfig.URL)
+// createMCPClient creates and starts the client of a server, the options declare the requests the client answers
+// and are ignored by the SSE transport which cannot receive requests from the server
+func (m *MCPToolManager) createMCPClient(ctx context.Context, serverName string, serverConfig mcpConfig.MCPServerConfig, options ...client.ClientOption) (client.MCPClient, error) {
+	switch serverConfig.TransportType() {
+	case mcpConfig.TransportStdio:
+		if serverConfig.Command == "" {
+			return nil, fmt.Errorf("invalid server configuration for %s: command is required for stdio", serverName)
+		}
+		return newStdioMCPClient(ctx, serverConfig, options...)
+	case mcpConfig.TransportSSE:
+		if serverConfig.URL == "" {
+			return nil, fmt.Errorf("invalid server configuration for %s: url is required for sse", serverName)
+		}
+		sseClient, err := client.NewSSEMCPClient(serverConfig.URL, client.WithHeaders(expandHeaders(serverConfig.Headers)))
 		if err != nil {
 			return nil, err
 		}
@@ -207,12 +470,45 @@ func (m *MCPToolManager) createMCPClient(ctx context.Context, serverName string,
 		}
 
 		return sseClient, nil
+	case mcpConfig.TransportStreamableHTTP:
+		if serverConfig.URL == "" {
+			return nil, fmt.Errorf("invalid server configuration for %s: url is required for streamable-http", serverName)
+		}
+		httpOptions := []transport.StreamableHTTPCOption{transport.WithHTTPHeaders(expandHeaders(serverConfig.Headers))}
+		if len(options) > 0 {
+			// Servers may send their requests on the listening stream rather than with the tool call response
+			httpOptions = append(httpOptions, transport.WithContinuousListening())
+		}
+		httpTransport, err := transport.NewStreamableHTTP(serverConfig.URL, httpOptions...)
+		if err != nil {
+			return nil, err
+		}
+		httpClient := client.NewClient(httpTransport, options...)
+
+		if err := httpClient.Start(ctx); err != nil {
+			return nil, fmt.Errorf("failed to start streamable HTTP client: %v", err)
+		}
+
+		return httpClient, nil
 	}
 
-	return nil, fmt.Errorf("invalid server configuration for %s: must specify either command or url", serverName)
+	return nil, fmt.Errorf("invalid server configuration for %s: unsupported transport %s", serverName, serverConfig.Transport)
+}
+
+// expandHeaders parses "Name: value" headers and expands environment variables in the values
+func expandHeaders(headers []string) map[string]string {
+	result := make(map[string]string, len(headers))
+	for _, header := range headers {
+		name, value, found := strings.Cut(header, ":")
+		if !found {
+			continue
+		}
+		result[strings.TrimSpace(name)] = os.ExpandEnv(strings.TrimSpace(value))
+	}
+	return result
 }
 
-func (m *MCPToolManager) initializeClient(ctx context.Context, client client.MCPClient) error {
+func (m *MCPToolManager) initializeClient(ctx context.Context, client client.MCPClient) (*mcp.InitializeResult, error) {
 	initRequest := mcp.InitializeRequest{}
 	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
 	initRequest.Params.ClientInfo = mcp.Implementation{
@@ -220,6 +516,5 @@ func (m *MCPToolManager) initializeClient(ctx context.Context, client client.MCP
 		Version: "1.0.0",
 	}
 
-	_, err := client.Initialize(ctx, initRequest)
-	return err
+	return client.Initialize(ctx, initRequest)
 }
@@ -0,0 +1,286 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newEchoMCPServer creates an in-process MCP server with a single echo tool
+func newEchoMCPServer() *server.MCPServer {
+	mcpServer := server.NewMCPServer("echo", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("echo", mcp.WithString("text", mcp.Required())),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(request.GetString("text", "")), nil
+		})
+	return mcpServer
+}
+
+// headerRecorder remembers the Authorization header of every request passed to the wrapped handler
+type headerRecorder struct {
+	mutex          sync.Mutex
+	authorizations []string
+	handler        http.Handler
+}
+
+func (h *headerRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	h.authorizations = append(h.authorizations, r.Header.Get("Authorization"))
+	h.mutex.Unlock()
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *headerRecorder) all() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]string(nil), h.authorizations...)
+}
+
+// callEcho loads the tools of a single server and calls its echo tool
+func callEcho(t *testing.T, serverConfig mcpConfig.MCPServerConfig) string {
+	t.Helper()
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{"remote": serverConfig},
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, manager.GetTools(), 1) {
+		return ""
+	}
+
+	echoTool := manager.GetTools()[0]
+	info, err := echoTool.Info(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "remote__echo", info.Name)
+
+	output, err := echoTool.(tool.InvokableTool).InvokableRun(context.Background(), `{"text":"hello"}`)
+	assert.NoError(t, err)
+	return output
+}
+
+func TestLoadToolsPositiveStreamableHTTP(t *testing.T) {
+	recorder := &headerRecorder{handler: server.NewStreamableHTTPServer(newEchoMCPServer())}
+	httpServer := httptest.NewServer(recorder)
+	t.Cleanup(httpServer.Close)
+	t.Setenv("TEST_MCP_TOKEN", "secret")
+
+	output := callEcho(t, mcpConfig.MCPServerConfig{
+		Transport: mcpConfig.TransportStreamableHTTP,
+		URL:       httpServer.URL + "/mcp",
+		Headers:   []string{"Authorization: Bearer ${TEST_MCP_TOKEN}"},
+	})
+
+	assert.Contains(t, output, "hello")
+	assert.NotEmpty(t, recorder.all())
+	for _, authorization := range recorder.all() {
+		assert.Equal(t, "Bearer secret", authorization)
+	}
+}
+
+func TestLoadToolsPositiveSSE(t *testing.T) {
+	recorder := &headerRecorder{}
+	httpServer := httptest.NewServer(recorder)
+	t.Cleanup(httpServer.Close)
+	recorder.handler = server.NewSSEServer(newEchoMCPServer(), server.WithBaseURL(httpServer.URL))
+	t.Setenv("TEST_MCP_TOKEN", "secret")
+
+	output := callEcho(t, mcpConfig.MCPServerConfig{
+		URL:     httpServer.URL + "/sse",
+		Headers: []string{"Authorization: Bearer ${TEST_MCP_TOKEN}"},
+	})
+
+	assert.Contains(t, output, "hello")
+	assert.NotEmpty(t, recorder.all())
+	for _, authorization := range recorder.all() {
+		assert.Equal(t, "Bearer secret", authorization)
+	}
+}
+
+func TestLoadToolsNegativeMissingURL(t *testing.T) {
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{
+			"remote": {Transport: mcpConfig.TransportStreamableHTTP},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, manager.GetTools())
+
+	statuses := manager.ServerStatuses()
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, ServerStateFailed, statuses[0].State)
+		assert.Equal(t, "failed to create MCP client for remote: invalid server configuration for remote: url is required for streamable-http", statuses[0].Error)
+	}
+}
+
+func TestLoadToolsPositiveDegradedStartup(t *testing.T) {
+	httpServer := httptest.NewServer(server.NewStreamableHTTPServer(newEchoMCPServer()))
+	t.Cleanup(httpServer.Close)
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{
+			"broken": {Command: "/nonexistent/mcp-server"},
+			"remote": {Transport: mcpConfig.TransportStreamableHTTP, URL: httpServer.URL + "/mcp"},
+		},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, manager.GetTools(), 1) {
+		info, _ := manager.GetTools()[0].Info(context.Background())
+		assert.Equal(t, "remote__echo", info.Name)
+	}
+
+	statuses := manager.ServerStatuses()
+	if assert.Len(t, statuses, 2) {
+		assert.Equal(t, "broken", statuses[0].Name)
+		assert.Equal(t, ServerStateFailed, statuses[0].State)
+		assert.Contains(t, statuses[0].Error, "failed to start command")
+
+		assert.Equal(t, "remote", statuses[1].Name)
+		assert.Equal(t, mcpConfig.TransportStreamableHTTP, statuses[1].Transport)
+		assert.Equal(t, ServerStateReady, statuses[1].State)
+		assert.Equal(t, 1, statuses[1].Tools)
+	}
+}
+
+func TestLoadToolsPositiveReconnect(t *testing.T) {
+	var available atomic.Bool
+	available.Store(true)
+	mcpHandler := server.NewStreamableHTTPServer(newEchoMCPServer())
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		mcpHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(httpServer.Close)
+
+	manager := NewMCPToolManager()
+	manager.pingInterval = 10 * time.Millisecond
+	manager.minBackoff = 10 * time.Millisecond
+	manager.maxBackoff = 20 * time.Millisecond
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{
+			"remote": {Transport: mcpConfig.TransportStreamableHTTP, URL: httpServer.URL + "/mcp"},
+		},
+	})
+	assert.NoError(t, err)
+
+	available.Store(false)
+	assert.Eventually(t, func() bool {
+		return manager.ServerStatuses()[0].State == ServerStateFailed
+	}, 2*time.Second, 5*time.Millisecond)
+
+	echoTool := manager.GetTools()[0].(tool.InvokableTool)
+	_, err = echoTool.InvokableRun(context.Background(), `{"text":"hello"}`)
+	assert.EqualError(t, err, "MCP server remote is unavailable")
+
+	available.Store(true)
+	assert.Eventually(t, func() bool {
+		status := manager.ServerStatuses()[0]
+		return status.State == ServerStateReady && status.Reconnects == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	output, err := echoTool.InvokableRun(context.Background(), `{"text":"hello"}`)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "hello")
+}
+
+func TestExpandHeadersPositive(t *testing.T) {
+	t.Setenv("TEST_MCP_TOKEN", "secret")
+	assert.Equal(t, map[string]string{
+		"Authorization": "Bearer secret",
+		"X-Trace":       "a:b",
+	}, expandHeaders([]string{"Authorization: Bearer $TEST_MCP_TOKEN", "X-Trace: a:b", "invalid"}))
+}
+
+func TestReloadPositive(t *testing.T) {
+	firstServer := httptest.NewServer(server.NewStreamableHTTPServer(newEchoMCPServer()))
+	t.Cleanup(firstServer.Close)
+	secondServer := httptest.NewServer(server.NewStreamableHTTPServer(newEchoMCPServer()))
+	t.Cleanup(secondServer.Close)
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{
+			"first":  {Transport: mcpConfig.TransportStreamableHTTP, URL: firstServer.URL + "/mcp"},
+			"second": {Transport: mcpConfig.TransportStreamableHTTP, URL: secondServer.URL + "/mcp"},
+		},
+	})
+	assert.NoError(t, err)
+	loadedTools := manager.GetTools()
+	assert.Len(t, loadedTools, 2)
+	firstTool := loadedTools[0]
+
+	manager.Reload(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{
+			"first": {Transport: mcpConfig.TransportStreamableHTTP, URL: firstServer.URL + "/mcp"},
+			"third": {Transport: mcpConfig.TransportStreamableHTTP, URL: secondServer.URL + "/mcp", ExcludedTools: []string{"other"}},
+		},
+	})
+
+	var names []string
+	for _, reloadedTool := range manager.GetTools() {
+		info, _ := reloadedTool.Info(context.Background())
+		names = append(names, info.Name)
+	}
+	assert.Equal(t, []string{"first__echo", "third__echo"}, names)
+	assert.Same(t, firstTool, manager.GetTools()[0], "unchanged servers keep their connection and tools")
+	assert.Len(t, loadedTools, 2, "a previously returned tool list is not modified")
+
+	statuses := manager.ServerStatuses()
+	if assert.Len(t, statuses, 2) {
+		assert.Equal(t, "first", statuses[0].Name)
+		assert.Equal(t, "third", statuses[1].Name)
+		assert.Equal(t, ServerStateReady, statuses[1].State)
+	}
+}
+
+func TestToolsListChangedPositive(t *testing.T) {
+	mcpServer := server.NewMCPServer("echo", "1.0.0", server.WithToolCapabilities(true))
+	mcpServer.AddTool(mcp.NewTool("echo"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("echo"), nil
+	})
+	httpServer := httptest.NewUnstartedServer(nil)
+	httpServer.Start()
+	t.Cleanup(httpServer.Close)
+	httpServer.Config.Handler = server.NewSSEServer(mcpServer, server.WithBaseURL(httpServer.URL))
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{"remote": {URL: httpServer.URL + "/sse"}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, manager.GetTools(), 1)
+
+	mcpServer.AddTool(mcp.NewTool("reverse"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("esrever"), nil
+	})
+
+	assert.Eventually(t, func() bool {
+		return len(manager.GetTools()) == 2
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, manager.ServerStatuses()[0].Tools)
+}
@@ -0,0 +1,527 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOpenAPITimeout = 30 * time.Second
+	maxOpenAPIResponse    = 10 << 20
+	bodyArgument          = "body"
+)
+
+var invalidToolNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// openAPIService holds the tools generated from the OpenAPI document of a REST service
+type openAPIService struct {
+	name    string
+	config  mcpConfig.OpenAPIServiceConfig
+	baseURL string
+	headers map[string]string
+	client  *http.Client
+	tools   []tool.BaseTool
+
+	slots    chan struct{} // service wide limit of concurrent calls, nil when unlimited
+	mutex    sync.Mutex
+	limiters map[string]*toolLimiter
+}
+
+// openAPITool calls one operation of a REST service
+type openAPITool struct {
+	info        *schema.ToolInfo
+	inputSchema *openapi3.Schema
+	service     *openAPIService
+	manager     *MCPToolManager
+	operationID string
+	method      string
+	path        string
+	parameters  []*openapi3.Parameter // path, query and header parameters
+}
+
+// loadOpenAPIServices loads the configured REST services, unchanged services keep their tools and
+// a service whose document cannot be loaded is skipped until the configuration changes
+func (m *MCPToolManager) loadOpenAPIServices(ctx context.Context, config *mcpConfig.Config) {
+	m.mutex.RLock()
+	current := m.services
+	m.mutex.RUnlock()
+
+	services := make(map[string]*openAPIService, len(config.OpenAPIServices))
+	for serviceName, serviceConfig := range config.OpenAPIServices {
+		if service, found := current[serviceName]; found && reflect.DeepEqual(service.config, serviceConfig) {
+			services[serviceName] = service
+			continue
+		}
+
+		service, err := m.loadOpenAPIService(ctx, serviceName, serviceConfig)
+		if err != nil {
+			log.Warn().Err(err).Str("service", serviceName).Msg("OpenAPI service could not be loaded")
+			continue
+		}
+		log.Info().Str("service", serviceName).Int("tools", len(service.tools)).Msg("OpenAPI service loaded")
+		services[serviceName] = service
+	}
+
+	m.mutex.Lock()
+	m.services = services
+	m.mutex.Unlock()
+
+	m.rebuildTools()
+}
+
+// loadOpenAPIService reads the document of a service and turns its operations into tools
+func (m *MCPToolManager) loadOpenAPIService(ctx context.Context, serviceName string, serviceConfig mcpConfig.OpenAPIServiceConfig) (*openAPIService, error) {
+	service := &openAPIService{
+		name:     serviceName,
+		config:   serviceConfig,
+		headers:  expandHeaders(serviceConfig.Headers),
+		client:   &http.Client{},
+		limiters: make(map[string]*toolLimiter),
+	}
+	if serviceConfig.MaxConcurrent > 0 {
+		service.slots = make(chan struct{}, serviceConfig.MaxConcurrent)
+	}
+
+	// Calls are bounded by the limiter of their operation, loading the document by the service timeout
+	timeout := serviceConfig.Timeout
+	if timeout <= 0 {
+		timeout = defaultOpenAPITimeout
+	}
+	loadCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	document, specURL, err := service.loadDocument(loadCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	service.baseURL, err = baseURL(serviceConfig.BaseURL, document, specURL)
+	if err != nil {
+		return nil, err
+	}
+
+	pathItems := document.Paths.Map()
+	paths := make([]string, 0, len(pathItems))
+	for path := range pathItems {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	operationIDs := make(map[string]string) // operation ids by tool name
+	for _, path := range paths {
+		pathItem := pathItems[path]
+		methods := make([]string, 0, len(pathItem.Operations()))
+		for method := range pathItem.Operations() {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			operation := pathItem.GetOperation(method)
+			operationID := operation.OperationID
+			if operationID == "" {
+				operationID = strings.ToLower(method) + "_" + path
+			}
+			if len(serviceConfig.AllowedOperations) > 0 && !slices.Contains(serviceConfig.AllowedOperations, operationID) ||
+				slices.Contains(serviceConfig.ExcludedOperations, operationID) {
+				continue
+			}
+
+			// Operation ids differing only in characters invalid in tool names would get the same tool
+			operationTool := m.operationTool(service, method, path, operationID, pathItem, operation)
+			if existing, found := operationIDs[operationTool.info.Name]; found {
+				log.Warn().Str("service", serviceName).Str("operation", operationID).Str("conflictsWith", existing).
+					Msg("OpenAPI operation skipped as its tool name is already used")
+				continue
+			}
+			operationIDs[operationTool.info.Name] = operationID
+			service.tools = append(service.tools, operationTool)
+		}
+	}
+
+	return service, nil
+}
+
+// loadDocument reads and validates the OpenAPI document from a file or URL, the configured headers are sent
+// when it is fetched over HTTP. It also returns the URL of a fetched document to resolve relative server URLs
+func (s *openAPIService) loadDocument(ctx context.Context) (*openapi3.T, *url.URL, error) {
+	var specURL *url.URL
+	if strings.HasPrefix(s.config.Spec, "http://") || strings.HasPrefix(s.config.Spec, "https://") {
+		var err error
+		specURL, err = url.Parse(s.config.Spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid spec URL: %v", err)
+		}
+	}
+
+	loader := openapi3.NewLoader()
+	loader.Context = ctx
+	loader.IsExternalRefsAllowed = true
+	loader.ReadFromURIFunc = func(loader *openapi3.Loader, location *url.URL) ([]byte, error) {
+		if location.Scheme != "http" && location.Scheme != "https" {
+			return os.ReadFile(location.Path)
+		}
+		// The headers hold the credentials of the service, documents referenced on other hosts do not get them
+		sameOrigin := specURL != nil && location.Scheme == specURL.Scheme && location.Host == specURL.Host
+		return s.fetch(ctx, location.String(), sameOrigin)
+	}
+
+	var document *openapi3.T
+	var err error
+	if specURL != nil {
+		document, err = loader.LoadFromURI(specURL)
+	} else {
+		document, err = loader.LoadFromFile(s.config.Spec)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load OpenAPI document %s: %v", s.config.Spec, err)
+	}
+	if err := document.Validate(ctx); err != nil {
+		return nil, nil, fmt.Errorf("invalid OpenAPI document %s: %v", s.config.Spec, err)
+	}
+	return document, specURL, nil
+}
+
+// toolLimiter returns the limiter of an operation, it is kept while the service is configured
+func (s *openAPIService) toolLimiter(operationID string) *toolLimiter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	limiter, found := s.limiters[operationID]
+	if !found {
+		// The service wide concurrency limit is enforced with the service's slots
+		limits := s.config.ToolLimits
+		limits.MaxConcurrent = 0
+		limits = limits.Merge(toolOverride(s.config.Operations, operationID).ToolLimits)
+		if limits.Timeout == 0 {
+			limits.Timeout = defaultOpenAPITimeout
+		}
+		limiter = newToolLimiter(limits)
+		s.limiters[operationID] = limiter
+	}
+	return limiter
+}
+
+// cacheSettings returns the result caching of an operation
+func (s *openAPIService) cacheSettings(operationID string) mcpConfig.ToolCache {
+	settings := s.config.ToolCache.Merge(toolOverride(s.config.Operations, operationID).ToolCache)
+	if settings.CacheTTL == 0 {
+		settings.CacheTTL = defaultCacheTTL
+	}
+	return settings
+}
+
+// fetch reads a document over HTTP, with the configured headers when they may be sent to its location
+func (s *openAPIService) fetch(ctx context.Context, location string, withHeaders bool) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	if withHeaders {
+		for name, value := range s.headers {
+			request.Header.Set(name, value)
+		}
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", location, response.Status)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, maxOpenAPIResponse))
+}
+
+// baseURL returns the configured base URL or the first server of the document with its variable defaults,
+// a relative server URL is resolved against the URL the document was fetched from
+func baseURL(configured string, document *openapi3.T, specURL *url.URL) (string, error) {
+	if configured != "" {
+		return strings.TrimSuffix(configured, "/"), nil
+	}
+	if len(document.Servers) == 0 {
+		return "", fmt.Errorf("baseUrl is required as the document has no servers")
+	}
+
+	server := document.Servers[0]
+	serverURL := server.URL
+	for name, variable := range server.Variables {
+		serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", variable.Default)
+	}
+
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %s: %v", serverURL, err)
+	}
+	if !parsed.IsAbs() {
+		if specURL == nil {
+			return "", fmt.Errorf("baseUrl is required as the server URL %s is relative", serverURL)
+		}
+		parsed = specURL.ResolveReference(parsed)
+	}
+	return strings.TrimSuffix(parsed.String(), "/"), nil
+}
+
+// operationTool builds the tool of an operation, its parameters become properties of the input schema and a
+// JSON request body becomes the "body" property
+func (m *MCPToolManager) operationTool(service *openAPIService, method string, path string, operationID string,
+	pathItem *openapi3.PathItem, operation *openapi3.Operation) *openAPITool {
+
+	inputSchema := openapi3.NewObjectSchema()
+	var parameters []*openapi3.Parameter
+	for _, parameterRef := range slices.Concat(pathItem.Parameters, operation.Parameters) {
+		parameter := parameterRef.Value
+		if parameter == nil || parameter.In == openapi3.ParameterInCookie {
+			continue
+		}
+		// Operation parameters override path item parameters of the same name
+		parameters = slices.DeleteFunc(parameters, func(existing *openapi3.Parameter) bool {
+			return existing.Name == parameter.Name && existing.In == parameter.In
+		})
+		parameters = append(parameters, parameter)
+	}
+
+	for _, parameter := range parameters {
+		propertySchema := openapi3.NewStringSchema()
+		if parameter.Schema != nil && parameter.Schema.Value != nil {
+			propertySchema = inlineSchema(parameter.Schema, nil).Value
+		}
+		if propertySchema.Description == "" {
+			propertySchema.Description = parameter.Description
+		}
+		inputSchema.WithPropertyRef(parameter.Name, &openapi3.SchemaRef{Value: propertySchema})
+		if parameter.Required {
+			inputSchema.Required = append(inputSchema.Required, parameter.Name)
+		}
+	}
+
+	if operation.RequestBody != nil && operation.RequestBody.Value != nil {
+		requestBody := operation.RequestBody.Value
+		if mediaType := requestBody.Content.Get("application/json"); mediaType != nil && mediaType.Schema != nil {
+			inputSchema.WithPropertyRef(bodyArgument, inlineSchema(mediaType.Schema, nil))
+			if requestBody.Required {
+				inputSchema.Required = append(inputSchema.Required, bodyArgument)
+			}
+		}
+	}
+
+	description := strings.TrimSpace(operation.Summary + "\n\n" + operation.Description)
+	if description == "" {
+		description = method + " " + path
+	}
+
+	return &openAPITool{
+		info: &schema.ToolInfo{
+			Name:        service.name + "__" + invalidToolNameCharacters.ReplaceAllString(operationID, "_"),
+			Desc:        description,
+			ParamsOneOf: schema.NewParamsOneOfByOpenAPIV3(inputSchema),
+		},
+		inputSchema: inputSchema,
+		service:     service,
+		manager:     m,
+		operationID: operationID,
+		method:      method,
+		path:        path,
+		parameters:  parameters,
+	}
+}
+
+// inlineSchema returns a deep copy of a schema with the schemas its references point to in their place, the model
+// and the validation get the tool schema without the components of the document to resolve them against.
+// A recursive reference becomes an empty schema, which accepts anything
+func inlineSchema(schemaRef *openapi3.SchemaRef, resolving []*openapi3.Schema) *openapi3.SchemaRef {
+	if schemaRef == nil {
+		return nil
+	}
+	if schemaRef.Value == nil || slices.Contains(resolving, schemaRef.Value) {
+		return &openapi3.SchemaRef{Value: &openapi3.Schema{}}
+	}
+	resolving = append(resolving, schemaRef.Value)
+
+	inlineAll := func(schemaRefs openapi3.SchemaRefs) openapi3.SchemaRefs {
+		if schemaRefs == nil {
+			return nil
+		}
+		inlined := make(openapi3.SchemaRefs, len(schemaRefs))
+		for index, nested := range schemaRefs {
+			inlined[index] = inlineSchema(nested, resolving)
+		}
+		return inlined
+	}
+
+	copied := *schemaRef.Value
+	copied.OneOf = inlineAll(copied.OneOf)
+	copied.AnyOf = inlineAll(copied.AnyOf)
+	copied.AllOf = inlineAll(copied.AllOf)
+	copied.Not = inlineSchema(copied.Not, resolving)
+	copied.Items = inlineSchema(copied.Items, resolving)
+	copied.AdditionalProperties.Schema = inlineSchema(copied.AdditionalProperties.Schema, resolving)
+	if copied.Properties != nil {
+		copied.Properties = make(openapi3.Schemas, len(schemaRef.Value.Properties))
+		for name, property := range schemaRef.Value.Properties {
+			copied.Properties[name] = inlineSchema(property, resolving)
+		}
+	}
+	return &openapi3.SchemaRef{Value: &copied}
+}
+
+// Info returns the tool information
+func (t *openAPITool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return t.info, nil
+}
+
+// InvokableRun calls the operation and returns the response body
+func (t *openAPITool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	result, err := t.RunWithResult(ctx, argumentsInJSON)
+	if err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// RunWithResult calls the operation, error statuses are returned as error results so the model sees the details
+func (t *openAPITool) RunWithResult(ctx context.Context, argumentsInJSON string) (*ToolResult, error) {
+	validated, err := validateArguments(t.inputSchema, argumentsInJSON, true)
+	if err != nil {
+		return &ToolResult{Text: err.Error(), IsError: true}, nil
+	}
+	var arguments map[string]any
+	if err := json.Unmarshal([]byte(validated), &arguments); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	guard := toolGuard{
+		server:   t.service.name,
+		toolName: t.operationID,
+		cache:    t.service.cacheSettings(t.operationID),
+		limiter:  t.service.toolLimiter(t.operationID),
+		slots:    t.service.slots,
+	}
+	return t.manager.guardedCall(ctx, t.info.Name, guard, validated, func(callCtx context.Context) (*ToolResult, error) {
+		return t.call(callCtx, arguments)
+	})
+}
+
+// call sends the request of the operation and converts the response
+func (t *openAPITool) call(ctx context.Context, arguments map[string]any) (*ToolResult, error) {
+	request, err := t.newRequest(ctx, arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := t.service.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s %s: %w", t.method, t.path, err)
+	}
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxOpenAPIResponse))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response of %s %s: %w", t.method, t.path, err)
+	}
+
+	text := string(content)
+	if contentType := response.Header.Get("Content-Type"); !isTextual(contentType) {
+		text = fmt.Sprintf("[%s response of %d bytes]", contentType, len(content))
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return &ToolResult{Text: truncate(response.Status+": "+text, t.manager.ResultLimit()), IsError: true}, nil
+	}
+	return &ToolResult{Text: truncate(text, t.manager.ResultLimit())}, nil
+}
+
+// newRequest builds the HTTP request from the arguments
+func (t *openAPITool) newRequest(ctx context.Context, arguments map[string]any) (*http.Request, error) {
+	path := t.path
+	query := url.Values{}
+	headers := make(map[string]string)
+	for _, parameter := range t.parameters {
+		value, found := arguments[parameter.Name]
+		if !found {
+			continue
+		}
+		switch parameter.In {
+		case openapi3.ParameterInPath:
+			path = strings.ReplaceAll(path, "{"+parameter.Name+"}", url.PathEscape(formatArgument(value)))
+		case openapi3.ParameterInQuery:
+			if values, isArray := value.([]any); isArray {
+				for _, item := range values {
+					query.Add(parameter.Name, formatArgument(item))
+				}
+			} else {
+				query.Set(parameter.Name, formatArgument(value))
+			}
+		case openapi3.ParameterInHeader:
+			headers[parameter.Name] = formatArgument(value)
+		}
+	}
+
+	location := t.service.baseURL + path
+	if len(query) > 0 {
+		location += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if value, found := arguments[bodyArgument]; found {
+		content, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal the request body: %w", err)
+		}
+		body = bytes.NewReader(content)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, t.method, location, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json, text/*;q=0.9, */*;q=0.5")
+	// The configured headers are set last, so header parameters cannot replace credentials
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	for name, value := range t.service.headers {
+		request.Header.Set(name, value)
+	}
+	return request, nil
+}
+
+// formatArgument writes a parameter value the way it appears in a URL or header
+func formatArgument(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	content, _ := json.Marshal(value)
+	return string(content)
+}
+
+func isTextual(contentType string) bool {
+	return contentType == "" || strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") || strings.Contains(contentType, "xml")
+}
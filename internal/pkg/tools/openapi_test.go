@@ -0,0 +1,408 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const inventoryDocument = `
+openapi: 3.0.3
+info:
+  title: Inventory
+  version: 1.0.0
+servers:
+  - url: /v1
+paths:
+  /items/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: integer
+    get:
+      operationId: getItem
+      summary: Get an item
+      parameters:
+        - name: verbose
+          in: query
+          schema:
+            type: boolean
+        - name: X-Trace
+          in: header
+          schema:
+            type: string
+        - name: Authorization
+          in: header
+          schema:
+            type: string
+      responses:
+        '200':
+          description: The item
+  /items:
+    post:
+      operationId: createItem
+      summary: Create an item
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name:
+                  type: string
+      responses:
+        '201':
+          description: Created
+  /stock:
+    get:
+      operationId: list.stock
+      responses:
+        '200':
+          description: The stock
+    post:
+      operationId: list stock
+      responses:
+        '200':
+          description: The stock
+  /suppliers:
+    post:
+      operationId: createSupplier
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Supplier'
+      responses:
+        '201':
+          description: Created
+components:
+  schemas:
+    Supplier:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+        address:
+          $ref: '#/components/schemas/Address'
+    Address:
+      type: object
+      required: [city]
+      properties:
+        city:
+          type: string
+`
+
+// inventoryServer serves the inventory document and records the API requests it receives
+type inventoryServer struct {
+	mutex    sync.Mutex
+	requests []string
+	bodies   []string
+	headers  []http.Header
+}
+
+func (s *inventoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/openapi.yaml" {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(inventoryDocument))
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	s.mutex.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	s.bodies = append(s.bodies, string(body))
+	s.headers = append(s.headers, r.Header.Clone())
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/v1/items/404":
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"no such item"}`))
+	case r.Method == http.MethodPost:
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	default:
+		_, _ = w.Write([]byte(`{"id":7,"name":"hammer"}`))
+	}
+}
+
+// loadInventory attaches the inventory service and returns its tools by name
+func loadInventory(t *testing.T, serviceConfig mcpConfig.OpenAPIServiceConfig) (*inventoryServer, map[string]ResultTool) {
+	t.Helper()
+
+	inventory := &inventoryServer{}
+	httpServer := httptest.NewServer(inventory)
+	t.Cleanup(httpServer.Close)
+	t.Setenv("TEST_INVENTORY_TOKEN", "secret")
+
+	serviceConfig.Spec = httpServer.URL + "/openapi.yaml"
+	serviceConfig.Headers = []string{"Authorization: Bearer ${TEST_INVENTORY_TOKEN}"}
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		OpenAPIServices: map[string]mcpConfig.OpenAPIServiceConfig{"inventory": serviceConfig},
+	})
+	assert.NoError(t, err)
+
+	tools := make(map[string]ResultTool)
+	for _, baseTool := range manager.GetTools() {
+		info, err := baseTool.Info(context.Background())
+		assert.NoError(t, err)
+		tools[info.Name] = baseTool.(ResultTool)
+	}
+	return inventory, tools
+}
+
+func TestOpenAPIToolsPositive(t *testing.T) {
+	inventory, tools := loadInventory(t, mcpConfig.OpenAPIServiceConfig{})
+	assert.Len(t, tools, 4)
+
+	result, err := tools["inventory__getItem"].RunWithResult(context.Background(), `{"id":"7","verbose":true,"X-Trace":"abc"}`)
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.JSONEq(t, `{"id":7,"name":"hammer"}`, result.Text)
+
+	result, err = tools["inventory__createItem"].RunWithResult(context.Background(), `{"body":{"name":"saw"}}`)
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+
+	assert.Equal(t, []string{"GET /v1/items/7?verbose=true", "POST /v1/items"}, inventory.requests)
+	assert.Equal(t, "abc", inventory.headers[0].Get("X-Trace"))
+	assert.Equal(t, "Bearer secret", inventory.headers[0].Get("Authorization"))
+	var body map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(inventory.bodies[1]), &body))
+	assert.Equal(t, map[string]any{"name": "saw"}, body)
+}
+
+func TestOpenAPIToolsPositiveComponentSchemas(t *testing.T) {
+	inventory, tools := loadInventory(t, mcpConfig.OpenAPIServiceConfig{})
+
+	// The model gets the body schema with the referenced components in place
+	info, err := tools["inventory__createSupplier"].Info(context.Background())
+	assert.NoError(t, err)
+	paramsSchema, err := info.ParamsOneOf.ToOpenAPIV3()
+	assert.NoError(t, err)
+	marshaled, err := json.Marshal(paramsSchema)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(marshaled), "$ref")
+	assert.Contains(t, string(marshaled), `"city"`)
+
+	result, err := tools["inventory__createSupplier"].RunWithResult(context.Background(), `{"body":{"name":"acme","address":{}}}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text, `property "city" is missing`)
+
+	result, err = tools["inventory__createSupplier"].RunWithResult(context.Background(),
+		`{"body":{"name":"acme","address":{"city":"Oslo"}}}`)
+	assert.NoError(t, err)
+	assert.False(t, result.IsError, result.Text)
+	assert.Equal(t, []string{"POST /v1/suppliers"}, inventory.requests)
+}
+
+func TestOpenAPIToolsNegativeForeignRefHeaders(t *testing.T) {
+	const sharedDocument = `
+openapi: 3.0.3
+info:
+  title: Shared
+  version: 1.0.0
+paths: {}
+components:
+  schemas:
+    Note:
+      type: object
+      properties:
+        text:
+          type: string
+`
+	var mutex sync.Mutex
+	authorizations := make(map[string]string)
+	record := func(host string, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		authorizations[host+r.URL.Path] = r.Header.Get("Authorization")
+	}
+
+	foreignServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("foreign", r)
+		_, _ = w.Write([]byte(sharedDocument))
+	}))
+	t.Cleanup(foreignServer.Close)
+
+	specServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("spec", r)
+		if r.URL.Path == "/shared.yaml" {
+			_, _ = w.Write([]byte(sharedDocument))
+			return
+		}
+		_, _ = w.Write([]byte(`
+openapi: 3.0.3
+info:
+  title: Notes
+  version: 1.0.0
+servers:
+  - url: /v1
+paths:
+  /notes:
+    post:
+      operationId: addNote
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '` + foreignServer.URL + `/shared.yaml#/components/schemas/Note'
+      responses:
+        '201':
+          description: Created
+  /drafts:
+    post:
+      operationId: addDraft
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: 'shared.yaml#/components/schemas/Note'
+      responses:
+        '201':
+          description: Created
+`))
+	}))
+	t.Cleanup(specServer.Close)
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		OpenAPIServices: map[string]mcpConfig.OpenAPIServiceConfig{"notes": {
+			Spec:    specServer.URL + "/openapi.yaml",
+			Headers: []string{"Authorization: Bearer secret"},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, manager.GetTools(), 2)
+
+	// Only the host of the spec gets the credentials
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, map[string]string{
+		"spec/openapi.yaml":   "Bearer secret",
+		"spec/shared.yaml":    "Bearer secret",
+		"foreign/shared.yaml": "",
+	}, authorizations)
+}
+
+func TestOpenAPIToolsPositiveAllowedOperations(t *testing.T) {
+	_, tools := loadInventory(t, mcpConfig.OpenAPIServiceConfig{AllowedOperations: []string{"createItem"}})
+	assert.Len(t, tools, 1)
+	assert.Contains(t, tools, "inventory__createItem")
+}
+
+func TestOpenAPIToolsPositiveCache(t *testing.T) {
+	idempotent := true
+	inventory, tools := loadInventory(t, mcpConfig.OpenAPIServiceConfig{
+		Operations: map[string]mcpConfig.ToolSettings{"getitem": {ToolCache: mcpConfig.ToolCache{Idempotent: &idempotent}}},
+	})
+
+	for range 2 {
+		result, err := tools["inventory__getItem"].RunWithResult(WithSession(context.Background(), "session-1"), `{"id":7}`)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"id":7,"name":"hammer"}`, result.Text)
+	}
+	assert.Equal(t, []string{"GET /v1/items/7"}, inventory.requests)
+}
+
+func TestOpenAPIToolsNegativeHeaderOverride(t *testing.T) {
+	inventory, tools := loadInventory(t, mcpConfig.OpenAPIServiceConfig{})
+
+	result, err := tools["inventory__getItem"].RunWithResult(context.Background(), `{"id":7,"Authorization":"Bearer stolen"}`)
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Equal(t, "Bearer secret", inventory.headers[0].Get("Authorization"))
+}
+
+func TestOpenAPIToolsNegativeNameCollision(t *testing.T) {
+	_, tools := loadInventory(t, mcpConfig.OpenAPIServiceConfig{})
+
+	// Both operation ids become list_stock, only the first one is kept
+	assert.Contains(t, tools, "inventory__list_stock")
+	assert.Equal(t, "list.stock", tools["inventory__list_stock"].(*openAPITool).operationID)
+}
+
+func TestOpenAPIToolsNegativeCircuitOpen(t *testing.T) {
+	inventory := &inventoryServer{}
+	httpServer := httptest.NewServer(inventory)
+	t.Setenv("TEST_INVENTORY_TOKEN", "secret")
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		OpenAPIServices: map[string]mcpConfig.OpenAPIServiceConfig{"inventory": {
+			Spec:       httpServer.URL + "/openapi.yaml",
+			Headers:    []string{"Authorization: Bearer ${TEST_INVENTORY_TOKEN}"},
+			ToolLimits: mcpConfig.ToolLimits{FailureThreshold: 1, OpenDuration: time.Minute},
+		}},
+	})
+	assert.NoError(t, err)
+	httpServer.Close()
+
+	var getItem ResultTool
+	for _, baseTool := range manager.GetTools() {
+		if info, _ := baseTool.Info(context.Background()); info.Name == "inventory__getItem" {
+			getItem = baseTool.(ResultTool)
+		}
+	}
+
+	// The unreachable service fails once, then the call is rejected without a request
+	_, err = getItem.RunWithResult(context.Background(), `{"id":7}`)
+	assert.Error(t, err)
+	result, err := getItem.RunWithResult(context.Background(), `{"id":7}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text, "tool is unavailable after 1 consecutive failures")
+}
+
+func TestOpenAPIToolsNegativeErrorStatus(t *testing.T) {
+	_, tools := loadInventory(t, mcpConfig.OpenAPIServiceConfig{})
+
+	result, err := tools["inventory__getItem"].RunWithResult(context.Background(), `{"id":404}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Equal(t, `404 Not Found: {"error":"no such item"}`, result.Text)
+}
+
+func TestOpenAPIToolsNegativeInvalidArguments(t *testing.T) {
+	inventory, tools := loadInventory(t, mcpConfig.OpenAPIServiceConfig{})
+
+	result, err := tools["inventory__createItem"].RunWithResult(context.Background(), `{"body":{}}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text, `property "name" is missing`)
+	assert.Empty(t, inventory.requests)
+}
+
+func TestOpenAPIToolsNegativeUnavailableDocument(t *testing.T) {
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		OpenAPIServices: map[string]mcpConfig.OpenAPIServiceConfig{"missing": {Spec: "/does/not/exist.yaml"}},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, manager.GetTools())
+}
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"strings"
+	"sync"
+)
+
+// Registry holds tools implemented in Go, they are offered to the model next to the MCP tools
+type Registry struct {
+	mutex sync.RWMutex
+	tools []tool.BaseTool
+	names map[string]struct{}
+}
+
+// NewRegistry creates an empty tool registry
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]struct{}),
+	}
+}
+
+// Register adds a tool, names must be unique and must not contain "__" which marks MCP server prefixes
+func (r *Registry) Register(invokableTool tool.InvokableTool) error {
+	info, err := invokableTool.Info(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get tool info: %w", err)
+	}
+	if info.Name == "" || strings.Contains(info.Name, "__") {
+		return fmt.Errorf("invalid tool name %q", info.Name)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, found := r.names[info.Name]; found {
+		return fmt.Errorf("tool %s is already registered", info.Name)
+	}
+	r.names[info.Name] = struct{}{}
+	r.tools = append(r.tools, invokableTool)
+	return nil
+}
+
+// RegisterFunc adds a tool calling fn, the parameter schema is derived from the input struct using its json
+// and jsonschema tags (description=..., enum=..., required) and the output is returned as JSON
+func RegisterFunc[T, D any](r *Registry, name string, description string, fn func(ctx context.Context, input T) (D, error)) error {
+	invokableTool, err := utils.InferTool(name, description, fn)
+	if err != nil {
+		return fmt.Errorf("failed to infer tool %s: %w", name, err)
+	}
+	return r.Register(invokableTool)
+}
+
+// Tools returns the registered tools in registration order
+func (r *Registry) Tools() []tool.BaseTool {
+	if r == nil {
+		return nil
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return append([]tool.BaseTool(nil), r.tools...)
+}
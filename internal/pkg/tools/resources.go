@@ -0,0 +1,313 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/policy"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Names of the built-in resource tools, they contain no "__" so they cannot clash with server tools
+const (
+	listResourcesToolName = "list_mcp_resources"
+	readResourceToolName  = "read_mcp_resource"
+)
+
+// Names the tool policy checks for the resources and the prompt templates of a server, as <server>__resources
+// and <server>__prompts
+const (
+	resourcesPolicyName = "resources"
+	promptsPolicyName   = "prompts"
+)
+
+// ErrNotAllowed is returned for the resources and prompts of servers the tool policy denies to the principal
+var ErrNotAllowed = errors.New("not allowed by the tool policy")
+
+// ErrMultiRolePrompt is returned for prompt templates with messages of other roles than the user,
+// they cannot be sent as one user message without losing who said what
+var ErrMultiRolePrompt = errors.New("the prompt has assistant messages, only prompts made of user messages can be used")
+
+// ResourceInfo describes a resource offered by an MCP server
+type ResourceInfo struct {
+	Server      string `json:"server"`
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// PromptArgument describes an argument of a server prompt template
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptInfo describes a prompt template offered by an MCP server
+type PromptInfo struct {
+	Server      string           `json:"server"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// SetPolicy shares the tool policy with the manager, the resources and prompts of a server are only
+// offered to the principal of the context when the policy allows its <server>__resources or <server>__prompts
+func (m *MCPToolManager) SetPolicy(toolPolicy *atomic.Pointer[policy.Policy]) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.toolPolicy = toolPolicy
+}
+
+// allowed checks the resources or prompts of a server against the policy for the principal of the context
+func (m *MCPToolManager) allowed(ctx context.Context, serverName string, policyName string) bool {
+	m.mutex.RLock()
+	toolPolicy := m.toolPolicy
+	m.mutex.RUnlock()
+
+	if toolPolicy == nil {
+		return true
+	}
+	return toolPolicy.Load().Allowed(policy.PrincipalFromContext(ctx), serverName+"__"+policyName)
+}
+
+// readyServers returns the connected servers ordered by name
+func (m *MCPToolManager) readyServers() []*mcpServer {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	servers := make([]*mcpServer, 0, len(m.servers))
+	for _, server := range m.servers {
+		if server.Client() != nil {
+			servers = append(servers, server)
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].name < servers[j].name
+	})
+	return servers
+}
+
+// serverClient returns the client of a connected server
+func (m *MCPToolManager) serverClient(serverName string) (*mcpServer, error) {
+	m.mutex.RLock()
+	server, exists := m.servers[serverName]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown MCP server %s", serverName)
+	}
+	if server.Client() == nil {
+		return nil, fmt.Errorf("MCP server %s is unavailable", serverName)
+	}
+	return server, nil
+}
+
+// ListResources lists the resources of all connected servers that offer them and the policy allows,
+// a failing server is skipped
+func (m *MCPToolManager) ListResources(ctx context.Context) []ResourceInfo {
+	resources := make([]ResourceInfo, 0)
+	for _, server := range m.readyServers() {
+		if server.Capabilities().Resources == nil || !m.allowed(ctx, server.name, resourcesPolicyName) {
+			continue
+		}
+
+		var request mcp.ListResourcesRequest
+		for {
+			result, err := server.Client().ListResources(ctx, request)
+			if err != nil {
+				log.Warn().Err(err).Str("server", server.name).Msg("MCP server resource listing failed")
+				break
+			}
+			for _, resource := range result.Resources {
+				resources = append(resources, ResourceInfo{
+					Server:      server.name,
+					URI:         resource.URI,
+					Name:        resource.Name,
+					Description: resource.Description,
+					MimeType:    resource.MIMEType,
+				})
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			request.Params.Cursor = result.NextCursor
+		}
+	}
+	return resources
+}
+
+// ReadResource reads a resource as text, binary contents are described rather than included
+func (m *MCPToolManager) ReadResource(ctx context.Context, serverName string, uri string) (string, error) {
+	if !m.allowed(ctx, serverName, resourcesPolicyName) {
+		return "", fmt.Errorf("resources of MCP server %s: %w", serverName, ErrNotAllowed)
+	}
+	server, err := m.serverClient(serverName)
+	if err != nil {
+		return "", err
+	}
+
+	request := mcp.ReadResourceRequest{}
+	request.Params.URI = uri
+	result, err := server.Client().ReadResource(ctx, request)
+	if err != nil {
+		return "", fmt.Errorf("failed to read resource %s: %w", uri, err)
+	}
+
+	parts := make([]string, 0, len(result.Contents))
+	for _, contents := range result.Contents {
+		switch contents := contents.(type) {
+		case mcp.TextResourceContents:
+			parts = append(parts, contents.Text)
+		case mcp.BlobResourceContents:
+			parts = append(parts, fmt.Sprintf("[binary %s resource %s, %d base64 characters]", contents.MIMEType, contents.URI, len(contents.Blob)))
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// ListPrompts lists the prompt templates of all connected servers that offer them and the policy allows,
+// a failing server is skipped
+func (m *MCPToolManager) ListPrompts(ctx context.Context) []PromptInfo {
+	prompts := make([]PromptInfo, 0)
+	for _, server := range m.readyServers() {
+		if server.Capabilities().Prompts == nil || !m.allowed(ctx, server.name, promptsPolicyName) {
+			continue
+		}
+
+		var request mcp.ListPromptsRequest
+		for {
+			result, err := server.Client().ListPrompts(ctx, request)
+			if err != nil {
+				log.Warn().Err(err).Str("server", server.name).Msg("MCP server prompt listing failed")
+				break
+			}
+			for _, prompt := range result.Prompts {
+				arguments := make([]PromptArgument, 0, len(prompt.Arguments))
+				for _, argument := range prompt.Arguments {
+					arguments = append(arguments, PromptArgument{
+						Name:        argument.Name,
+						Description: argument.Description,
+						Required:    argument.Required,
+					})
+				}
+				prompts = append(prompts, PromptInfo{
+					Server:      server.name,
+					Name:        prompt.Name,
+					Description: prompt.Description,
+					Arguments:   arguments,
+				})
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			request.Params.Cursor = result.NextCursor
+		}
+	}
+	return prompts
+}
+
+// GetPrompt expands a server prompt template into text, the text parts of its messages are joined.
+// Prompts with assistant messages are refused with ErrMultiRolePrompt.
+func (m *MCPToolManager) GetPrompt(ctx context.Context, serverName string, name string, arguments map[string]string) (string, error) {
+	if !m.allowed(ctx, serverName, promptsPolicyName) {
+		return "", fmt.Errorf("prompts of MCP server %s: %w", serverName, ErrNotAllowed)
+	}
+	server, err := m.serverClient(serverName)
+	if err != nil {
+		return "", err
+	}
+
+	request := mcp.GetPromptRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = arguments
+	result, err := server.Client().GetPrompt(ctx, request)
+	if err != nil {
+		return "", fmt.Errorf("failed to get prompt %s: %w", name, err)
+	}
+
+	parts := make([]string, 0, len(result.Messages))
+	for _, message := range result.Messages {
+		if message.Role != mcp.RoleUser {
+			return "", fmt.Errorf("prompt %s: %w", name, ErrMultiRolePrompt)
+		}
+		switch content := message.Content.(type) {
+		case mcp.TextContent:
+			parts = append(parts, content.Text)
+		case mcp.EmbeddedResource:
+			if textResource, ok := content.Resource.(mcp.TextResourceContents); ok {
+				parts = append(parts, textResource.Text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// resourceTools returns the built-in tools the model uses to discover and read server resources
+func (m *MCPToolManager) resourceTools() []tool.BaseTool {
+	return []tool.BaseTool{
+		&listResourcesTool{manager: m},
+		&readResourceTool{manager: m},
+	}
+}
+
+// listResourcesTool lets the model list the resources of all servers
+type listResourcesTool struct {
+	manager *MCPToolManager
+}
+
+// Info returns the tool information
+func (t *listResourcesTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name:        listResourcesToolName,
+		Desc:        "Lists the resources (files, documents, records) offered by the connected MCP servers with their server and URI.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{}),
+	}, nil
+}
+
+// InvokableRun returns the resource list as JSON
+func (t *listResourcesTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	result, err := json.Marshal(t.manager.ListResources(ctx))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal resources: %w", err)
+	}
+	return string(result), nil
+}
+
+// readResourceTool lets the model read a resource by server and URI
+type readResourceTool struct {
+	manager *MCPToolManager
+}
+
+// Info returns the tool information
+func (t *readResourceTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: readResourceToolName,
+		Desc: "Reads the contents of a resource listed by " + listResourcesToolName + ".",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"server": {Type: schema.String, Desc: "Name of the MCP server offering the resource", Required: true},
+			"uri":    {Type: schema.String, Desc: "URI of the resource", Required: true},
+		}),
+	}, nil
+}
+
+// InvokableRun reads the requested resource
+func (t *readResourceTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	var arguments struct {
+		Server string `json:"server"`
+		URI    string `json:"uri"`
+	}
+	if err := json.Unmarshal([]byte(argumentsInJSON), &arguments); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	return t.manager.ReadResource(ctx, arguments.Server, arguments.URI)
+}
@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"ai-chat/internal/pkg/policy"
+	"context"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newDocsMCPServer creates an in-process MCP server with one resource and one prompt template
+func newDocsMCPServer() *server.MCPServer {
+	mcpServer := server.NewMCPServer("docs", "1.0.0",
+		server.WithResourceCapabilities(false, false),
+		server.WithPromptCapabilities(false))
+
+	mcpServer.AddResource(mcp.NewResource("docs://readme", "readme",
+		mcp.WithResourceDescription("Project readme"), mcp.WithMIMEType("text/markdown")),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return []mcp.ResourceContents{mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "text/markdown",
+				Text:     "# Ricky",
+			}}, nil
+		})
+
+	mcpServer.AddPrompt(mcp.NewPrompt("review",
+		mcp.WithPromptDescription("Review a file"),
+		mcp.WithArgument("file", mcp.RequiredArgument())),
+		func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return mcp.NewGetPromptResult("Review", []mcp.PromptMessage{
+				mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent("Please review "+request.Params.Arguments["file"])),
+			}), nil
+		})
+
+	mcpServer.AddPrompt(mcp.NewPrompt("example",
+		mcp.WithPromptDescription("Review by example")),
+		func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return mcp.NewGetPromptResult("Example", []mcp.PromptMessage{
+				mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent("Review this")),
+				mcp.NewPromptMessage(mcp.RoleAssistant, mcp.NewTextContent("It looks fine")),
+			}), nil
+		})
+
+	return mcpServer
+}
+
+// loadDocsServer starts the docs server and loads it into a new manager
+func loadDocsServer(t *testing.T) *MCPToolManager {
+	t.Helper()
+
+	httpServer := httptest.NewServer(server.NewStreamableHTTPServer(newDocsMCPServer()))
+	t.Cleanup(httpServer.Close)
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{
+			"docs": {Transport: mcpConfig.TransportStreamableHTTP, URL: httpServer.URL + "/mcp"},
+		},
+	})
+	assert.NoError(t, err)
+	return manager
+}
+
+func TestListResourcesPositive(t *testing.T) {
+	manager := loadDocsServer(t)
+
+	resources := manager.ListResources(context.Background())
+	assert.Equal(t, []ResourceInfo{{
+		Server:      "docs",
+		URI:         "docs://readme",
+		Name:        "readme",
+		Description: "Project readme",
+		MimeType:    "text/markdown",
+	}}, resources)
+
+	content, err := manager.ReadResource(context.Background(), "docs", "docs://readme")
+	assert.NoError(t, err)
+	assert.Equal(t, "# Ricky", content)
+}
+
+func TestResourceToolsPositive(t *testing.T) {
+	manager := loadDocsServer(t)
+
+	var readTool tool.InvokableTool
+	for _, baseTool := range manager.GetTools() {
+		info, err := baseTool.Info(context.Background())
+		assert.NoError(t, err)
+		if info.Name == readResourceToolName {
+			readTool = baseTool.(tool.InvokableTool)
+		}
+	}
+	if !assert.NotNil(t, readTool) {
+		return
+	}
+
+	output, err := readTool.InvokableRun(context.Background(), `{"server":"docs","uri":"docs://readme"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "# Ricky", output)
+}
+
+func TestResourceToolsNegativeWithoutResources(t *testing.T) {
+	httpServer := httptest.NewServer(server.NewStreamableHTTPServer(newEchoMCPServer()))
+	t.Cleanup(httpServer.Close)
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{
+			"remote": {Transport: mcpConfig.TransportStreamableHTTP, URL: httpServer.URL + "/mcp"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, manager.GetTools(), 1)
+	assert.Empty(t, manager.ListResources(context.Background()))
+}
+
+func TestGetPromptPositive(t *testing.T) {
+	manager := loadDocsServer(t)
+
+	prompts := manager.ListPrompts(context.Background())
+	assert.Contains(t, prompts, PromptInfo{
+		Server:      "docs",
+		Name:        "review",
+		Description: "Review a file",
+		Arguments:   []PromptArgument{{Name: "file", Required: true}},
+	})
+
+	text, err := manager.GetPrompt(context.Background(), "docs", "review", map[string]string{"file": "main.go"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Please review main.go", text)
+}
+
+func TestGetPromptNegativeMultiRole(t *testing.T) {
+	manager := loadDocsServer(t)
+
+	_, err := manager.GetPrompt(context.Background(), "docs", "example", nil)
+	assert.ErrorIs(t, err, ErrMultiRolePrompt)
+}
+
+func TestReadResourceNegativeUnknownServer(t *testing.T) {
+	manager := loadDocsServer(t)
+
+	_, err := manager.ReadResource(context.Background(), "missing", "docs://readme")
+	assert.ErrorContains(t, err, "unknown MCP server missing")
+
+	_, err = manager.GetPrompt(context.Background(), "missing", "review", nil)
+	assert.ErrorContains(t, err, "unknown MCP server missing")
+}
+
+func TestReadResourceNegativePolicy(t *testing.T) {
+	manager := loadDocsServer(t)
+	toolPolicy := &atomic.Pointer[policy.Policy]{}
+	toolPolicy.Store(policy.New(&mcpConfig.ToolPolicyConfig{
+		RolesHeader: "X-Roles",
+		Roles: map[string]mcpConfig.ToolRuleConfig{
+			"default": {Allow: []string{"*"}, Deny: []string{"docs__*"}},
+			"writer":  {Allow: []string{"*"}},
+		},
+	}))
+	manager.SetPolicy(toolPolicy)
+
+	// The resource tools are built-in, the policy is checked against the server they read from
+	ctx := policy.WithPrincipal(context.Background(), policy.Principal{User: "bob"})
+	assert.Empty(t, manager.ListResources(ctx))
+	assert.Empty(t, manager.ListPrompts(ctx))
+	_, err := manager.ReadResource(ctx, "docs", "docs://readme")
+	assert.ErrorIs(t, err, ErrNotAllowed)
+	_, err = manager.GetPrompt(ctx, "docs", "review", map[string]string{"file": "main.go"})
+	assert.ErrorIs(t, err, ErrNotAllowed)
+
+	readTool := &readResourceTool{manager: manager}
+	_, err = readTool.InvokableRun(ctx, `{"server":"docs","uri":"docs://readme"}`)
+	assert.ErrorIs(t, err, ErrNotAllowed)
+
+	// Deny wins over allow of any role
+	ctx = policy.WithPrincipal(context.Background(), policy.Principal{User: "alice", Roles: []string{"writer"}})
+	assert.Empty(t, manager.ListResources(ctx))
+}
+
+func TestReadResourcePositivePolicy(t *testing.T) {
+	manager := loadDocsServer(t)
+	toolPolicy := &atomic.Pointer[policy.Policy]{}
+	toolPolicy.Store(policy.New(&mcpConfig.ToolPolicyConfig{
+		Roles: map[string]mcpConfig.ToolRuleConfig{"default": {Allow: []string{"docs__resources"}}},
+	}))
+	manager.SetPolicy(toolPolicy)
+
+	assert.Len(t, manager.ListResources(context.Background()), 1)
+	assert.Empty(t, manager.ListPrompts(context.Background()))
+	content, err := manager.ReadResource(context.Background(), "docs", "docs://readme")
+	assert.NoError(t, err)
+	assert.Equal(t, "# Ricky", content)
+}
@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultResultLimit is the number of characters of a tool result passed to the model
+const defaultResultLimit = 20000
+
+// errorResultPrefix marks results the server flagged as errors, the model only sees the text
+const errorResultPrefix = "Tool returned an error: "
+
+// Media types of MediaPart
+const (
+	MediaImage = "image"
+	MediaAudio = "audio"
+)
+
+// MediaPart is an image or audio output of a tool, passed to models that accept it
+type MediaPart struct {
+	Type     string
+	MimeType string
+	Data     string // base64
+}
+
+// ToolResult is the result of a tool call converted for the model and the chat UI
+type ToolResult struct {
+	Text      string
+	Media     []MediaPart
+	Artifacts []Artifact
+	IsError   bool
+}
+
+// ResultTool is a tool whose results carry media and artifacts besides text
+type ResultTool interface {
+	tool.InvokableTool
+	RunWithResult(ctx context.Context, argumentsInJSON string) (*ToolResult, error)
+}
+
+// convertResult turns text parts into plain text, keeps images, audio and binary resources as artifacts
+// and truncates the text to the configured limit
+func (m *MCPToolManager) convertResult(toolName string, result *mcp.CallToolResult) *ToolResult {
+	converted := &ToolResult{IsError: result.IsError}
+	var parts []string
+
+	addBinary := func(mediaType string, mimeType string, data string, name string) {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			parts = append(parts, fmt.Sprintf("[invalid %s %s data]", mimeType, name))
+			return
+		}
+		artifact := m.artifacts.Put(name, mimeType, decoded)
+		converted.Artifacts = append(converted.Artifacts, artifact)
+		if mediaType != "" {
+			converted.Media = append(converted.Media, MediaPart{Type: mediaType, MimeType: mimeType, Data: data})
+		}
+		parts = append(parts, fmt.Sprintf("[%s %s, %d bytes, shown to the user]", mimeType, name, len(decoded)))
+	}
+
+	for index, content := range result.Content {
+		name := fmt.Sprintf("%s-%d", toolName, index+1)
+		switch content := content.(type) {
+		case mcp.TextContent:
+			parts = append(parts, content.Text)
+		case mcp.ImageContent:
+			addBinary(MediaImage, content.MIMEType, content.Data, name)
+		case mcp.AudioContent:
+			addBinary(MediaAudio, content.MIMEType, content.Data, name)
+		case mcp.EmbeddedResource:
+			switch resource := content.Resource.(type) {
+			case mcp.TextResourceContents:
+				parts = append(parts, fmt.Sprintf("Resource %s:\n%s", resource.URI, resource.Text))
+			case mcp.BlobResourceContents:
+				addBinary("", resource.MIMEType, resource.Blob, resource.URI)
+			}
+		case mcp.ResourceLink:
+			parts = append(parts, fmt.Sprintf("[resource %s: %s]", resourceLabel(content.Name, content.URI), content.Description))
+		}
+	}
+
+	// Structured content is expected to be mirrored by text, it is only passed on when there is none
+	if len(parts) == 0 && result.StructuredContent != nil {
+		if structured, err := json.Marshal(result.StructuredContent); err == nil {
+			parts = append(parts, string(structured))
+		}
+	}
+
+	text := strings.Join(parts, "\n\n")
+	if result.IsError {
+		text = errorResultPrefix + text
+	}
+	converted.Text = truncate(text, m.ResultLimit())
+	return converted
+}
+
+func resourceLabel(name string, uri string) string {
+	if name == "" {
+		return uri
+	}
+	return name + " " + uri
+}
+
+// truncate shortens the text to limit characters and says how much was left out
+func truncate(text string, limit int) string {
+	length := utf8.RuneCountInString(text)
+	if limit <= 0 || length <= limit {
+		return text
+	}
+	return fmt.Sprintf("%s\n\n[output truncated, %d of %d characters shown]", string([]rune(text)[:limit]), limit, length)
+}
@@ -0,0 +1,130 @@
+package tools
+
+import (
+	"encoding/base64"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestConvertResultPositiveTextAndImage(t *testing.T) {
+	manager := NewMCPToolManager()
+	image := base64.StdEncoding.EncodeToString([]byte("png"))
+
+	result := manager.convertResult("chart", &mcp.CallToolResult{Content: []mcp.Content{
+		mcp.NewTextContent("The chart:"),
+		mcp.NewImageContent(image, "image/png"),
+	}})
+
+	assert.False(t, result.IsError)
+	assert.Equal(t, "The chart:\n\n[image/png chart-2, 3 bytes, shown to the user]", result.Text)
+	assert.Equal(t, []MediaPart{{Type: MediaImage, MimeType: "image/png", Data: image}}, result.Media)
+	if assert.Len(t, result.Artifacts, 1) {
+		assert.True(t, result.Artifacts[0].IsImage())
+
+		artifact, data, found := manager.Artifact(result.Artifacts[0].ID)
+		assert.True(t, found)
+		assert.Equal(t, "chart-2", artifact.Name)
+		assert.Equal(t, []byte("png"), data)
+	}
+}
+
+func TestConvertResultPositiveEmbeddedResources(t *testing.T) {
+	manager := NewMCPToolManager()
+
+	result := manager.convertResult("files", &mcp.CallToolResult{Content: []mcp.Content{
+		mcp.NewEmbeddedResource(mcp.TextResourceContents{URI: "file:///notes.txt", Text: "notes"}),
+		mcp.NewEmbeddedResource(mcp.BlobResourceContents{URI: "file:///data.bin", MIMEType: "application/octet-stream",
+			Blob: base64.StdEncoding.EncodeToString([]byte{1, 2})}),
+	}})
+
+	assert.Contains(t, result.Text, "Resource file:///notes.txt:\nnotes")
+	assert.Contains(t, result.Text, "[application/octet-stream file:///data.bin, 2 bytes, shown to the user]")
+	assert.Empty(t, result.Media)
+	assert.Len(t, result.Artifacts, 1)
+}
+
+func TestConvertResultPositiveStructuredContent(t *testing.T) {
+	manager := NewMCPToolManager()
+
+	result := manager.convertResult("weather", &mcp.CallToolResult{StructuredContent: map[string]any{"celsius": 21}})
+	assert.Equal(t, `{"celsius":21}`, result.Text)
+
+	// Text mirroring the structured content is preferred
+	result = manager.convertResult("weather", &mcp.CallToolResult{
+		Content:           []mcp.Content{mcp.NewTextContent("21 degrees")},
+		StructuredContent: map[string]any{"celsius": 21},
+	})
+	assert.Equal(t, "21 degrees", result.Text)
+}
+
+func TestConvertResultNegativeInvalidData(t *testing.T) {
+	manager := NewMCPToolManager()
+
+	result := manager.convertResult("chart", &mcp.CallToolResult{
+		Content: []mcp.Content{mcp.NewImageContent("not base64!", "image/png")},
+		IsError: true,
+	})
+
+	assert.True(t, result.IsError)
+	assert.Equal(t, "Tool returned an error: [invalid image/png chart-1 data]", result.Text)
+	assert.Empty(t, result.Artifacts)
+	assert.Empty(t, result.Media)
+}
+
+func TestConvertResultNegativeError(t *testing.T) {
+	manager := NewMCPToolManager()
+
+	result := manager.convertResult("weather", mcp.NewToolResultError("unknown city"))
+
+	assert.True(t, result.IsError)
+	assert.Equal(t, "Tool returned an error: unknown city", result.Text)
+}
+
+func TestTruncatePositive(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "unlimited", truncate("unlimited", 0))
+	assert.Equal(t, "äöü\n\n[output truncated, 3 of 5 characters shown]", truncate("äöüßx", 3))
+}
+
+func TestTruncateNegativeLongOutput(t *testing.T) {
+	text := truncate(strings.Repeat("x", 100), 10)
+	assert.True(t, strings.HasPrefix(text, strings.Repeat("x", 10)+"\n\n"))
+	assert.Contains(t, text, "10 of 100 characters shown")
+}
+
+func TestArtifactStorePositiveEvictsOldest(t *testing.T) {
+	store := NewArtifactStore(10)
+
+	first := store.Put("first", "text/plain", []byte("123456"))
+	second := store.Put("second", "text/plain", []byte("123456"))
+
+	_, _, found := store.Get(first.ID)
+	assert.False(t, found)
+	_, data, found := store.Get(second.ID)
+	assert.True(t, found)
+	assert.Equal(t, []byte("123456"), data)
+}
+
+func TestArtifactStoreNegativeTooLarge(t *testing.T) {
+	store := NewArtifactStore(4)
+
+	artifact := store.Put("large", "audio/wav", []byte("12345"))
+	assert.Equal(t, 5, artifact.Size)
+	assert.True(t, artifact.IsAudio())
+
+	_, _, found := store.Get(artifact.ID)
+	assert.False(t, found)
+}
+
+func TestArtifactNegativeActiveContent(t *testing.T) {
+	for _, mimeType := range []string{"image/svg+xml", "text/html", "audio", "not a type"} {
+		artifact := Artifact{MimeType: mimeType}
+		assert.False(t, artifact.IsImage(), mimeType)
+		assert.False(t, artifact.IsAudio(), mimeType)
+		assert.False(t, artifact.IsInline(), mimeType)
+	}
+	assert.True(t, Artifact{MimeType: "Image/PNG"}.IsImage())
+	assert.True(t, Artifact{MimeType: "audio/ogg; codecs=opus"}.IsAudio())
+}
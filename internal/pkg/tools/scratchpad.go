@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"context"
+	"sync"
+)
+
+// Scratchpad keeps the notes the model takes during a conversation
+type Scratchpad struct {
+	mutex sync.RWMutex
+	notes []string
+}
+
+// NewScratchpad creates an empty scratchpad
+func NewScratchpad() *Scratchpad {
+	return &Scratchpad{}
+}
+
+type scratchpadKey struct{}
+
+// WithScratchpad returns a context whose tool calls keep their notes in the given scratchpad
+func WithScratchpad(ctx context.Context, scratchpad *Scratchpad) context.Context {
+	return context.WithValue(ctx, scratchpadKey{}, scratchpad)
+}
+
+func scratchpadFromContext(ctx context.Context) *Scratchpad {
+	scratchpad, _ := ctx.Value(scratchpadKey{}).(*Scratchpad)
+	return scratchpad
+}
+
+// Add appends a note
+func (s *Scratchpad) Add(note string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.notes = append(s.notes, note)
+}
+
+// Notes returns a copy of the notes
+func (s *Scratchpad) Notes() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]string{}, s.notes...)
+}
+
+// Replace sets the notes to a copy of the given ones
+func (s *Scratchpad) Replace(notes []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.notes = append([]string{}, notes...)
+}
+
+// Clear removes all notes
+func (s *Scratchpad) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.notes = nil
+}
@@ -0,0 +1,243 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"encoding/json"
+	"fmt"
+	"github.com/cloudwego/eino/schema"
+	"math"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchToolName is the meta-tool the model uses to find tools that were not offered for the turn
+const SearchToolName = "search_tools"
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// stopWords are left out of the index and the queries as they match most descriptions
+var stopWords = map[string]bool{
+	"an": true, "and": true, "are": true, "be": true, "by": true, "can": true, "do": true, "for": true, "from": true,
+	"how": true, "in": true, "is": true, "it": true, "me": true, "my": true, "of": true, "on": true, "or": true,
+	"please": true, "that": true, "the": true, "this": true, "to": true, "what": true, "with": true,
+}
+
+// ToolSelection is the tools offered to the model during a turn, it grows as the model searches the catalog
+type ToolSelection struct {
+	offered []*schema.ToolInfo
+	index   *toolIndex // nil when every tool is offered
+	limit   int
+}
+
+// searchArguments are the arguments of the meta-tool
+type searchArguments struct {
+	Query string `json:"query"`
+}
+
+// SelectTools picks the tools of the catalog relevant to the query: the ones matching the always-include patterns,
+// the ones already used in the conversation and the best BM25 matches on names and descriptions up to max-tools.
+// The meta-tool is added when tools are left out, names are the server__tool names the patterns are matched against.
+func SelectTools(catalog []*schema.ToolInfo, names map[string]string, query string, used []string,
+	config mcpConfig.ToolSelectionConfig) *ToolSelection {
+
+	if config.MaxTools == 0 || len(catalog) <= config.MaxTools {
+		return &ToolSelection{offered: catalog}
+	}
+
+	selection := &ToolSelection{
+		index: newToolIndex(catalog),
+		limit: config.MaxTools,
+	}
+	for _, info := range catalog {
+		if matchesAnyPattern(config.AlwaysInclude, names[info.Name]) {
+			selection.offer(info)
+		}
+	}
+
+	selected := 0
+	for _, info := range catalog {
+		if selected < config.MaxTools && slices.Contains(used, info.Name) && selection.offer(info) {
+			selected++
+		}
+	}
+	for _, info := range selection.index.search(query) {
+		if selected < config.MaxTools && selection.offer(info) {
+			selected++
+		}
+	}
+
+	selection.offered = append(selection.offered, searchToolInfo())
+	return selection
+}
+
+// Offered returns the tools to pass to the model
+func (s *ToolSelection) Offered() []*schema.ToolInfo {
+	return s.offered
+}
+
+// IsSearch reports whether a tool call is a call of the meta-tool
+func (s *ToolSelection) IsSearch(toolName string) bool {
+	return s.index != nil && toolName == SearchToolName
+}
+
+// Search runs the meta-tool, the tools found are offered from the next model call on,
+// it returns the text passed to the model and whether the arguments were invalid
+func (s *ToolSelection) Search(arguments string) (string, bool) {
+	var searchArgs searchArguments
+	if err := json.Unmarshal([]byte(arguments), &searchArgs); err != nil || strings.TrimSpace(searchArgs.Query) == "" {
+		return "The query argument is required", true
+	}
+
+	found := s.index.search(searchArgs.Query)
+	if len(found) > s.limit {
+		found = found[:s.limit]
+	}
+	if len(found) == 0 {
+		return fmt.Sprintf("No tools match %q", searchArgs.Query), false
+	}
+
+	var builder strings.Builder
+	builder.WriteString("These tools can be called now:")
+	for _, info := range found {
+		s.offer(info)
+		builder.WriteString(fmt.Sprintf("\n- %s: %s", info.Name, info.Desc))
+	}
+	return builder.String(), false
+}
+
+// offer adds a tool to the offered ones, it returns false when the tool was offered already
+func (s *ToolSelection) offer(info *schema.ToolInfo) bool {
+	if slices.Contains(s.offered, info) {
+		return false
+	}
+	s.offered = append(s.offered, info)
+	return true
+}
+
+func searchToolInfo() *schema.ToolInfo {
+	return &schema.ToolInfo{
+		Name: SearchToolName,
+		Desc: "Searches all available tools by keywords when none of the offered tools fits the task, " +
+			"the tools found can be called afterwards",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"query": {Type: schema.String, Desc: "Keywords describing what the tool should do", Required: true},
+		}),
+	}
+}
+
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// toolIndex ranks tools against a query with BM25 over their names and descriptions
+type toolIndex struct {
+	tools         []*schema.ToolInfo
+	terms         []map[string]int // term frequencies per tool
+	lengths       []int
+	averageLength float64
+	documentFreq  map[string]int
+}
+
+func newToolIndex(tools []*schema.ToolInfo) *toolIndex {
+	index := &toolIndex{
+		tools:        tools,
+		terms:        make([]map[string]int, len(tools)),
+		lengths:      make([]int, len(tools)),
+		documentFreq: make(map[string]int),
+	}
+
+	total := 0
+	for i, info := range tools {
+		tokens := tokenize(info.Name + " " + info.Desc)
+		index.terms[i] = make(map[string]int)
+		for _, token := range tokens {
+			index.terms[i][token]++
+		}
+		for token := range index.terms[i] {
+			index.documentFreq[token]++
+		}
+		index.lengths[i] = len(tokens)
+		total += len(tokens)
+	}
+	if len(tools) > 0 {
+		index.averageLength = float64(total) / float64(len(tools))
+	}
+	return index
+}
+
+// search returns the tools matching any term of the query, best match first
+func (x *toolIndex) search(query string) []*schema.ToolInfo {
+	queryTerms := tokenize(query)
+	scores := make([]float64, len(x.tools))
+	for _, term := range queryTerms {
+		documentFreq := x.documentFreq[term]
+		if documentFreq == 0 {
+			continue
+		}
+		idf := math.Log(1 + (float64(len(x.tools))-float64(documentFreq)+0.5)/(float64(documentFreq)+0.5))
+		for i, terms := range x.terms {
+			frequency := float64(terms[term])
+			if frequency == 0 {
+				continue
+			}
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(x.lengths[i])/x.averageLength)
+			scores[i] += idf * frequency * (bm25K1 + 1) / (frequency + norm)
+		}
+	}
+
+	var matches []int
+	for i, score := range scores {
+		if score > 0 {
+			matches = append(matches, i)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return scores[matches[i]] > scores[matches[j]]
+	})
+
+	found := make([]*schema.ToolInfo, len(matches))
+	for i, match := range matches {
+		found[i] = x.tools[match]
+	}
+	return found
+}
+
+// tokenize splits text into lower case words without stop words, names are split at underscores and camel case humps
+func tokenize(text string) []string {
+	var tokens []string
+	var current []rune
+	flush := func() {
+		if token := strings.ToLower(string(current)); len(current) > 1 && !stopWords[token] {
+			tokens = append(tokens, token)
+		}
+		current = current[:0]
+	}
+
+	var previous rune
+	for _, r := range text {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && unicode.IsLower(previous):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+		previous = r
+	}
+	flush()
+	return tokens
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// testCatalog returns tools of a weather server, a files server and a built-in calculator with their server__tool names
+func testCatalog() ([]*schema.ToolInfo, map[string]string) {
+	catalog := []*schema.ToolInfo{
+		{Name: "weather__getForecast", Desc: "Returns the weather forecast for a city"},
+		{Name: "weather__getAlerts", Desc: "Returns severe weather alerts of a region"},
+		{Name: "files__read_file", Desc: "Reads a file from the disk"},
+		{Name: "files__write_file", Desc: "Writes text to a file on the disk"},
+		{Name: "calculate", Desc: "Evaluates an arithmetic expression"},
+	}
+	names := map[string]string{"calculate": "builtin__calculate"}
+	for _, info := range catalog[:4] {
+		names[info.Name] = info.Name
+	}
+	return catalog, names
+}
+
+func offeredNames(selection *ToolSelection) []string {
+	var names []string
+	for _, info := range selection.Offered() {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func TestSelectToolsPositive(t *testing.T) {
+	catalog, names := testCatalog()
+	config := mcpConfig.ToolSelectionConfig{MaxTools: 2, AlwaysInclude: []string{"builtin__*"}}
+
+	selection := SelectTools(catalog, names, "What is the weather forecast for Paris?", nil, config)
+	assert.Equal(t, []string{"calculate", "weather__getForecast", "weather__getAlerts", SearchToolName}, offeredNames(selection))
+
+	selection = SelectTools(catalog, names, "and tomorrow?", []string{"files__read_file"}, config)
+	assert.Equal(t, []string{"calculate", "files__read_file", SearchToolName}, offeredNames(selection))
+
+	assert.True(t, selection.IsSearch(SearchToolName))
+	text, isError := selection.Search(`{"query":"write a file"}`)
+	assert.False(t, isError)
+	assert.Contains(t, text, "files__write_file: Writes text to a file on the disk")
+	assert.Contains(t, offeredNames(selection), "files__write_file")
+}
+
+func TestSelectToolsPositiveSmallCatalog(t *testing.T) {
+	catalog, names := testCatalog()
+
+	selection := SelectTools(catalog, names, "anything", nil, mcpConfig.ToolSelectionConfig{MaxTools: 5})
+	assert.Equal(t, catalog, selection.Offered())
+	assert.False(t, selection.IsSearch(SearchToolName))
+
+	selection = SelectTools(catalog, names, "anything", nil, mcpConfig.ToolSelectionConfig{})
+	assert.Equal(t, catalog, selection.Offered())
+}
+
+func TestSelectToolsNegativeSearch(t *testing.T) {
+	catalog, names := testCatalog()
+	selection := SelectTools(catalog, names, "hello", nil, mcpConfig.ToolSelectionConfig{MaxTools: 1})
+	assert.Equal(t, []string{SearchToolName}, offeredNames(selection))
+
+	text, isError := selection.Search(`{"query":""}`)
+	assert.True(t, isError)
+	assert.Equal(t, "The query argument is required", text)
+
+	text, isError = selection.Search(`{"query":"translate"}`)
+	assert.False(t, isError)
+	assert.Equal(t, `No tools match "translate"`, text)
+	assert.Equal(t, []string{SearchToolName}, offeredNames(selection))
+}
+
+func TestTokenizePositive(t *testing.T) {
+	assert.Equal(t, []string{"weather", "get", "forecast", "paris"}, tokenize("weather__getForecast for Paris!"))
+}
@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"context"
+	"github.com/cloudwego/eino/components/tool"
+)
+
+// BuiltinSource is the source reported for tools implemented in Go
+const BuiltinSource = "builtin"
+
+// sourcedTool is a tool that knows the MCP server or REST service it comes from
+type sourcedTool interface {
+	source() (server string, name string)
+}
+
+func (t *mcpToolImpl) source() (string, string) {
+	return t.mapping.serverName, t.mapping.originalName
+}
+
+func (t *openAPITool) source() (string, string) {
+	return t.service.name, t.operationID
+}
+
+// Source returns the MCP server or REST service of a tool and the tool's name there,
+// tools implemented in Go report BuiltinSource and their own name
+func Source(ctx context.Context, baseTool tool.BaseTool) (string, string) {
+	if sourced, ok := baseTool.(sourcedTool); ok {
+		return sourced.source()
+	}
+
+	info, err := baseTool.Info(ctx)
+	if err != nil {
+		return BuiltinSource, ""
+	}
+	return BuiltinSource, info.Name
+}
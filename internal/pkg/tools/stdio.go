@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const secretFilePrefix = "file:"
+
+// baseEnvVars are passed to stdio servers that do not inherit the environment, commands such as npx or uvx need them
+var baseEnvVars = []string{"PATH", "HOME", "USER", "LANG", "TMPDIR", "TEMP", "TMP", "SYSTEMROOT", "APPDATA", "LOCALAPPDATA", "USERPROFILE"}
+
+// stdioProcessTransport is a stdio transport over the pipes of a subprocess started by newStdioMCPClient
+type stdioProcessTransport struct {
+	*transport.Stdio
+	cmd *exec.Cmd
+}
+
+// Close closes the pipes and waits for the subprocess to exit
+func (t *stdioProcessTransport) Close() error {
+	closeErr := t.Stdio.Close()
+	waitErr := t.cmd.Wait()
+	if closeErr != nil {
+		return closeErr
+	}
+	return waitErr
+}
+
+// newStdioMCPClient starts the server command with its own environment and working directory,
+// which the mcp-go stdio client does not support
+func newStdioMCPClient(ctx context.Context, serverConfig mcpConfig.MCPServerConfig, options ...client.ClientOption) (*client.Client, error) {
+	env, err := buildStdioEnv(serverConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(serverConfig.Command, serverConfig.Args...)
+	cmd.Env = env
+	if serverConfig.Cwd != "" {
+		cmd.Dir = expandPath(serverConfig.Cwd)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	// Not cmd.StdoutPipe, Wait would close it under the transport reader which then logs a spurious read error,
+	// the read end is left to the reader goroutine that stops at EOF once the process exits
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	cmd.Stdout = stdoutWriter
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	err = cmd.Start()
+	_ = stdoutWriter.Close()
+	if err != nil {
+		_ = stdout.Close()
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	stdioClient := client.NewClient(&stdioProcessTransport{
+		Stdio: transport.NewIO(stdout, stdin, stderr),
+		cmd:   cmd,
+	}, options...)
+	if err := stdioClient.Start(ctx); err != nil {
+		_ = stdioClient.Close()
+		return nil, fmt.Errorf("failed to start stdio transport: %w", err)
+	}
+
+	return stdioClient, nil
+}
+
+// buildStdioEnv assembles the subprocess environment, later entries win:
+// the inherited environment, then the env file, then the env entries
+func buildStdioEnv(serverConfig mcpConfig.MCPServerConfig) ([]string, error) {
+	var env []string
+	if serverConfig.InheritEnv == nil || *serverConfig.InheritEnv {
+		env = os.Environ()
+	} else {
+		for _, name := range slices.Concat(baseEnvVars, serverConfig.InheritEnvVars) {
+			if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+		}
+	}
+
+	if serverConfig.EnvFile != "" {
+		fileEnv, err := readEnvFile(expandPath(serverConfig.EnvFile))
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, fileEnv...)
+	}
+
+	for _, variable := range serverConfig.Env {
+		name, value, found := strings.Cut(variable, "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid env entry %q: must be in the form NAME=value", variable)
+		}
+		resolved, err := resolveEnvValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", name, err)
+		}
+		env = append(env, name+"="+resolved)
+	}
+
+	return env, nil
+}
+
+// readEnvFile parses NAME=value lines, blank lines, # comments, "export " prefixes and quoted values are allowed
+func readEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer file.Close()
+
+	var env []string
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("env file %s line %d: must be in the form NAME=value", path, lineNumber)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		resolved, err := resolveEnvValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("env file %s line %d: %w", path, lineNumber, err)
+		}
+		env = append(env, name+"="+resolved)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	return env, nil
+}
+
+// resolveEnvValue reads file:/path references and expands ${VAR} references, so secrets stay out of the config
+func resolveEnvValue(value string) (string, error) {
+	if path, found := strings.CutPrefix(value, secretFilePrefix); found {
+		content, err := os.ReadFile(expandPath(path))
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return os.ExpandEnv(value), nil
+}
+
+// expandPath expands environment variables and a leading ~ in a path
+func expandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if rest, found := strings.CutPrefix(path, "~"); found && (rest == "" || os.IsPathSeparator(rest[0])) {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, rest)
+		}
+	}
+	return path
+}
@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const stdioHelperVariable = "TOOLS_TEST_STDIO_HELPER"
+
+// TestStdioHelperServer is not a real test, it serves an MCP server on stdio when started by the tests below
+func TestStdioHelperServer(t *testing.T) {
+	if os.Getenv(stdioHelperVariable) != "1" {
+		t.Skip("helper process")
+	}
+
+	mcpServer := server.NewMCPServer("environment", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("environment"),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			cwd, _ := os.Getwd()
+			result, _ := json.Marshal(map[string]string{
+				"cwd":      cwd,
+				"secret":   os.Getenv("TEST_SECRET"),
+				"fromFile": os.Getenv("FROM_ENV_FILE"),
+				"leaked":   os.Getenv("TOOLS_TEST_LEAKED"),
+				"passed":   os.Getenv("TOOLS_TEST_PASSED"),
+			})
+			return mcp.NewToolResultText(string(result)), nil
+		})
+
+	_ = server.ServeStdio(mcpServer)
+	os.Exit(0)
+}
+
+// callEnvironment starts the helper server with the given settings and returns the environment it reports
+func callEnvironment(t *testing.T, serverConfig mcpConfig.MCPServerConfig) map[string]string {
+	t.Helper()
+
+	serverConfig.Command = os.Args[0]
+	serverConfig.Args = []string{"-test.run=^TestStdioHelperServer$"}
+	serverConfig.Env = append(serverConfig.Env, stdioHelperVariable+"=1")
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{"local": serverConfig},
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, manager.GetTools(), 1) {
+		return nil
+	}
+
+	output, err := manager.GetTools()[0].(tool.InvokableTool).InvokableRun(context.Background(), `{}`)
+	assert.NoError(t, err)
+
+	var environment map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(output), &environment))
+	return environment
+}
+
+func TestStdioServerPositiveEnvironmentAndCwd(t *testing.T) {
+	directory := t.TempDir()
+	secretFile := filepath.Join(directory, "secret")
+	envFile := filepath.Join(directory, "server.env")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("from-secret-file\n"), 0600))
+	assert.NoError(t, os.WriteFile(envFile, []byte("# comment\nexport FROM_ENV_FILE=\"${TOOLS_TEST_PASSED}-file\"\nTEST_SECRET=overridden\n"), 0600))
+	t.Setenv("TOOLS_TEST_LEAKED", "leaked")
+	t.Setenv("TOOLS_TEST_PASSED", "passed")
+
+	environment := callEnvironment(t, mcpConfig.MCPServerConfig{
+		Cwd:            directory,
+		EnvFile:        envFile,
+		Env:            []string{"TEST_SECRET=file:" + secretFile},
+		InheritEnv:     new(bool),
+		InheritEnvVars: []string{"TOOLS_TEST_PASSED"},
+	})
+
+	resolvedDirectory, _ := filepath.EvalSymlinks(directory)
+	resolvedCwd, _ := filepath.EvalSymlinks(environment["cwd"])
+	assert.Equal(t, resolvedDirectory, resolvedCwd)
+	assert.Equal(t, "from-secret-file", environment["secret"])
+	assert.Equal(t, "passed-file", environment["fromFile"])
+	assert.Equal(t, "passed", environment["passed"])
+	assert.Empty(t, environment["leaked"])
+}
+
+func TestStdioServerPositiveInheritedEnvironment(t *testing.T) {
+	t.Setenv("TOOLS_TEST_LEAKED", "inherited")
+	t.Setenv("TOOLS_TEST_TOKEN", "token")
+
+	environment := callEnvironment(t, mcpConfig.MCPServerConfig{
+		Env: []string{"TEST_SECRET=${TOOLS_TEST_TOKEN}"},
+	})
+
+	assert.Equal(t, "inherited", environment["leaked"])
+	assert.Equal(t, "token", environment["secret"])
+}
+
+func TestBuildStdioEnvNegative(t *testing.T) {
+	_, err := buildStdioEnv(mcpConfig.MCPServerConfig{Env: []string{"NO_VALUE"}})
+	assert.EqualError(t, err, "invalid env entry \"NO_VALUE\": must be in the form NAME=value")
+
+	_, err = buildStdioEnv(mcpConfig.MCPServerConfig{Env: []string{"TOKEN=file:" + filepath.Join(t.TempDir(), "missing")}})
+	assert.ErrorContains(t, err, "env TOKEN: failed to read secret file")
+
+	_, err = buildStdioEnv(mcpConfig.MCPServerConfig{EnvFile: filepath.Join(t.TempDir(), "missing.env")})
+	assert.ErrorContains(t, err, "failed to open env file")
+}
@@ -0,0 +1,297 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// uncheckedKeywords are the JSON schema keywords the OpenAPI schema validation cannot check, arguments of
+// schemas using them are sent unchecked rather than rejected for the wrong reason
+var uncheckedKeywords = []string{
+	"$dynamicRef", "$recursiveRef", "if", "then", "else", "prefixItems", "patternProperties", "dependentRequired",
+	"dependentSchemas", "dependencies", "unevaluatedProperties", "unevaluatedItems", "contains", "propertyNames",
+}
+
+// checkableSchema converts the JSON schema of an MCP tool into an OpenAPI schema the arguments can be validated
+// against. Local references to "$defs" and "definitions" are inlined and null types become nullable schemas.
+// It returns nil when the schema cannot be fully checked, so only definite violations are rejected
+func checkableSchema(rawSchema []byte) *openapi3.Schema {
+	var root map[string]any
+	if err := json.Unmarshal(rawSchema, &root); err != nil {
+		return nil
+	}
+
+	definitions := make(map[string]any)
+	for _, keyword := range []string{"$defs", "definitions"} {
+		if defs, ok := root[keyword].(map[string]any); ok {
+			for name, definition := range defs {
+				definitions["#/"+keyword+"/"+name] = definition
+			}
+		}
+	}
+
+	normalized, ok := normalizeSchema(root, definitions, nil)
+	if !ok {
+		return nil
+	}
+	marshaled, err := json.Marshal(normalized)
+	if err != nil {
+		return nil
+	}
+	inputSchema := &openapi3.Schema{}
+	if err := inputSchema.UnmarshalJSON(marshaled); err != nil {
+		return nil
+	}
+	return inputSchema
+}
+
+// normalizeSchema returns a copy of a JSON schema the OpenAPI validation checks the same way, resolving holds
+// the references being inlined to detect recursive definitions. It reports false when that is not possible
+func normalizeSchema(node any, definitions map[string]any, resolving []string) (any, bool) {
+	// true accepts anything, false nothing, which has no OpenAPI counterpart
+	if accepts, isBool := node.(bool); isBool {
+		return map[string]any{}, accepts
+	}
+	nodeSchema, isMap := node.(map[string]any)
+	if !isMap {
+		return nil, false
+	}
+
+	if ref, found := nodeSchema["$ref"]; found {
+		refName, _ := ref.(string)
+		definition, known := definitions[refName]
+		if !known || slices.Contains(resolving, refName) {
+			return nil, false
+		}
+		resolved, ok := normalizeSchema(definition, definitions, append(resolving, refName))
+		if !ok {
+			return nil, false
+		}
+
+		siblings := make(map[string]any)
+		for keyword, value := range nodeSchema {
+			if keyword != "$ref" {
+				siblings[keyword] = value
+			}
+		}
+		if len(siblings) == 0 {
+			return resolved, true
+		}
+		normalizedSiblings, ok := normalizeSchema(siblings, definitions, resolving)
+		if !ok {
+			return nil, false
+		}
+		return map[string]any{"allOf": []any{resolved, normalizedSiblings}}, true
+	}
+
+	normalized := make(map[string]any, len(nodeSchema))
+	for keyword, value := range nodeSchema {
+		if slices.Contains(uncheckedKeywords, keyword) {
+			return nil, false
+		}
+
+		switch keyword {
+		case "$defs", "definitions", "$schema", "$id", "$anchor", "$comment":
+		case "properties":
+			properties, ok := value.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			normalizedProperties := make(map[string]any, len(properties))
+			for name, property := range properties {
+				if normalizedProperties[name], ok = normalizeSchema(property, definitions, resolving); !ok {
+					return nil, false
+				}
+			}
+			normalized[keyword] = normalizedProperties
+		case "additionalProperties":
+			if allowed, isBool := value.(bool); isBool {
+				normalized[keyword] = allowed
+				continue
+			}
+			fallthrough
+		case "items", "not":
+			// An array of items is a tuple, which is not checked
+			normalizedValue, ok := normalizeSchema(value, definitions, resolving)
+			if !ok {
+				return nil, false
+			}
+			normalized[keyword] = normalizedValue
+		case "allOf", "anyOf", "oneOf":
+			branches, ok := value.([]any)
+			if !ok {
+				return nil, false
+			}
+			var normalizedBranches []any
+			for _, branch := range branches {
+				// A null branch, as in the optional fields of pydantic, makes the schema nullable
+				if branchSchema, isMap := branch.(map[string]any); isMap && keyword != "allOf" &&
+					len(branchSchema) == 1 && branchSchema["type"] == "null" {
+					normalized["nullable"] = true
+					continue
+				}
+				normalizedBranch, ok := normalizeSchema(branch, definitions, resolving)
+				if !ok {
+					return nil, false
+				}
+				normalizedBranches = append(normalizedBranches, normalizedBranch)
+			}
+			if len(normalizedBranches) > 0 {
+				normalized[keyword] = normalizedBranches
+			}
+		case "type":
+			types, isList := value.([]any)
+			if !isList {
+				types = []any{value}
+			}
+			var otherTypes []any
+			for _, valueType := range types {
+				if valueType == "null" {
+					normalized["nullable"] = true
+				} else {
+					otherTypes = append(otherTypes, valueType)
+				}
+			}
+			switch len(otherTypes) {
+			case 0:
+				normalized["enum"] = []any{nil}
+			case 1:
+				normalized[keyword] = otherTypes[0]
+			}
+			// Several types are not checked
+		case "const":
+			normalized["enum"] = []any{value}
+		case "exclusiveMinimum", "exclusiveMaximum":
+			// The numeric form of newer JSON schemas is the bound itself
+			if bound, isNumber := value.(float64); isNumber {
+				if keyword == "exclusiveMinimum" {
+					normalized["minimum"] = bound
+				} else {
+					normalized["maximum"] = bound
+				}
+				normalized[keyword] = true
+				continue
+			}
+			normalized[keyword] = value
+		default:
+			normalized[keyword] = value
+		}
+	}
+	return normalized, true
+}
+
+// validateArguments checks the arguments produced by the model against the input schema of a tool before they
+// are sent to the server. With coerce, numbers and booleans passed as strings are converted first.
+// It returns the arguments to send, which differ from the input only when something was coerced
+func validateArguments(inputSchema *openapi3.Schema, argumentsInJSON string, coerce bool) (string, error) {
+	if strings.TrimSpace(argumentsInJSON) == "" {
+		argumentsInJSON = "{}"
+	}
+
+	var arguments any
+	if err := json.Unmarshal([]byte(argumentsInJSON), &arguments); err != nil {
+		return "", fmt.Errorf("arguments are not valid JSON: %v", err)
+	}
+	if inputSchema == nil {
+		return argumentsInJSON, nil
+	}
+
+	coerced := false
+	if coerce {
+		arguments, coerced = coerceValue(inputSchema, arguments)
+	}
+
+	if err := inputSchema.VisitJSON(arguments, openapi3.MultiErrors()); err != nil {
+		return "", validationError(err)
+	}
+
+	if !coerced {
+		return argumentsInJSON, nil
+	}
+	marshaled, err := json.Marshal(arguments)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal coerced arguments: %v", err)
+	}
+	return string(marshaled), nil
+}
+
+// coerceValue converts strings holding numbers or booleans where the schema expects them,
+// it reports whether anything was converted
+func coerceValue(valueSchema *openapi3.Schema, value any) (any, bool) {
+	switch value := value.(type) {
+	case string:
+		switch valueSchema.Type {
+		case openapi3.TypeNumber:
+			if number, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				return number, true
+			}
+		case openapi3.TypeInteger:
+			if number, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				return float64(number), true
+			}
+		case openapi3.TypeBoolean:
+			if boolean, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+				return boolean, true
+			}
+		}
+	case map[string]any:
+		coerced := false
+		for name, property := range value {
+			propertySchema := valueSchema.Properties[name]
+			if propertySchema == nil || propertySchema.Value == nil {
+				continue
+			}
+			if converted, changed := coerceValue(propertySchema.Value, property); changed {
+				value[name] = converted
+				coerced = true
+			}
+		}
+		return value, coerced
+	case []any:
+		if valueSchema.Items == nil || valueSchema.Items.Value == nil {
+			return value, false
+		}
+		coerced := false
+		for index, item := range value {
+			if converted, changed := coerceValue(valueSchema.Items.Value, item); changed {
+				value[index] = converted
+				coerced = true
+			}
+		}
+		return value, coerced
+	}
+	return value, false
+}
+
+// validationError lists the schema violations with the path of the offending argument
+func validationError(err error) error {
+	var reasons []string
+	collectReasons(err, &reasons)
+	return fmt.Errorf("invalid arguments: %s", strings.Join(reasons, "; "))
+}
+
+func collectReasons(err error, reasons *[]string) {
+	var multiError openapi3.MultiError
+	if errors.As(err, &multiError) {
+		for _, nested := range multiError {
+			collectReasons(nested, reasons)
+		}
+		return
+	}
+
+	var schemaError *openapi3.SchemaError
+	if !errors.As(err, &schemaError) {
+		*reasons = append(*reasons, err.Error())
+		return
+	}
+	if path := strings.Join(schemaError.JSONPointer(), "."); path != "" {
+		*reasons = append(*reasons, path+": "+schemaError.Reason)
+	} else {
+		*reasons = append(*reasons, schemaError.Reason)
+	}
+}
@@ -0,0 +1,218 @@
+package tools
+
+import (
+	"ai-chat/internal/pkg/mcpConfig"
+	"context"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newSearchSchema returns the input schema of a search tool
+func newSearchSchema(t *testing.T) *openapi3.Schema {
+	t.Helper()
+
+	inputSchema := &openapi3.Schema{}
+	err := inputSchema.UnmarshalJSON([]byte(`{
+		"type": "object",
+		"properties": {
+			"query": {"type": "string"},
+			"limit": {"type": "integer"},
+			"exact": {"type": "boolean"},
+			"order": {"type": "string", "enum": ["asc", "desc"]},
+			"scores": {"type": "array", "items": {"type": "number"}}
+		},
+		"required": ["query"]
+	}`))
+	assert.NoError(t, err)
+	return inputSchema
+}
+
+func TestValidateArgumentsPositive(t *testing.T) {
+	inputSchema := newSearchSchema(t)
+
+	arguments, err := validateArguments(inputSchema, `{"query":"go","limit":5,"order":"asc"}`, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"query":"go","limit":5,"order":"asc"}`, arguments)
+}
+
+func TestValidateArgumentsPositiveEmpty(t *testing.T) {
+	arguments, err := validateArguments(&openapi3.Schema{Type: openapi3.TypeObject}, "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", arguments)
+}
+
+func TestValidateArgumentsPositiveCoercion(t *testing.T) {
+	inputSchema := newSearchSchema(t)
+
+	arguments, err := validateArguments(inputSchema, `{"query":"go","limit":"5","exact":"true","scores":["0.5",1]}`, true)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"query":"go","limit":5,"exact":true,"scores":[0.5,1]}`, arguments)
+}
+
+func TestValidateArgumentsNegativeWithoutCoercion(t *testing.T) {
+	inputSchema := newSearchSchema(t)
+
+	_, err := validateArguments(inputSchema, `{"query":"go","limit":"5"}`, false)
+	assert.EqualError(t, err, `invalid arguments: limit: value must be an integer`)
+}
+
+func TestValidateArgumentsNegativeSchemaViolations(t *testing.T) {
+	inputSchema := newSearchSchema(t)
+
+	_, err := validateArguments(inputSchema, `{"limit":"many","order":"random"}`, true)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `property "query" is missing`)
+		assert.Contains(t, err.Error(), `limit: value must be an integer`)
+		assert.Contains(t, err.Error(), `order: value is not one of the allowed values`)
+	}
+}
+
+func TestValidateArgumentsNegativeInvalidJSON(t *testing.T) {
+	_, err := validateArguments(newSearchSchema(t), `{"query":`, true)
+	assert.ErrorContains(t, err, "arguments are not valid JSON")
+}
+
+func TestValidationNegativeServerNotCalled(t *testing.T) {
+	var calls atomic.Int32
+	mcpServer := server.NewMCPServer("echo", "1.0.0")
+	mcpServer.AddTool(mcp.NewTool("echo", mcp.WithString("text", mcp.Required())),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls.Add(1)
+			return mcp.NewToolResultText(request.GetString("text", "")), nil
+		})
+	httpServer := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer))
+	t.Cleanup(httpServer.Close)
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{"remote": {
+			Transport: mcpConfig.TransportStreamableHTTP,
+			URL:       httpServer.URL + "/mcp",
+		}},
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, manager.GetTools(), 1) {
+		return
+	}
+
+	result, err := manager.GetTools()[0].(ResultTool).RunWithResult(context.Background(), `{"message":"hello"}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text, `property "text" is missing`)
+	assert.Zero(t, calls.Load())
+}
+
+// pydanticSchema is the input schema pydantic generates for a model with a nested model and an optional field
+const pydanticSchema = `{
+	"$defs": {
+		"Address": {
+			"type": "object",
+			"properties": {"street": {"type": "string"}, "zip": {"type": "integer"}},
+			"required": ["street"]
+		}
+	},
+	"type": "object",
+	"properties": {
+		"address": {"$ref": "#/$defs/Address"},
+		"previous": {"type": "array", "items": {"$ref": "#/$defs/Address"}},
+		"limit": {"anyOf": [{"type": "integer"}, {"type": "null"}], "default": null}
+	},
+	"required": ["address"]
+}`
+
+func TestCheckableSchemaPositiveDefs(t *testing.T) {
+	inputSchema := checkableSchema([]byte(pydanticSchema))
+	if !assert.NotNil(t, inputSchema) {
+		return
+	}
+
+	arguments, err := validateArguments(inputSchema, `{"address":{"street":"Main","zip":"1000"},"previous":[{"street":"Side"}]}`, true)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"address":{"street":"Main","zip":1000},"previous":[{"street":"Side"}]}`, arguments)
+
+	_, err = validateArguments(inputSchema, `{"address":{"zip":1000},"previous":[{"street":1}]}`, true)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `property "street" is missing`)
+		assert.Contains(t, err.Error(), `previous.0.street: value must be a string`)
+	}
+}
+
+func TestCheckableSchemaPositiveNullable(t *testing.T) {
+	inputSchema := checkableSchema([]byte(pydanticSchema))
+	if !assert.NotNil(t, inputSchema) {
+		return
+	}
+
+	_, err := validateArguments(inputSchema, `{"address":{"street":"Main"},"limit":null}`, true)
+	assert.NoError(t, err)
+	_, err = validateArguments(inputSchema, `{"address":{"street":"Main"},"limit":5}`, true)
+	assert.NoError(t, err)
+
+	// A value of another type is still a violation
+	_, err = validateArguments(inputSchema, `{"address":{"street":"Main"},"limit":"many"}`, true)
+	assert.ErrorContains(t, err, "limit")
+
+	// The list of types of newer JSON schemas
+	inputSchema = checkableSchema([]byte(`{"type":"object","properties":{"note":{"type":["string","null"]}}}`))
+	if !assert.NotNil(t, inputSchema) {
+		return
+	}
+	_, err = validateArguments(inputSchema, `{"note":null}`, true)
+	assert.NoError(t, err)
+	_, err = validateArguments(inputSchema, `{"note":5}`, true)
+	assert.EqualError(t, err, "invalid arguments: note: value must be a string")
+}
+
+func TestCheckableSchemaNegativeUnchecked(t *testing.T) {
+	for _, rawSchema := range []string{
+		// Recursive definitions cannot be inlined
+		`{"$defs":{"Node":{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#/$defs/Node"}}}}},
+			"type":"object","properties":{"root":{"$ref":"#/$defs/Node"}}}`,
+		`{"type":"object","properties":{"address":{"$ref":"https://example.com/address.json"}}}`,
+		`{"type":"object","properties":{"kind":{"type":"string"}},"if":{"properties":{"kind":{"const":"a"}}},"then":{"required":["a"]}}`,
+	} {
+		assert.Nil(t, checkableSchema([]byte(rawSchema)), rawSchema)
+	}
+
+	// Without a schema to check, any valid JSON is sent
+	arguments, err := validateArguments(nil, `{"root":{"children":[]}}`, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"root":{"children":[]}}`, arguments)
+}
+
+func TestValidationPositiveDefsServerCalled(t *testing.T) {
+	mcpServer := server.NewMCPServer("address", "1.0.0")
+	mcpServer.AddTool(mcp.NewToolWithRawSchema("save", "Saves an address", []byte(pydanticSchema)),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("saved"), nil
+		})
+	httpServer := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer))
+	t.Cleanup(httpServer.Close)
+
+	manager := NewMCPToolManager()
+	t.Cleanup(func() { _ = manager.Close() })
+	err := manager.LoadTools(context.Background(), &mcpConfig.Config{
+		MCPServers: map[string]mcpConfig.MCPServerConfig{"remote": {
+			Transport: mcpConfig.TransportStreamableHTTP,
+			URL:       httpServer.URL + "/mcp",
+		}},
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, manager.GetTools(), 1) {
+		return
+	}
+
+	result, err := manager.GetTools()[0].(ResultTool).RunWithResult(context.Background(), `{"address":{"street":"Main"},"limit":null}`)
+	assert.NoError(t, err)
+	assert.False(t, result.IsError, result.Text)
+	assert.Equal(t, "saved", result.Text)
+
+	result, err = manager.GetTools()[0].(ResultTool).RunWithResult(context.Background(), `{"address":{"zip":1000}}`)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text, `property "street" is missing`)
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"bytes"
+	"encoding/json"
 	"html/template"
 	"net/http"
 )
@@ -24,6 +25,32 @@ func RenderResponse(status int, templates *template.Template, templateName strin
 	}
 }
 
+func JsonResponse(status int, data any, headers Headers, cookie *http.Cookie) *Response {
+	content, err := json.Marshal(data)
+	if err != nil {
+		log.Error().Err(err).Msg("json.Marshal() failed")
+		return GetEmptyResponse(http.StatusInternalServerError, nil, nil)
+	}
+
+	return &Response{
+		Status:      status,
+		ContentType: "application/json",
+		Content:     content,
+		Headers:     headers,
+		Cookie:      cookie,
+	}
+}
+
+func BinaryResponse(status int, contentType string, content []byte, headers Headers, cookie *http.Cookie) *Response {
+	return &Response{
+		Status:      status,
+		ContentType: contentType,
+		Content:     content,
+		Headers:     headers,
+		Cookie:      cookie,
+	}
+}
+
 func GetEmptyResponse(status int, headers Headers, cookie *http.Cookie) *Response {
 	return GetResponse(status, []byte(""), headers, cookie)
 }
@@ -43,10 +43,17 @@ window.mainContentScrollToBottom = function(){
     }
 }
 
+// Tool steps the user opened stay open while the running turn re-renders the last assistant message
+let openToolSteps = []
+
 document.body.addEventListener("htmx:oobBeforeSwap", function (evt) {
     const chatMessages = document.querySelector('#main .chat-messages')
     const lastAssistantChatMessage = document.querySelector('#main .chat-message.assistant:last-child')
 
+    if (evt.detail.target === lastAssistantChatMessage) {
+        openToolSteps = Array.from(lastAssistantChatMessage.querySelectorAll('.tool-step[open]'), step => step.dataset.step)
+    }
+
     if (evt.detail.target === chatMessages || evt.detail.target === lastAssistantChatMessage) {
         const chatWrapper = document.querySelector(".main-content")
 
@@ -69,6 +76,10 @@ document.body.addEventListener("htmx:oobAfterSwap", function (evt) {
         window.mainContentScrollToBottom()
 
     } else if (evt.detail.target === lastAssistantChatMessage) {
+        for (const step of openToolSteps) {
+            lastAssistantChatMessage.querySelector(`.tool-step[data-step="${step}"]`)?.setAttribute('open', '')
+        }
+        openToolSteps = []
         parseRawMessage(lastAssistantChatMessage)
         window.mainContentScrollToBottom()
     }
@@ -88,8 +99,189 @@ document.body.addEventListener("parseAllRawMessages", function(evt){
 document.body.addEventListener("clearUserInput", function(evt){
     const userInput = document.querySelector('.main-footer .user-input')
     userInput.value = ''
+
+    const resourcePicker = document.querySelector('.main-footer .resource-picker')
+    if (resourcePicker) {
+        for (const option of resourcePicker.options) {
+            option.selected = false
+        }
+    }
+})
+
+document.body.addEventListener("loadModels", async function(evt){
+    const picker = document.querySelector('.main-header .model-picker')
+    if (!picker) {
+        return
+    }
+
+    const response = await fetch('/api/models')
+    if (!response.ok) {
+        return
+    }
+    const listing = await response.json()
+
+    picker.innerHTML = ''
+    let currentListed = false
+    for (const provider of listing.providers) {
+        const group = document.createElement('optgroup')
+        group.label = provider.error ? `${provider.provider} (unavailable)` : provider.provider
+
+        for (const model of provider.models) {
+            const option = document.createElement('option')
+            option.value = model.model
+            option.textContent = model.name + capabilityLabels(model.capabilities)
+            option.selected = model.model === listing.current
+            currentListed = currentListed || option.selected
+            group.appendChild(option)
+        }
+        picker.appendChild(group)
+    }
+
+    if (!currentListed) {
+        const option = document.createElement('option')
+        option.value = listing.current
+        option.textContent = listing.current
+        option.selected = true
+        picker.prepend(option)
+    }
+})
+
+document.body.addEventListener("loadMcpItems", async function(evt){
+    const resourcePicker = document.querySelector('.main-footer .resource-picker')
+    const promptPicker = document.querySelector('.main-footer .prompt-picker')
+    if (!resourcePicker || !promptPicker) {
+        return
+    }
+
+    const [resourcesResponse, promptsResponse] = await Promise.all([fetch('/api/mcp/resources'), fetch('/api/mcp/prompts')])
+
+    if (resourcesResponse.ok) {
+        const resources = await resourcesResponse.json()
+        resourcePicker.innerHTML = ''
+        for (const resource of resources) {
+            const option = document.createElement('option')
+            option.value = `${resource.server}:${resource.uri}`
+            option.textContent = `${resource.server}: ${resource.name || resource.uri}`
+            option.title = resource.description || resource.uri
+            resourcePicker.appendChild(option)
+        }
+        resourcePicker.hidden = resources.length === 0
+    }
+
+    if (promptsResponse.ok) {
+        const prompts = await promptsResponse.json()
+        promptPicker.innerHTML = ''
+        const placeholder = document.createElement('option')
+        placeholder.value = ''
+        placeholder.textContent = 'Prompt templates'
+        promptPicker.appendChild(placeholder)
+        for (const prompt of prompts) {
+            const option = document.createElement('option')
+            option.value = JSON.stringify(prompt)
+            option.textContent = `${prompt.server}: ${prompt.name}`
+            option.title = prompt.description || prompt.name
+            promptPicker.appendChild(option)
+        }
+        promptPicker.hidden = prompts.length === 0
+        promptPicker.onchange = usePrompt
+    }
+})
+
+document.body.addEventListener("click", async function(evt){
+    const button = evt.target.closest('#main .chat-message.user .edit-message')
+    if (!button) {
+        return
+    }
+
+    const message = button.closest('.chat-message')
+    const userMessages = Array.from(document.querySelectorAll('#main .chat-message.user'))
+    const index = userMessages.indexOf(message)
+
+    const raw = message.querySelector('.raw').innerHTML.trim()
+    const current = new TextDecoder().decode(Uint8Array.from(atob(raw), c => c.charCodeAt(0)))
+    const edited = window.prompt('Edit the message, the conversation continues from it', current)
+    if (edited === null || edited.trim() === '') {
+        return
+    }
+
+    const body = new URLSearchParams({index: index, 'user-input': edited})
+    const response = await fetch('/api/edit', {method: 'POST', body: body})
+    if (response.status === 409) {
+        window.alert('Wait for the current answer before editing a message')
+    }
 })
 
+document.body.addEventListener("click", async function(evt){
+    const button = evt.target.closest('#main .chat-message.user .select-branch')
+    if (!button) {
+        return
+    }
+
+    const message = button.closest('.chat-message')
+    const userMessages = Array.from(document.querySelectorAll('#main .chat-message.user'))
+    const index = userMessages.indexOf(message)
+
+    // Branches are shown one based and selected zero based
+    const branches = button.closest('.branches')
+    const branch = Number(branches.dataset.branch) - 1 + Number(button.dataset.step)
+
+    const body = new URLSearchParams({index: index, branch: branch})
+    const response = await fetch('/api/branch', {method: 'POST', body: body})
+    if (response.status === 409) {
+        window.alert('Wait for the current answer before switching versions')
+    }
+})
+
+async function usePrompt(evt) {
+    const promptPicker = evt.target
+    if (promptPicker.value === '') {
+        return
+    }
+    const prompt = JSON.parse(promptPicker.value)
+    promptPicker.value = ''
+
+    const body = new URLSearchParams({server: prompt.server, name: prompt.name})
+    for (const argument of prompt.arguments || []) {
+        const value = window.prompt(argument.description || argument.name, '')
+        if (value === null) {
+            return
+        }
+        if (value !== '' || argument.required) {
+            body.append(`arg-${argument.name}`, value)
+        }
+    }
+
+    const response = await fetch('/api/mcp/prompt', {method: 'POST', body: body})
+    if (response.status === 422) {
+        window.alert('This prompt contains assistant messages and cannot be used as a single message')
+        return
+    }
+    if (!response.ok) {
+        return
+    }
+    const expanded = await response.json()
+    const userInput = document.querySelector('.main-footer .user-input')
+    userInput.value = expanded.text
+    userInput.focus()
+}
+
+function capabilityLabels(capabilities) {
+    const labels = []
+    if (capabilities.tools === false) {
+        labels.push('no tools')
+    }
+    if (capabilities.vision === true) {
+        labels.push('vision')
+    }
+    if (capabilities.audio === true) {
+        labels.push('audio')
+    }
+    if (capabilities.contextLength) {
+        labels.push(`${Math.round(capabilities.contextLength / 1024)}k`)
+    }
+    return labels.length > 0 ? ` [${labels.join(', ')}]` : ''
+}
+
 function parseRawMessage(message) {
     const raw = message.querySelector('.raw')
     const formatted = message.querySelector('.formatted')